@@ -1,6 +1,12 @@
 package core
 
 import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
 	"github.com/andycai/unitool/models"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
@@ -10,38 +16,93 @@ type App struct {
 	FiberApp        *fiber.App
 	DB              *gorm.DB
 	DBs             []*gorm.DB
-	Config          *Config
 	RouterPublic    fiber.Router
 	RouterPublicApi fiber.Router
 	RouterApi       fiber.Router
 	RouterAdmin     fiber.Router
+	Tokens          *TokenService
+	Sessions        *SessionService
+
+	stopWatch chan struct{}
+	stopGC    chan struct{}
+
+	closing     chan struct{}
+	closingOnce sync.Once
 }
 
 func NewApp() *App {
-	return &App{}
+	return &App{closing: make(chan struct{})}
 }
 
-func (a *App) Start(dbs []*gorm.DB, fiberApp *fiber.App) {
-	a.Config = &config
+// Config 返回当前生效配置的快照，见 CurrentConfig
+func (a *App) Config() *Config {
+	return CurrentConfig()
+}
+
+// BeginShutdown 通知长连接（例如事件流）尽快结束，在关闭HTTP服务之前调用，
+// 否则关闭HTTP服务时会一直等待这些连接
+func (a *App) BeginShutdown() {
+	a.closingOnce.Do(func() {
+		close(a.closing)
+	})
+}
+
+// Closing 开始关闭时被关闭的通道
+func (a *App) Closing() <-chan struct{} {
+	return a.closing
+}
+
+func (a *App) Start(dbs []*gorm.DB, fiberApp *fiber.App) error {
+	// 根据依赖关系计算模块启动顺序，跳过已禁用的模块
+	if err := SortModules(); err != nil {
+		return err
+	}
+
 	a.DBs = dbs
 	a.DB = dbs[0]
 	a.FiberApp = fiberApp
 
-	sqlDb, _ := a.DB.DB()
-	SessionSetup(config.Database.Driver, sqlDb, config.Database.DSN, "sessions")
+	SessionSetup(a.DB, "sessions")
+
+	// 令牌服务
+	tokens.db = a.DB
+	a.Tokens = tokens
+	if err := tokens.autoMigrate(); err != nil {
+		return err
+	}
+
+	// 会话索引
+	sessions.db = a.DB
+	a.Sessions = sessions
+	if err := sessions.autoMigrate(); err != nil {
+		return err
+	}
+
+	a.stopGC = make(chan struct{})
+	go tokens.gcLoop(time.Hour, a.stopGC)
+	go sessions.gcLoop(time.Hour, a.stopGC)
 
 	// 注册静态路由
-	serverConfig := a.Config.Server
+	serverConfig := a.Config().Server
 	for _, staticPath := range serverConfig.StaticPaths {
 		fiberApp.Static(staticPath.Route, staticPath.Path)
 	}
 
-	AwakeModules(a)
+	if err := AwakeModules(a); err != nil {
+		return err
+	}
+
+	// 同步模块声明的权限和菜单，失败时不影响启动
+	if err := SyncCatalog(a.DB); err != nil {
+		log.Printf("同步权限和菜单失败: %v", err)
+	}
 
 	// 初始化公共路由
 	a.RouterPublic = fiberApp.Group("/")
 	a.RouterPublicApi = fiberApp.Group("/api")
-	InitPublicRouters()
+	if err := InitPublicRouters(a); err != nil {
+		return err
+	}
 
 	// 初始化API路由
 	a.RouterApi = fiberApp.Group("/api")
@@ -50,26 +111,77 @@ func (a *App) Start(dbs []*gorm.DB, fiberApp *fiber.App) {
 	// 初始化管理员路由
 	a.RouterAdmin = fiberApp.Group("/admin")
 	a.RouterAdmin.Use(AuthMiddleware)
-	InitAuthRouters()
+	if err := InitAuthRouters(a); err != nil {
+		return err
+	}
+	checkDeclaredPermissions()
+
+	// 系统接口
+	a.RouterApi.Get("/system/modules", a.HasPermission("system:module:list"), getModulesAction)
+	a.RouterApi.Post("/system/config/reload", a.HasPermission("system:config:reload"), reloadConfigAction)
+
+	// 监听配置文件变化
+	if interval := a.Config().App.ConfigWatchInterval; interval > 0 {
+		a.stopWatch = make(chan struct{})
+		go WatchConfig(time.Duration(interval)*time.Second, a.stopWatch)
+	}
+
+	return nil
+}
+
+// Stop 停止所有模块并释放会话存储和数据库连接
+func (a *App) Stop(ctx context.Context) error {
+	var errs []error
+
+	if a.stopWatch != nil {
+		close(a.stopWatch)
+	}
+	if a.stopGC != nil {
+		close(a.stopGC)
+	}
+
+	if err := StopModules(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := SessionClose(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, db := range a.DBs {
+		if sqlDB, err := db.DB(); err == nil {
+			if err := sqlDB.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 func (a *App) HasPermission(permissionCode string) fiber.Handler {
-	return HasPermission(permissionCode, a.CurrentUser)
+	return HasPermission(permissionCode, a.CurrentPermissions)
 }
 
-// Current 获取当前用户
-func (a *App) CurrentUser(c *fiber.Ctx) *models.User {
-	isAuthenticated, userID := GetSession(c)
+// HasAnyPermission 拥有任意一个权限即可访问
+func (a *App) HasAnyPermission(permissionCodes ...string) fiber.Handler {
+	return HasAnyPermission(permissionCodes, a.CurrentPermissions)
+}
 
-	if !isAuthenticated {
-		return nil
-	}
+// HasAllPermissions 必须拥有全部权限才能访问
+func (a *App) HasAllPermissions(permissionCodes ...string) fiber.Handler {
+	return HasAllPermissions(permissionCodes, a.CurrentPermissions)
+}
 
-	var vo models.User
-	if err := a.DB.Preload("Role.Permissions").First(&vo, userID).Error; err != nil {
+// CurrentUser 获取当前用户，无论通过哪种认证方式，都解析为同一个用户。
+// 结果在请求内和跨请求缓存，返回的是副本，不包含密码哈希
+func (a *App) CurrentUser(c *fiber.Ctx) *models.User {
+	entry := a.resolveUser(c)
+	if entry == nil {
 		return nil
 	}
 
+	vo := *entry.user
 	return &vo
 }
 
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const identityKey = "identity"
+
+// 认证方式
+const (
+	AuthMethodSession = "session"
+	AuthMethodJWT     = "jwt"
+	AuthMethodAPIKey  = "apikey"
+)
+
+// Identity 请求的认证结果
+type Identity struct {
+	UserID       uint     `json:"user_id"`
+	Method       string   `json:"method"`                  // 认证方式：session, jwt, apikey
+	CredentialID uint     `json:"credential_id,omitempty"` // 凭证ID，例如访问令牌ID
+	Scopes       []string `json:"scopes,omitempty"`        // 凭证授权的权限编码，nil 表示不限制
+}
+
+// AllowsPermission 凭证是否允许使用该权限，最终权限为用户权限与凭证授权范围的交集
+func (i *Identity) AllowsPermission(permissionCode string) bool {
+	if i.Scopes == nil {
+		return true
+	}
+	for _, scope := range i.Scopes {
+		if MatchPermission(scope, permissionCode) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator 认证器，未携带该认证方式的凭证时返回 nil, nil，凭证无效时返回错误
+type Authenticator interface {
+	Name() string
+	Authenticate(c *fiber.Ctx) (*Identity, error)
+}
+
+// AuthenticatedHook 认证器可选实现，认证成功并写入请求上下文后调用，可用于记录凭证的使用情况
+type AuthenticatedHook interface {
+	OnAuthenticated(c *fiber.Ctx, identity *Identity)
+}
+
+// 认证链，按顺序尝试：session、JWT，之后是模块注册的认证器
+var authenticators = []Authenticator{
+	&sessionAuthenticator{},
+	&jwtAuthenticator{},
+}
+
+// RegisterAuthenticator 注册认证器，追加到认证链末尾
+func RegisterAuthenticator(authenticator Authenticator) {
+	authenticators = append(authenticators, authenticator)
+}
+
+// Authenticate 依次使用认证链认证请求，结果缓存在请求上下文中
+func Authenticate(c *fiber.Ctx) (*Identity, error) {
+	if identity, ok := c.Locals(identityKey).(*Identity); ok {
+		return identity, nil
+	}
+
+	for _, authenticator := range authenticators {
+		identity, err := authenticator.Authenticate(c)
+		if err != nil {
+			return nil, err
+		}
+		if identity != nil {
+			c.Locals(identityKey, identity)
+			if hook, ok := authenticator.(AuthenticatedHook); ok {
+				hook.OnAuthenticated(c, identity)
+			}
+			return identity, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// CurrentIdentity 获取当前请求的认证结果，未认证时返回 nil
+func CurrentIdentity(c *fiber.Ctx) *Identity {
+	identity, err := Authenticate(c)
+	if err != nil {
+		return nil
+	}
+	return identity
+}
+
+// BearerToken 获取 Authorization 请求头中的 Bearer 令牌
+func BearerToken(c *fiber.Ctx) string {
+	authHeader := c.Get(fiber.HeaderAuthorization)
+	if len(authHeader) > 7 && strings.EqualFold(authHeader[:7], "Bearer ") {
+		return strings.TrimSpace(authHeader[7:])
+	}
+	return ""
+}
+
+// sessionAuthenticator 基于 fiber session cookie 的认证
+type sessionAuthenticator struct{}
+
+func (a *sessionAuthenticator) Name() string {
+	return AuthMethodSession
+}
+
+func (a *sessionAuthenticator) Authenticate(c *fiber.Ctx) (*Identity, error) {
+	isAuthenticated, userID := GetSession(c)
+	if !isAuthenticated {
+		return nil, nil
+	}
+	return &Identity{UserID: userID, Method: AuthMethodSession}, nil
+}
+
+// jwtAuthenticator 基于 Authorization: Bearer JWT 的认证
+type jwtAuthenticator struct{}
+
+func (a *jwtAuthenticator) Name() string {
+	return AuthMethodJWT
+}
+
+func (a *jwtAuthenticator) Authenticate(c *fiber.Ctx) (*Identity, error) {
+	tokenString := BearerToken(c)
+	// JWT 由三段组成，其它格式的令牌交给后续认证器处理
+	if strings.Count(tokenString, ".") != 2 {
+		return nil, nil
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// 验证签名方法
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(GetConfig().Auth.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("无效的token: %v", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("无效的token格式")
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok || userID <= 0 {
+		return nil, fmt.Errorf("无效的token格式")
+	}
+
+	// 检查服务端撤销列表，退出登录、修改密码等操作会撤销令牌
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, fmt.Errorf("无效的token格式")
+	}
+	revoked, err := tokens.IsRevoked(jti)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("token已撤销")
+	}
+
+	return &Identity{UserID: uint(userID), Method: AuthMethodJWT}, nil
+}
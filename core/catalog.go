@@ -0,0 +1,287 @@
+package core
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"gorm.io/gorm"
+)
+
+// PermissionDecl 模块声明的权限
+type PermissionDecl struct {
+	Code        string // 权限编码，全局唯一
+	Name        string // 权限名称，全局唯一
+	Description string
+}
+
+// MenuDecl 模块声明的菜单，以路径作为唯一标识
+type MenuDecl struct {
+	Parent     string // 父菜单的路径，为空表示顶级菜单组
+	Name       string
+	Path       string
+	Icon       string // 图标名称，对应 layout.html 中的 menuIcons
+	Sort       int    // 只在创建时使用，之后由管理员调整
+	Permission string // 绑定的权限，为空时所有用户可见
+}
+
+// SyncCatalog 将模块声明的权限和菜单同步到数据库，每次启动时执行，可以重复执行。
+// 已存在的记录按声明更新，模块不再声明的记录标记为孤立，新增的权限授予 auth.admin_role 配置的角色
+func SyncCatalog(db *gorm.DB) error {
+	if err := db.AutoMigrate(&models.Permission{}, &models.Menu{}); err != nil {
+		return err
+	}
+
+	created, err := syncPermissions(db)
+	if err != nil {
+		return err
+	}
+	if err := grantAdminRole(db, created); err != nil {
+		return err
+	}
+	if err := syncMenus(db); err != nil {
+		return err
+	}
+
+	users.invalidate()
+	return nil
+}
+
+// syncPermissions 同步正常运行的模块声明的权限，返回新增的权限
+func syncPermissions(db *gorm.DB) ([]models.Permission, error) {
+	// 所有已注册模块声明的权限，已禁用模块的权限不视为孤立
+	declared := make(map[string]bool)
+	for _, decl := range systemPermissions {
+		declared[decl.Code] = true
+	}
+	for _, entry := range registry {
+		for _, decl := range entry.info.Permissions {
+			declared[decl.Code] = true
+		}
+	}
+
+	var existing []models.Permission
+	if err := db.Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]*models.Permission, len(existing))
+	for i := range existing {
+		byCode[existing[i].Code] = &existing[i]
+	}
+
+	// 核心系统接口的权限和正常运行的模块声明的权限
+	owners := map[string][]PermissionDecl{systemModule: systemPermissions}
+	names := []string{systemModule}
+	for _, entry := range modules {
+		if entry.state == ModuleStateRunning {
+			owners[entry.info.Name] = entry.info.Permissions
+			names = append(names, entry.info.Name)
+		}
+	}
+
+	var created []models.Permission
+	var errs []error
+	now := time.Now()
+	for _, module := range names {
+		for _, decl := range owners[module] {
+			if perm, ok := byCode[decl.Code]; ok {
+				if perm.Name == decl.Name && perm.Description == decl.Description && perm.Module == module && !perm.Orphaned {
+					continue
+				}
+				if err := db.Model(perm).Updates(map[string]interface{}{
+					"name":        decl.Name,
+					"description": decl.Description,
+					"module":      module,
+					"orphaned":    false,
+					"updated_at":  now,
+				}).Error; err != nil {
+					errs = append(errs, err)
+				}
+				continue
+			}
+
+			perm := models.Permission{
+				Name:        decl.Name,
+				Code:        decl.Code,
+				Description: decl.Description,
+				Module:      module,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			if err := db.Create(&perm).Error; err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			byCode[perm.Code] = &perm
+			created = append(created, perm)
+			log.Printf("新增模块 %s 声明的权限: %s", module, perm.Code)
+		}
+	}
+
+	// 手动创建的权限不会被标记
+	for _, perm := range existing {
+		if perm.Module == "" || perm.Orphaned || declared[perm.Code] {
+			continue
+		}
+		if err := db.Model(&perm).Update("orphaned", true).Error; err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("权限 %s 已不再被模块 %s 声明，标记为孤立", perm.Code, perm.Module)
+	}
+
+	return created, errors.Join(errs...)
+}
+
+// grantAdminRole 将新增的权限授予配置的管理员角色，管理员之后撤销的权限不会被重新授予
+func grantAdminRole(db *gorm.DB, permissions []models.Permission) error {
+	name := GetConfig().Auth.AdminRole
+	if name == "" || len(permissions) == 0 {
+		return nil
+	}
+
+	var role models.Role
+	if err := db.Where("name = ?", name).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("auth.admin_role 配置的角色 %s 不存在，新增的权限没有授予任何角色", name)
+			return nil
+		}
+		return err
+	}
+
+	return db.Model(&role).Association("Permissions").Append(&permissions)
+}
+
+// syncMenus 同步正常运行的模块声明的菜单，父菜单先于子菜单创建
+func syncMenus(db *gorm.DB) error {
+	declared := make(map[string]bool)
+	for _, entry := range registry {
+		for _, decl := range entry.info.Menus {
+			declared[decl.Path] = true
+		}
+	}
+
+	var existing []models.Menu
+	if err := db.Order("id asc").Find(&existing).Error; err != nil {
+		return err
+	}
+	byPath := make(map[string]*models.Menu, len(existing))
+	for i := range existing {
+		if _, ok := byPath[existing[i].Path]; !ok {
+			byPath[existing[i].Path] = &existing[i]
+		}
+	}
+
+	type pendingMenu struct {
+		module string
+		decl   MenuDecl
+	}
+	var pending []pendingMenu
+	for _, entry := range modules {
+		if entry.state != ModuleStateRunning {
+			continue
+		}
+		for _, decl := range entry.info.Menus {
+			pending = append(pending, pendingMenu{module: entry.info.Name, decl: decl})
+		}
+	}
+
+	var errs []error
+	now := time.Now()
+	for len(pending) > 0 {
+		var next []pendingMenu
+		for _, item := range pending {
+			decl := item.decl
+
+			// 父菜单可能由其它模块声明，等父菜单同步后再处理
+			var parentID uint
+			if decl.Parent != "" {
+				parent, ok := byPath[decl.Parent]
+				if !ok {
+					next = append(next, item)
+					continue
+				}
+				parentID = parent.ID
+			}
+
+			if menu, ok := byPath[decl.Path]; ok {
+				if menu.ParentID == parentID && menu.Name == decl.Name && menu.Icon == decl.Icon &&
+					menu.Permission == decl.Permission && menu.Module == item.module && !menu.Orphaned {
+					continue
+				}
+				if err := db.Model(menu).Updates(map[string]interface{}{
+					"parent_id":  parentID,
+					"name":       decl.Name,
+					"icon":       decl.Icon,
+					"permission": decl.Permission,
+					"module":     item.module,
+					"orphaned":   false,
+					"updated_at": now,
+				}).Error; err != nil {
+					errs = append(errs, err)
+				}
+				continue
+			}
+
+			menu := models.Menu{
+				ParentID:   parentID,
+				Name:       decl.Name,
+				Path:       decl.Path,
+				Icon:       decl.Icon,
+				Sort:       decl.Sort,
+				Permission: decl.Permission,
+				IsShow:     true,
+				Module:     item.module,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			}
+			if err := db.Create(&menu).Error; err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			byPath[menu.Path] = &menu
+			log.Printf("新增模块 %s 声明的菜单: %s", item.module, menu.Path)
+		}
+
+		// 没有进展说明剩余菜单的父菜单不存在
+		if len(next) == len(pending) {
+			for _, item := range next {
+				log.Printf("模块 %s 声明的菜单 %s 的父菜单 %s 不存在，跳过", item.module, item.decl.Path, item.decl.Parent)
+			}
+			break
+		}
+		pending = next
+	}
+
+	for _, menu := range existing {
+		if menu.Module == "" || menu.Orphaned || declared[menu.Path] {
+			continue
+		}
+		if err := db.Model(&menu).Update("orphaned", true).Error; err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("菜单 %s 已不再被模块 %s 声明，标记为孤立", menu.Path, menu.Module)
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkDeclaredPermissions 检查路由使用的权限是否都已声明，未声明的权限不会出现在权限表中
+func checkDeclaredPermissions() {
+	declared := make(map[string]bool)
+	for _, entry := range registry {
+		for _, decl := range entry.info.Permissions {
+			declared[decl.Code] = true
+		}
+	}
+
+	for _, entry := range modules {
+		for _, code := range entry.permissions {
+			if !declared[code] {
+				log.Printf("模块 %s 的路由使用了未声明的权限: %s", entry.info.Name, code)
+			}
+		}
+	}
+}
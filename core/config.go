@@ -1,7 +1,16 @@
 package core
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
@@ -10,20 +19,24 @@ type Config struct {
 	App       AppConfig      `toml:"app"`
 	Server    ServerConfig   `toml:"server"`
 	Database  DatabaseConfig `toml:"database"`
-	JSONPaths JSONPathConfig `toml:"json_paths"`
+	JSONPaths JSONPathConfig `toml:"json_paths"` // 已迁移到 [modules.serverconf]，保留以兼容旧配置
 	FTP       FTPConfig      `toml:"ftp"`
 	Auth      AuthConfig     `toml:"auth"`
+
+	// 各模块自己的配置段 [modules.<name>]，由模块通过 DecodeModuleConfig 解析
+	Modules map[string]toml.Primitive `toml:"modules"`
 }
 
 type ServerConfig struct {
-	Host         string             `toml:"host"`
-	Port         int                `toml:"port"`
-	Output       string             `toml:"output"`
-	ScriptPath   string             `toml:"script_path"`
-	StaticPaths  []StaticPathConfig `toml:"static_paths"`
-	UserDataPath string             `toml:"user_data_path"`
-	CDNPath      string             `toml:"cdn_path"`
-	CDN2Path     string             `toml:"cdn2_path"`
+	Host            string             `toml:"host"`
+	Port            int                `toml:"port"`
+	Output          string             `toml:"output"`
+	ScriptPath      string             `toml:"script_path"`
+	StaticPaths     []StaticPathConfig `toml:"static_paths"`
+	UserDataPath    string             `toml:"user_data_path"`
+	CDNPath         string             `toml:"cdn_path"`
+	CDN2Path        string             `toml:"cdn2_path"`
+	ShutdownTimeout int                `toml:"shutdown_timeout"` // 优雅关闭时关闭HTTP服务和停止模块各自的最长等待时间（秒）
 }
 
 type DatabaseConfig struct {
@@ -59,20 +72,51 @@ type StaticPathConfig struct {
 }
 
 type AuthConfig struct {
-	JWTSecret   string `toml:"jwt_secret"`
-	TokenExpire int    `toml:"token_expire"`
+	JWTSecret          string `toml:"jwt_secret"`
+	TokenExpire        int    `toml:"token_expire"`         // 访问令牌有效期（秒）
+	RefreshTokenExpire int    `toml:"refresh_token_expire"` // 刷新令牌有效期（秒）
+	UserCacheTTL       int    `toml:"user_cache_ttl"`       // 用户和权限的缓存时间（秒），0 表示只在单个请求内缓存
+	AdminRole          string `toml:"admin_role"`           // 启动时新增的权限自动授予该角色，为空时不授予
 }
 
 type AppConfig struct {
-	IsDev    bool `toml:"is_dev"`    // 是否为开发环境
-	IsSecure bool `toml:"is_secure"` // 是否启用安全模式
+	IsDev      bool   `toml:"is_dev"`      // 是否为开发环境
+	IsSecure   bool   `toml:"is_secure"`   // 是否启用安全模式
+	BootPolicy string `toml:"boot_policy"` // 模块启动失败策略：abort(终止启动), degrade(降级并跳过该模块)
+
+	ConfigWatchInterval int `toml:"config_watch_interval"` // 配置文件检查间隔（秒），0 表示不监听
+}
+
+// loadedConfig 一份生效的配置，发布后不再修改，变更时整体替换
+type loadedConfig struct {
+	cfg  *Config
+	meta toml.MetaData // 用于解析 Modules 中尚未解码的配置段
 }
 
-var config Config
+var (
+	current     atomic.Pointer[loadedConfig]
+	configMutex sync.Mutex // 串行化配置的写入，读取直接使用 current
+	configPath  string
+
+	// 命令行参数覆盖，重新加载配置文件后需要再次应用
+	applyFlags func(cfg *Config)
+)
+
+// 修改后需要重启服务才能生效的配置项
+var restartRequiredKeys = map[string]bool{
+	"app.is_dev":                true,
+	"app.is_secure":             true,
+	"app.boot_policy":           true,
+	"server.host":               true,
+	"server.port":               true,
+	"server.static_paths":       true,
+	"database":                  true,
+	"app.config_watch_interval": true,
+}
 
 func LoadConfig() error {
 	// 定义配置文件路径参数
-	configPath := flag.String("config", "conf.toml", "配置文件路径")
+	path := flag.String("config", "conf.toml", "配置文件路径")
 	host := flag.String("host", "", "主机地址")
 	port := flag.Int("port", 0, "端口号")
 	output := flag.String("output", "", "输出目录")
@@ -89,103 +133,464 @@ func LoadConfig() error {
 
 	flag.Parse()
 
-	if _, err := toml.DecodeFile(*configPath, &config); err != nil {
+	configPath = *path
+
+	// 命令行参数覆盖配置文件
+	applyFlags = func(cfg *Config) {
+		if *host != "" {
+			cfg.Server.Host = *host
+		}
+		if *port != 0 {
+			cfg.Server.Port = *port
+		}
+		if *output != "" {
+			cfg.Server.Output = *output
+		}
+		if *scriptPath != "" {
+			cfg.Server.ScriptPath = *scriptPath
+		}
+		if *userDataPath != "" {
+			cfg.Server.UserDataPath = *userDataPath
+		}
+		if *dbPath != "" {
+			cfg.Database.DSN = *dbPath
+		}
+		if *ftpHost != "" {
+			cfg.FTP.Host = *ftpHost
+		}
+		if *ftpPort != "" {
+			cfg.FTP.Port = *ftpPort
+		}
+		if *ftpUser != "" {
+			cfg.FTP.User = *ftpUser
+		}
+		if *ftpPass != "" {
+			cfg.FTP.Password = *ftpPass
+		}
+		if *ftpApkPath != "" {
+			cfg.FTP.APKPath = *ftpApkPath
+		}
+		if *ftpZipPath != "" {
+			cfg.FTP.ZIPPath = *ftpZipPath
+		}
+		if *isDev {
+			cfg.App.IsDev = true
+		}
+	}
+
+	cfg, meta, err := readConfigFile(configPath)
+	if err != nil {
 		return err
 	}
 
+	current.Store(&loadedConfig{cfg: &cfg, meta: meta})
+
+	return nil
+}
+
+// readConfigFile 读取配置文件，依次应用环境变量、默认值和命令行参数，并校验最终配置
+func readConfigFile(path string) (Config, toml.MetaData, error) {
+	var cfg Config
+	meta, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
+		return cfg, meta, err
+	}
+
+	// 环境变量覆盖配置文件，错误与校验结果一并返回
+	envErr := applyEnv(&cfg)
+
 	// 设置默认值
-	if config.Database.MaxOpenConns == 0 {
-		config.Database.MaxOpenConns = 100 // 默认最大连接数
+	if cfg.Database.MaxOpenConns == 0 {
+		cfg.Database.MaxOpenConns = 100 // 默认最大连接数
+	}
+	if cfg.Database.MaxIdleConns == 0 {
+		cfg.Database.MaxIdleConns = 10 // 默认最大空闲连接数
 	}
-	if config.Database.MaxIdleConns == 0 {
-		config.Database.MaxIdleConns = 10 // 默认最大空闲连接数
+	if cfg.Database.ConnMaxLifetime == 0 {
+		cfg.Database.ConnMaxLifetime = 3600 // 默认连接生命周期为1小时
 	}
-	if config.Database.ConnMaxLifetime == 0 {
-		config.Database.ConnMaxLifetime = 3600 // 默认连接生命周期为1小时
+	if cfg.App.BootPolicy == "" {
+		cfg.App.BootPolicy = BootPolicyAbort // 默认任一模块失败即终止启动
+	}
+	if cfg.Server.ShutdownTimeout == 0 {
+		cfg.Server.ShutdownTimeout = 30 // 默认优雅关闭等待30秒
 	}
 
-	// 命令行参数覆盖配置文件
-	if *host != "" {
-		config.Server.Host = *host
+	if applyFlags != nil {
+		applyFlags(&cfg)
 	}
-	if *port != 0 {
-		config.Server.Port = *port
+
+	return cfg, meta, errors.Join(envErr, validateConfig(&cfg, meta))
+}
+
+// applyEnv 使用环境变量覆盖配置，变量名格式为 UNITOOL_<SECTION>_<KEY>，如 UNITOOL_FTP_PASSWORD
+func applyEnv(cfg *Config) error {
+	return applyEnvToStruct(reflect.ValueOf(cfg).Elem(), envPrefix)
+}
+
+const envPrefix = "UNITOOL"
+
+// applyEnvToStruct 按 toml 标签递归查找对应的环境变量
+func applyEnvToStruct(value reflect.Value, prefix string) error {
+	var errs []error
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		key := strings.Split(field.Tag.Get("toml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+
+		// 模块配置段由模块自行解析并应用环境变量
+		if field.Type.Kind() == reflect.Map {
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnvToStruct(value.Field(i), name); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(value.Field(i), env); err != nil {
+			errs = append(errs, fmt.Errorf("环境变量 %s 无效: %w", name, err))
+		}
 	}
-	if *output != "" {
-		config.Server.Output = *output
+
+	return errors.Join(errs...)
+}
+
+// setEnvValue 将环境变量的值写入字段，字符串直接赋值，其它类型按 TOML 值解析
+func setEnvValue(field reflect.Value, env string) error {
+	if field.Kind() == reflect.String {
+		field.SetString(env)
+		return nil
 	}
-	if *scriptPath != "" {
-		config.Server.ScriptPath = *scriptPath
+
+	// 借助 TOML 解析数字、布尔值和数组，如 [{ route = "/static", path = "./public" }]
+	holder := reflect.New(reflect.StructOf([]reflect.StructField{{
+		Name: "V",
+		Type: field.Type(),
+		Tag:  `toml:"v"`,
+	}}))
+	if _, err := toml.Decode("v = "+env, holder.Interface()); err != nil {
+		return err
 	}
-	if *userDataPath != "" {
-		config.Server.UserDataPath = *userDataPath
+	field.Set(holder.Elem().Field(0))
+
+	return nil
+}
+
+// 默认的 JWT 密钥，仅允许在开发环境中使用
+const defaultJWTSecret = "your-secret-key"
+
+// validateConfig 校验配置是否可用，一次性返回所有问题
+func validateConfig(cfg *Config, meta toml.MetaData) error {
+	var errs []error
+
+	if cfg.App.BootPolicy != BootPolicyAbort && cfg.App.BootPolicy != BootPolicyDegrade {
+		errs = append(errs, fmt.Errorf("app.boot_policy 无效: %s", cfg.App.BootPolicy))
+	}
+	if cfg.App.ConfigWatchInterval < 0 {
+		errs = append(errs, fmt.Errorf("app.config_watch_interval 不能为负数: %d", cfg.App.ConfigWatchInterval))
+	}
+
+	if cfg.Server.Port <= 0 || cfg.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port 超出范围(1-65535): %d", cfg.Server.Port))
+	}
+	// 脚本目录只有 shell 模块使用，模块禁用时不检查
+	if cfg.Server.ScriptPath != "" && moduleEnabled(cfg, meta, "shell") {
+		if info, err := os.Stat(cfg.Server.ScriptPath); err != nil {
+			errs = append(errs, fmt.Errorf("server.script_path 不存在: %s", cfg.Server.ScriptPath))
+		} else if !info.IsDir() {
+			errs = append(errs, fmt.Errorf("server.script_path 不是目录: %s", cfg.Server.ScriptPath))
+		}
+	}
+	if cfg.Server.ShutdownTimeout < 0 {
+		errs = append(errs, fmt.Errorf("server.shutdown_timeout 不能为负数: %d", cfg.Server.ShutdownTimeout))
 	}
-	if *dbPath != "" {
-		config.Database.DSN = *dbPath
+	for i, staticPath := range cfg.Server.StaticPaths {
+		if staticPath.Route == "" || staticPath.Path == "" {
+			errs = append(errs, fmt.Errorf("server.static_paths[%d] 的 route 和 path 不能为空", i))
+		}
 	}
-	if *ftpHost != "" {
-		config.FTP.Host = *ftpHost
+
+	switch cfg.Database.Driver {
+	case "mysql", "postgres", "sqlite":
+	case "":
+		errs = append(errs, errors.New("database.driver 不能为空"))
+	default:
+		errs = append(errs, fmt.Errorf("database.driver 不支持: %s", cfg.Database.Driver))
 	}
-	if *ftpPort != "" {
-		config.FTP.Port = *ftpPort
+	if cfg.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn 不能为空"))
 	}
-	if *ftpUser != "" {
-		config.FTP.User = *ftpUser
+	if cfg.Database.MaxOpenConns < 0 || cfg.Database.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("database 连接数不能为负数"))
 	}
-	if *ftpPass != "" {
-		config.FTP.Password = *ftpPass
+
+	if cfg.Auth.JWTSecret == "" {
+		errs = append(errs, errors.New("auth.jwt_secret 不能为空"))
+	} else if cfg.Auth.JWTSecret == defaultJWTSecret && !cfg.App.IsDev {
+		errs = append(errs, errors.New("非开发环境不能使用默认的 auth.jwt_secret，请修改配置或设置 UNITOOL_AUTH_JWT_SECRET"))
 	}
-	if *ftpApkPath != "" {
-		config.FTP.APKPath = *ftpApkPath
+	if cfg.Auth.TokenExpire < 0 {
+		errs = append(errs, fmt.Errorf("auth.token_expire 不能为负数: %d", cfg.Auth.TokenExpire))
 	}
-	if *ftpZipPath != "" {
-		config.FTP.ZIPPath = *ftpZipPath
+	if cfg.Auth.RefreshTokenExpire < 0 {
+		errs = append(errs, fmt.Errorf("auth.refresh_token_expire 不能为负数: %d", cfg.Auth.RefreshTokenExpire))
 	}
-	if *isDev {
-		config.App.IsDev = true
+	if cfg.Auth.UserCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("auth.user_cache_ttl 不能为负数: %d", cfg.Auth.UserCacheTTL))
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// ReloadResult 配置重新加载结果
+type ReloadResult struct {
+	Changed        []string `json:"changed"`         // 已生效的配置项
+	RequireRestart []string `json:"require_restart"` // 需要重启才能生效的配置项
+	ModuleErrors   []string `json:"module_errors"`   // 模块处理配置变更时的错误
+}
+
+// ReloadConfig 重新加载配置文件，校验通过后应用并通知各模块
+func ReloadConfig() (*ReloadResult, error) {
+	cfg, meta, err := readConfigFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("配置无效: %w", err)
+	}
+
+	configMutex.Lock()
+	loaded := current.Load()
+	old := loaded.cfg
+	result := &ReloadResult{}
+	for _, key := range diffConfig(*old, cfg) {
+		name, isModule := strings.CutPrefix(key, "modules.")
+		if isModule && moduleEnabled(old, loaded.meta, name) != moduleEnabled(&cfg, meta, name) {
+			result.RequireRestart = append(result.RequireRestart, key+".enabled")
+		} else if restartRequiredKeys[key] {
+			result.RequireRestart = append(result.RequireRestart, key)
+		} else {
+			result.Changed = append(result.Changed, key)
+		}
+	}
+
+	// 需要重启的配置项保留原值，避免运行时状态不一致
+	cfg.App.IsDev = old.App.IsDev
+	cfg.App.IsSecure = old.App.IsSecure
+	cfg.App.BootPolicy = old.App.BootPolicy
+	cfg.App.ConfigWatchInterval = old.App.ConfigWatchInterval
+	cfg.Server.Host = old.Server.Host
+	cfg.Server.Port = old.Server.Port
+	cfg.Server.StaticPaths = old.Server.StaticPaths
+	cfg.Database = old.Database
+
+	current.Store(&loadedConfig{cfg: &cfg, meta: meta})
+	configMutex.Unlock()
+
+	if len(result.RequireRestart) > 0 {
+		log.Printf("以下配置需要重启服务才能生效: %s", strings.Join(result.RequireRestart, ", "))
+	}
+
+	if len(result.Changed) > 0 {
+		log.Printf("配置已重新加载: %s", strings.Join(result.Changed, ", "))
+		if err := NotifyConfigChange(old, &cfg); err != nil {
+			log.Printf("模块处理配置变更失败: %v", err)
+			result.ModuleErrors = strings.Split(err.Error(), "\n")
+		}
+	}
+
+	return result, nil
+}
+
+// diffConfig 比较两份配置，返回发生变化的配置项
+func diffConfig(old, cfg Config) []string {
+	var keys []string
+
+	oldValue := reflect.ValueOf(old)
+	newValue := reflect.ValueOf(cfg)
+	for i := 0; i < oldValue.NumField(); i++ {
+		section := oldValue.Type().Field(i)
+		sectionName := strings.Split(section.Tag.Get("toml"), ",")[0]
+
+		// 模块配置段按模块细分
+		if section.Type.Kind() == reflect.Map {
+			names := make(map[string]bool)
+			for _, key := range oldValue.Field(i).MapKeys() {
+				names[key.String()] = true
+			}
+			for _, key := range newValue.Field(i).MapKeys() {
+				names[key.String()] = true
+			}
+			for name := range names {
+				oldSection := oldValue.Field(i).MapIndex(reflect.ValueOf(name))
+				newSection := newValue.Field(i).MapIndex(reflect.ValueOf(name))
+				if oldSection.IsValid() != newSection.IsValid() ||
+					(oldSection.IsValid() && !reflect.DeepEqual(oldSection.Interface(), newSection.Interface())) {
+					keys = append(keys, sectionName+"."+name)
+				}
+			}
+			continue
+		}
+
+		// database 整体需要重启，不再细分
+		if sectionName == "database" || section.Type.Kind() != reflect.Struct {
+			if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+				keys = append(keys, sectionName)
+			}
+			continue
+		}
+
+		for j := 0; j < section.Type.NumField(); j++ {
+			field := section.Type.Field(j)
+			if !reflect.DeepEqual(oldValue.Field(i).Field(j).Interface(), newValue.Field(i).Field(j).Interface()) {
+				keys = append(keys, sectionName+"."+strings.Split(field.Tag.Get("toml"), ",")[0])
+			}
+		}
+	}
+
+	return keys
+}
+
+// DecodeModuleConfig 将 [modules.<name>] 配置段解析到模块自己的结构体中，
+// 未配置的字段保留 v 中的原值，随后应用 UNITOOL_MODULES_<NAME>_<KEY> 环境变量
+func DecodeModuleConfig(name string, v any) error {
+	loaded := current.Load()
+	section, ok := loaded.cfg.Modules[name]
+	meta := loaded.meta
+
+	if ok {
+		if err := meta.PrimitiveDecode(section, v); err != nil {
+			return fmt.Errorf("解析模块 %s 的配置失败: %w", name, err)
+		}
+	}
+
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	return applyEnvToStruct(value.Elem(), envPrefix+"_MODULES_"+strings.ToUpper(name))
+}
+
+// IsModuleEnabled 返回模块是否启用，未配置 enabled 时默认启用
+func IsModuleEnabled(name string) bool {
+	loaded := current.Load()
+	return moduleEnabled(loaded.cfg, loaded.meta, name)
+}
+
+func moduleEnabled(cfg *Config, meta toml.MetaData, name string) bool {
+	var section struct {
+		Enabled *bool `toml:"enabled"`
+	}
+
+	if primitive, ok := cfg.Modules[name]; ok {
+		if err := meta.PrimitiveDecode(primitive, &section); err != nil {
+			return true
+		}
+	}
+
+	env := strings.ToUpper(envPrefix + "_MODULES_" + name + "_ENABLED")
+	if value, ok := os.LookupEnv(env); ok {
+		enabled := value == "true" || value == "1"
+		section.Enabled = &enabled
+	}
+
+	return section.Enabled == nil || *section.Enabled
+}
+
+// WatchConfig 定时检查配置文件修改时间，发生变化时自动重新加载
+func WatchConfig(interval time.Duration, done <-chan struct{}) {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		log.Printf("监听配置文件失败: %v", err)
+		return
+	}
+	lastModTime := info.ModTime()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(configPath)
+			if err != nil || !info.ModTime().After(lastModTime) {
+				continue
+			}
+			lastModTime = info.ModTime()
+
+			if _, err := ReloadConfig(); err != nil {
+				log.Printf("配置文件已修改，但重新加载失败: %v", err)
+			}
+		}
+	}
+}
+
+// CurrentConfig 返回当前生效配置的快照，调用方不能修改。
+// 重新加载配置会发布新的快照，需要最新配置时应重新获取
+func CurrentConfig() *Config {
+	return current.Load().cfg
 }
 
 func GetConfig() Config {
-	return config
+	return *CurrentConfig()
 }
 
 func GetServerConfig() ServerConfig {
-	return config.Server
+	return CurrentConfig().Server
 }
 
 func GetDatabaseConfig() DatabaseConfig {
-	return config.Database
+	return CurrentConfig().Database
 }
 
 func GetFTPConfig() FTPConfig {
-	return config.FTP
+	return CurrentConfig().FTP
 }
 
 func GetJSONPathConfig() JSONPathConfig {
-	return config.JSONPaths
+	return CurrentConfig().JSONPaths
 }
 
 func UpdateServerConfig(newConfig ServerConfig) {
-	config.Server = newConfig
+	updateConfig(func(cfg *Config) { cfg.Server = newConfig })
 }
 
 func UpdateDatabaseConfig(newConfig DatabaseConfig) {
-	config.Database = newConfig
+	updateConfig(func(cfg *Config) { cfg.Database = newConfig })
 }
 
 func UpdateFTPConfig(newConfig FTPConfig) {
-	config.FTP = newConfig
+	updateConfig(func(cfg *Config) { cfg.FTP = newConfig })
+}
+
+// updateConfig 复制当前配置并修改，再作为新的快照发布
+func updateConfig(update func(cfg *Config)) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	loaded := current.Load()
+	cfg := *loaded.cfg
+	update(&cfg)
+	current.Store(&loadedConfig{cfg: &cfg, meta: loaded.meta})
 }
 
 // IsDevelopment 返回是否为开发环境
 func IsDevelopment() bool {
-	return config.App.IsDev
+	return CurrentConfig().App.IsDev
 }
 
 // IsSecureMode 返回是否为安全模式
 func IsSecureMode() bool {
-	return config.App.IsSecure
+	return CurrentConfig().App.IsSecure
 }
@@ -1,7 +1,15 @@
 package core
 
 import (
-	"github.com/andycai/unitool/core/collections"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
 )
 
 type Module interface {
@@ -9,6 +17,8 @@ type Module interface {
 	Start() error
 	AddPublicRouters() error
 	AddAuthRouters() error
+	OnConfigChange(old, new *Config) error
+	Stop(context.Context) error
 }
 
 type BaseModule struct {
@@ -32,40 +42,369 @@ func (m *BaseModule) AddAuthRouters() error {
 	return nil
 }
 
-var modules = collections.NewPriorityQueue[Module]()
+func (m *BaseModule) OnConfigChange(old, new *Config) error {
+	return nil
+}
+
+func (m *BaseModule) Stop(ctx context.Context) error {
+	return nil
+}
+
+// ModuleInfo 模块声明信息
+type ModuleInfo struct {
+	Name        string           // 模块名称，全局唯一
+	Depends     []string         // 依赖的模块名称，依赖的模块会先于本模块初始化
+	Permissions []PermissionDecl // 模块使用的权限，启动时同步到权限表
+	Menus       []MenuDecl       // 模块的菜单，启动时同步到菜单表
+}
+
+// 模块状态
+const (
+	ModuleStateRegistered = "registered" // 已注册，尚未初始化
+	ModuleStateAwake      = "awake"      // 已完成 Awake
+	ModuleStateRunning    = "running"    // 已完成 Start，正常运行
+	ModuleStateDegraded   = "degraded"   // 初始化失败，已跳过其路由
+	ModuleStateStopped    = "stopped"    // 已停止
+	ModuleStateDisabled   = "disabled"   // 已在配置中禁用
+)
+
+// 启动失败处理策略
+const (
+	BootPolicyAbort   = "abort"   // 任一模块失败即终止启动
+	BootPolicyDegrade = "degrade" // 将失败模块标记为降级并继续启动
+)
+
+// RouteInfo 模块注册的路由
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// ModuleStatus 模块运行状态
+type ModuleStatus struct {
+	Name        string      `json:"name"`
+	Depends     []string    `json:"depends"`
+	State       string      `json:"state"`
+	Error       string      `json:"error"`
+	Routes      []RouteInfo `json:"routes"`
+	Permissions []string    `json:"permissions"`
+}
+
+type moduleEntry struct {
+	info        ModuleInfo
+	module      Module
+	state       string
+	err         error
+	routes      []RouteInfo
+	permissions []string
+}
+
+var (
+	registry     = make(map[string]*moduleEntry) // 已注册的模块
+	modules      []*moduleEntry                  // 按依赖关系排序后的模块
+	moduleMutex  sync.RWMutex
+	routingEntry *moduleEntry // 正在注册路由的模块，用于记录其路由和权限码
+)
 
 // RegisterModule 注册模块
-func RegisterModule(module Module, priority int) {
-	modules.Enqueue(module, priority)
+func RegisterModule(module Module, info ModuleInfo) {
+	if info.Name == "" {
+		panic(fmt.Sprintf("模块 %T 未声明名称", module))
+	}
+	if _, ok := registry[info.Name]; ok {
+		panic(fmt.Sprintf("模块重复注册: %s", info.Name))
+	}
+
+	registry[info.Name] = &moduleEntry{info: info, module: module, state: ModuleStateRegistered}
+}
+
+// SortModules 根据模块声明的依赖关系计算启动顺序，存在循环依赖或缺失依赖时返回错误
+func SortModules() error {
+	names := make([]string, 0, len(registry))
+	for name, entry := range registry {
+		// 配置 [modules.<name>] enabled = false 的模块不参与启动
+		if !IsModuleEnabled(name) {
+			entry.state = ModuleStateDisabled
+			continue
+		}
+		names = append(names, name)
+	}
+	// 保证相同依赖关系下的启动顺序稳定
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int, len(registry))
+	sorted := make([]*moduleEntry, 0, len(registry))
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			// 截取从首次进入该模块开始的路径，便于定位循环
+			start := 0
+			for i, n := range path {
+				if n == name {
+					start = i
+					break
+				}
+			}
+			cycle := append(append([]string{}, path[start:]...), name)
+			return fmt.Errorf("检测到模块循环依赖: %s", strings.Join(cycle, " -> "))
+		}
+
+		entry := registry[name]
+		state[name] = visiting
+		path = append(path, name)
+
+		deps := append([]string{}, entry.info.Depends...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			depEntry, ok := registry[dep]
+			if !ok {
+				return fmt.Errorf("模块 %s 依赖的模块 %s 未注册", name, dep)
+			}
+			if depEntry.state == ModuleStateDisabled {
+				return fmt.Errorf("模块 %s 依赖的模块 %s 已禁用", name, dep)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[name] = visited
+		sorted = append(sorted, entry)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+
+	modules = sorted
+	return nil
 }
 
 // InitPublicRouters 初始化公共路由
-func InitPublicRouters() {
-	modules.ForEach(func(module Module, priority int) bool {
-		module.AddPublicRouters()
-		return true
+func InitPublicRouters(app *App) error {
+	return initRouters(app, func(module Module) error {
+		return module.AddPublicRouters()
 	})
 }
 
 // InitAuthRouters 初始化管理员路由
-func InitAuthRouters() {
-	modules.ForEach(func(module Module, priority int) bool {
-		module.AddAuthRouters()
-		return true
+func InitAuthRouters(app *App) error {
+	return initRouters(app, func(module Module) error {
+		return module.AddAuthRouters()
 	})
 }
 
+// initRouters 依次为正常运行的模块注册路由，并记录每个模块注册的路由
+func initRouters(app *App, add func(Module) error) error {
+	for _, entry := range modules {
+		if entry.state != ModuleStateRunning {
+			continue
+		}
+
+		before := countRoutes(app.FiberApp)
+		routingEntry = entry
+		err := add(entry.module)
+		routingEntry = nil
+
+		if err != nil {
+			if err := failModule(app, entry, "注册路由", err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// 对比注册前后的路由，得到本模块新增的路由
+		for key, count := range countRoutes(app.FiberApp) {
+			for i := before[key]; i < count; i++ {
+				method, path, _ := strings.Cut(key, " ")
+				entry.routes = append(entry.routes, RouteInfo{Method: method, Path: path})
+			}
+		}
+	}
+
+	return nil
+}
+
+// countRoutes 统计当前已注册的路由数量，HEAD 路由由 GET 自动生成，不计入
+func countRoutes(fiberApp *fiber.App) map[string]int {
+	counts := make(map[string]int)
+	for _, route := range fiberApp.GetRoutes(true) {
+		if route.Method == fiber.MethodHead {
+			continue
+		}
+		counts[route.Method+" "+route.Path]++
+	}
+	return counts
+}
+
+// recordPermission 记录正在注册路由的模块所使用的权限码
+func recordPermission(code string) {
+	if routingEntry == nil {
+		return
+	}
+	for _, c := range routingEntry.permissions {
+		if c == code {
+			return
+		}
+	}
+	routingEntry.permissions = append(routingEntry.permissions, code)
+}
+
 // AwakeModules 模块初始化
-func AwakeModules(app *App) {
+func AwakeModules(app *App) error {
 	// 模块初始化
-	modules.ForEach(func(module Module, priority int) bool {
-		module.Awake(app)
-		return true
-	})
+	for _, entry := range modules {
+		if err := checkDepends(entry); err != nil {
+			if err := failModule(app, entry, "初始化", err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := entry.module.Awake(app); err != nil {
+			if err := failModule(app, entry, "初始化", err); err != nil {
+				return err
+			}
+			continue
+		}
+		setModuleState(entry, ModuleStateAwake, nil)
+	}
 
 	// 模块启动
-	modules.ForEach(func(module Module, priority int) bool {
-		module.Start()
-		return true
-	})
+	for _, entry := range modules {
+		if entry.state != ModuleStateAwake {
+			continue
+		}
+		if err := checkDepends(entry); err != nil {
+			if err := failModule(app, entry, "启动", err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := entry.module.Start(); err != nil {
+			if err := failModule(app, entry, "启动", err); err != nil {
+				return err
+			}
+			continue
+		}
+		setModuleState(entry, ModuleStateRunning, nil)
+	}
+
+	return nil
+}
+
+// checkDepends 检查依赖的模块是否可用
+func checkDepends(entry *moduleEntry) error {
+	for _, dep := range entry.info.Depends {
+		if registry[dep].state == ModuleStateDegraded {
+			return fmt.Errorf("依赖的模块 %s 不可用", dep)
+		}
+	}
+	return nil
+}
+
+// failModule 处理模块失败，abort 策略下返回错误终止启动，degrade 策略下将模块标记为降级
+func failModule(app *App, entry *moduleEntry, stage string, err error) error {
+	err = fmt.Errorf("模块 %s %s失败: %w", entry.info.Name, stage, err)
+	if app.Config().App.BootPolicy != BootPolicyDegrade {
+		return err
+	}
+
+	log.Printf("%v，已降级", err)
+	setModuleState(entry, ModuleStateDegraded, err)
+	return nil
+}
+
+func setModuleState(entry *moduleEntry, state string, err error) {
+	moduleMutex.Lock()
+	defer moduleMutex.Unlock()
+
+	entry.state = state
+	entry.err = err
+}
+
+// GetModuleStatuses 获取所有模块的运行状态，按启动顺序排列
+func GetModuleStatuses() []ModuleStatus {
+	moduleMutex.RLock()
+	defer moduleMutex.RUnlock()
+
+	statuses := make([]ModuleStatus, 0, len(modules))
+	for _, entry := range modules {
+		status := ModuleStatus{
+			Name:        entry.info.Name,
+			Depends:     entry.info.Depends,
+			State:       entry.state,
+			Routes:      entry.routes,
+			Permissions: entry.permissions,
+		}
+		if entry.err != nil {
+			status.Error = entry.err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+
+	// 已禁用的模块排在最后
+	var disabled []string
+	for name, entry := range registry {
+		if entry.state == ModuleStateDisabled {
+			disabled = append(disabled, name)
+		}
+	}
+	sort.Strings(disabled)
+	for _, name := range disabled {
+		statuses = append(statuses, ModuleStatus{
+			Name:    name,
+			Depends: registry[name].info.Depends,
+			State:   ModuleStateDisabled,
+		})
+	}
+
+	return statuses
+}
+
+// NotifyConfigChange 通知正常运行的模块配置已变更
+func NotifyConfigChange(old, new *Config) error {
+	var errs []error
+	for _, entry := range modules {
+		if entry.state != ModuleStateRunning {
+			continue
+		}
+		if err := entry.module.OnConfigChange(old, new); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.info.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// StopModules 按启动顺序逆序停止模块，依赖方先于被依赖方停止
+func StopModules(ctx context.Context) error {
+	var errs []error
+	for i := len(modules) - 1; i >= 0; i-- {
+		entry := modules[i]
+		// 降级或未启动的模块无需停止
+		if entry.state != ModuleStateRunning {
+			continue
+		}
+		if err := entry.module.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.info.Name, err))
+		}
+		setModuleState(entry, ModuleStateStopped, nil)
+	}
+
+	return errors.Join(errs...)
 }
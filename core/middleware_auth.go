@@ -2,13 +2,8 @@ package core
 
 import (
 	"errors"
-	"fmt"
-	"strings"
 
-	"github.com/andycai/unitool/models"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
-	"gorm.io/gorm"
 )
 
 // SkipAuth 用于标记不需要认证的路由
@@ -19,109 +14,89 @@ func SkipAuthRoute(path string) {
 	skipAuthRoutes[path] = true
 }
 
+// AuthMiddleware 认证中间件，依次尝试 session、Bearer JWT 和模块注册的认证器
 func AuthMiddleware(c *fiber.Ctx) error {
 	// 检查是否是不需要认证的路由
 	if skipAuthRoutes[c.Path()] {
 		return c.Next()
 	}
 
-	isAuthenticated, _ := GetSession(c)
+	identity, err := Authenticate(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+	}
 
-	if isAuthenticated {
+	if identity != nil {
 		return c.Next()
 	}
 
 	return fiber.NewError(fiber.StatusUnauthorized, "未授权访问")
 }
 
-// AuthMiddleware 认证中间件
-func AuthMiddleware2(db *gorm.DB, JWTSecret string) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		// 首先从请求头获取 token
-		authHeader := c.Get("Authorization")
-
-		// 如果请求头没有 token，尝试从 cookie 获取
-		if authHeader == "" {
-			if token := c.Cookies("token"); token != "" {
-				authHeader = "Bearer " + token
-				// 设置到请求头中，方便后续使用
-				c.Request().Header.Set("Authorization", authHeader)
-			}
-		}
-
-		// 如果还是没有 token
-		if authHeader == "" {
-			// 对于页面请求，重定向到登录页
-			if c.Method() == "GET" && !strings.HasPrefix(c.Path(), "/api/") {
-				return c.Redirect("/login")
-			}
-			return c.Status(401).JSON(fiber.Map{"error": "未授权访问"})
-		}
-
-		// 解析 token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// 验证签名方法
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(JWTSecret), nil
-		})
-
-		// token 验证失败
-		if err != nil || !token.Valid {
-			// 对于页面请求，重定向到登录页
-			if c.Method() == "GET" && !strings.HasPrefix(c.Path(), "/api/") {
-				return c.Redirect("/login")
-			}
-			return c.Status(401).JSON(fiber.Map{"error": fmt.Sprintf("无效的token: %v", err)})
-		}
+// DenyAPIKey 拒绝使用访问令牌的请求。访问令牌的授权范围只在权限检查中间件中生效，
+// 没有权限检查的接口（如管理自己的令牌、两步验证、会话和提权申请）需要用它禁止令牌访问
+func DenyAPIKey(c *fiber.Ctx) error {
+	if identity := CurrentIdentity(c); identity != nil && identity.Method == AuthMethodAPIKey {
+		return fiber.NewError(fiber.StatusForbidden, "访问令牌不能访问该接口")
+	}
+	return c.Next()
+}
 
-		// 获取用户信息
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return c.Status(401).JSON(fiber.Map{"error": "无效的token格式"})
-		}
+// HasPermission 权限检查中间件
+func HasPermission(permissionCode string, permissionsFunc func(c *fiber.Ctx) *PermissionSet) fiber.Handler {
+	return requirePermissions([]string{permissionCode}, false, permissionsFunc)
+}
 
-		userID := uint(claims["user_id"].(float64))
-		var user models.User
-		if err := db.Preload("Role.Permissions").First(&user, userID).Error; err != nil {
-			// 对于页面请求，重定向到登录页
-			if c.Method() == "GET" && !strings.HasPrefix(c.Path(), "/api/") {
-				return c.Redirect("/login")
-			}
-			return c.Status(401).JSON(fiber.Map{"error": "用户不存在"})
-		}
+// HasAnyPermission 权限检查中间件，拥有任意一个权限即可访问
+func HasAnyPermission(permissionCodes []string, permissionsFunc func(c *fiber.Ctx) *PermissionSet) fiber.Handler {
+	return requirePermissions(permissionCodes, true, permissionsFunc)
+}
 
-		// 将用户信息存储到上下文
-		c.Locals("user", user)
+// HasAllPermissions 权限检查中间件，必须拥有全部权限才能访问
+func HasAllPermissions(permissionCodes []string, permissionsFunc func(c *fiber.Ctx) *PermissionSet) fiber.Handler {
+	return requirePermissions(permissionCodes, false, permissionsFunc)
+}
 
-		// 继续处理请求
-		return c.Next()
+// requirePermissions 检查用户权限和访问令牌的授权范围，anyOf 为 true 时满足任意一个即可
+func requirePermissions(permissionCodes []string, anyOf bool, permissionsFunc func(c *fiber.Ctx) *PermissionSet) fiber.Handler {
+	for _, code := range permissionCodes {
+		recordPermission(code)
 	}
-}
 
-// HasPermission 权限检查中间件
-func HasPermission(permissionCode string, userFunc func(c *fiber.Ctx) *models.User) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		if userFunc == nil || userFunc(c) == nil {
+		var permissions *PermissionSet
+		if permissionsFunc != nil {
+			permissions = permissionsFunc(c)
+		}
+		if permissions == nil {
 			return errors.New("请先登录")
 		}
-		currentUser := userFunc(c)
 
-		// 检查用户权限
-		hasPermission := false
-		for _, perm := range currentUser.Role.Permissions {
-			if perm.Code == permissionCode {
-				hasPermission = true
+		// 最终权限为用户权限与访问令牌授权范围的交集
+		identity := CurrentIdentity(c)
+		allowed := func(code string) bool {
+			return permissions.Has(code) && (identity == nil || identity.AllowsPermission(code))
+		}
+
+		ok := !anyOf
+		for _, code := range permissionCodes {
+			if anyOf && allowed(code) {
+				ok = true
+				break
+			}
+			if !anyOf && !allowed(code) {
+				ok = false
 				break
 			}
 		}
-
-		if !hasPermission {
-			return fiber.NewError(fiber.StatusForbidden, "没有权限")
+		if ok {
+			return c.Next()
 		}
 
-		return c.Next()
+		// 用户拥有权限但访问令牌没有授权时，返回更明确的错误
+		if anyOf && permissions.Any(permissionCodes...) || !anyOf && permissions.All(permissionCodes...) {
+			return fiber.NewError(fiber.StatusForbidden, "访问令牌未授权该权限")
+		}
+		return fiber.NewError(fiber.StatusForbidden, "没有权限")
 	}
 }
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PermissionWildcard 通配符，作为权限编码的一段时匹配任意一段，作为最后一段时匹配剩余的所有段
+const PermissionWildcard = "*"
+
+// MatchPermission 判断权限编码是否匹配模式，编码按 ":" 分段。
+// 例如 "citask:*" 匹配 "citask:list" 和 "citask:log:view"，"note:*:create" 匹配 "note:category:create"，"*" 匹配所有编码
+func MatchPermission(pattern, code string) bool {
+	if pattern == code {
+		return true
+	}
+	if !strings.Contains(pattern, PermissionWildcard) || code == "" {
+		return false
+	}
+
+	patternParts := strings.Split(pattern, ":")
+	codeParts := strings.Split(code, ":")
+	for i, part := range patternParts {
+		if i >= len(codeParts) {
+			return false
+		}
+		if part == PermissionWildcard {
+			if i == len(patternParts)-1 {
+				return true
+			}
+			continue
+		}
+		if part != codeParts[i] {
+			return false
+		}
+	}
+	return len(patternParts) == len(codeParts)
+}
+
+// ValidatePermissionPattern 校验权限编码或模式，每一段不能为空，通配符只能单独作为一段
+func ValidatePermissionPattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("权限编码不能为空")
+	}
+	for _, part := range strings.Split(pattern, ":") {
+		if part == "" {
+			return fmt.Errorf("权限编码 %q 包含空的分段", pattern)
+		}
+		if part != PermissionWildcard && strings.Contains(part, PermissionWildcard) {
+			return fmt.Errorf("权限编码 %q 的通配符必须单独作为一段", pattern)
+		}
+	}
+	return nil
+}
+
+// PermissionSet 用户的权限集合，由角色授予的权限（可以包含通配符）和角色的禁止列表组成，禁止优先
+type PermissionSet struct {
+	granted  map[string]struct{}
+	patterns []string // 授予的通配符模式
+	denied   []string // 禁止的编码或通配符模式
+}
+
+// NewPermissionSet 根据授予和禁止的权限编码创建权限集合
+func NewPermissionSet(granted, denied []string) *PermissionSet {
+	s := &PermissionSet{
+		granted: make(map[string]struct{}, len(granted)),
+		denied:  denied,
+	}
+	for _, code := range granted {
+		s.granted[code] = struct{}{}
+		if strings.Contains(code, PermissionWildcard) {
+			s.patterns = append(s.patterns, code)
+		}
+	}
+	return s
+}
+
+// Has 是否拥有指定权限
+func (s *PermissionSet) Has(code string) bool {
+	if s == nil || code == "" {
+		return false
+	}
+
+	if s.IsDenied(code) {
+		return false
+	}
+
+	if _, ok := s.granted[code]; ok {
+		return true
+	}
+	for _, pattern := range s.patterns {
+		if MatchPermission(pattern, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDenied 权限是否被禁止列表排除
+func (s *PermissionSet) IsDenied(code string) bool {
+	if s == nil {
+		return false
+	}
+	for _, pattern := range s.denied {
+		if MatchPermission(pattern, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// Any 是否拥有任意一个权限，codes 为空时返回 true
+func (s *PermissionSet) Any(codes ...string) bool {
+	if len(codes) == 0 {
+		return true
+	}
+	for _, code := range codes {
+		if s.Has(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// All 是否拥有全部权限，codes 为空时返回 true
+func (s *PermissionSet) All(codes ...string) bool {
+	for _, code := range codes {
+		if !s.Has(code) {
+			return false
+		}
+	}
+	return true
+}
+
+// Codes 返回授予的权限编码列表，包含通配符模式，按编码排序
+func (s *PermissionSet) Codes() []string {
+	if s == nil {
+		return nil
+	}
+	codes := make([]string, 0, len(s.granted))
+	for code := range s.granted {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// Denied 返回禁止的权限编码列表
+func (s *PermissionSet) Denied() []string {
+	if s == nil {
+		return nil
+	}
+	return s.denied
+}
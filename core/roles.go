@@ -0,0 +1,151 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"gorm.io/gorm"
+)
+
+// UserRoleIDs 获取用户直接分配的角色ID
+func UserRoleIDs(db *gorm.DB, userID uint) ([]uint, error) {
+	var ids []uint
+	if err := db.Model(&models.UserRole{}).Where("user_id = ?", userID).Order("role_id asc").Pluck("role_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ExpandRoles 展开角色及其继承的所有角色，返回的角色已加载权限。
+// 按继承层级排列，直接分配的角色在前，继承关系中出现环时每个角色只返回一次
+func ExpandRoles(db *gorm.DB, roleIDs []uint) ([]models.Role, error) {
+	seen := make(map[uint]bool)
+	var result []models.Role
+
+	pending := roleIDs
+	for len(pending) > 0 {
+		ids := make([]uint, 0, len(pending))
+		for _, id := range pending {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		var roles []models.Role
+		if err := db.Preload("Permissions").Where("id IN ?", ids).Order("id asc").Find(&roles).Error; err != nil {
+			return nil, err
+		}
+		result = append(result, roles...)
+
+		var parents []models.RoleParent
+		if err := db.Where("role_id IN ?", ids).Find(&parents).Error; err != nil {
+			return nil, err
+		}
+		pending = make([]uint, 0, len(parents))
+		for _, p := range parents {
+			pending = append(pending, p.ParentID)
+		}
+	}
+
+	return result, nil
+}
+
+// EffectiveRoles 获取用户直接分配和继承的所有角色
+func EffectiveRoles(db *gorm.DB, userID uint) ([]models.Role, error) {
+	ids, err := UserRoleIDs(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return ExpandRoles(db, ids)
+}
+
+// PermissionGrantor 在角色之外为用户临时授予权限，例如临时提权
+type PermissionGrantor interface {
+	// Grants 返回用户当前额外拥有的权限编码，以及其中最早的失效时间，没有失效时间时返回零值
+	Grants(userID uint) ([]string, time.Time, error)
+}
+
+var grantors []PermissionGrantor
+
+// RegisterPermissionGrantor 注册临时权限的来源，在模块 Awake 中调用
+func RegisterPermissionGrantor(grantor PermissionGrantor) {
+	grantors = append(grantors, grantor)
+}
+
+// ExtraGrants 汇总所有来源临时授予用户的权限，返回最早的失效时间
+func ExtraGrants(userID uint) ([]string, time.Time, error) {
+	var codes []string
+	var until time.Time
+	for _, grantor := range grantors {
+		granted, expiresAt, err := grantor.Grants(userID)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		codes = append(codes, granted...)
+		if !expiresAt.IsZero() && (until.IsZero() || expiresAt.Before(until)) {
+			until = expiresAt
+		}
+	}
+	return codes, until, nil
+}
+
+// NewRolePermissionSet 合并多个角色授予和禁止的权限，任意角色的禁止列表对所有角色生效。
+// extra 为临时授予的权限，同样受禁止列表限制
+func NewRolePermissionSet(roles []models.Role, extra ...string) *PermissionSet {
+	granted := append([]string(nil), extra...)
+	var denied []string
+	for _, role := range roles {
+		for _, perm := range role.Permissions {
+			granted = append(granted, perm.Code)
+		}
+		denied = append(denied, role.DeniedPermissions...)
+	}
+	return NewPermissionSet(granted, denied)
+}
+
+// GrantedPermissions 返回权限表中权限集合拥有的权限，通配符按权限表展开
+func GrantedPermissions(db *gorm.DB, set *PermissionSet) ([]models.Permission, error) {
+	var all []models.Permission
+	if err := db.Order("code asc").Find(&all).Error; err != nil {
+		return nil, err
+	}
+
+	granted := make([]models.Permission, 0, len(all))
+	for _, perm := range all {
+		if set.Has(perm.Code) {
+			granted = append(granted, perm)
+		}
+	}
+	return granted, nil
+}
+
+// CheckRoleParents 校验父角色存在且不会形成继承环
+func CheckRoleParents(db *gorm.DB, roleID uint, parentIDs []uint) error {
+	if len(parentIDs) == 0 {
+		return nil
+	}
+
+	ancestors, err := ExpandRoles(db, parentIDs)
+	if err != nil {
+		return err
+	}
+
+	found := make(map[uint]bool, len(ancestors))
+	for _, role := range ancestors {
+		if roleID != 0 && role.ID == roleID {
+			return fmt.Errorf("不能继承角色 %s，会形成循环继承", role.Name)
+		}
+		found[role.ID] = true
+	}
+	for _, id := range parentIDs {
+		if !found[id] {
+			return fmt.Errorf("父角色不存在: %d", id)
+		}
+	}
+	return nil
+}
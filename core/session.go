@@ -1,19 +1,20 @@
 package core
 
 import (
-	"database/sql"
+	"errors"
+	"log"
 	"time"
 
-	"github.com/glebarez/sqlite"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/session"
 	"github.com/gofiber/storage/memory"
-	"github.com/gofiber/storage/mysql/v2"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
-	store *session.Store
+	store   *session.Store
+	storage fiber.Storage
 )
 
 const (
@@ -21,11 +22,14 @@ const (
 	userIDKey   = "user_id"
 )
 
-// FiberSession Fiber默认的会话表结构
+// sessionGCInterval 清理过期会话的间隔
+const sessionGCInterval = 10 * time.Second
+
+// FiberSession 会话表结构，与 Fiber 官方存储的表结构保持一致
 type FiberSession struct {
-	K string `gorm:"column:k;primaryKey"` // key
-	V string `gorm:"column:v;not null"`   // value
-	E int64  `gorm:"column:e;default:0"`  // expiry
+	K string `gorm:"column:k;primaryKey;size:64"` // key
+	V []byte `gorm:"column:v;not null"`           // value，gob 编码的会话数据
+	E int64  `gorm:"column:e;default:0;index"`    // expiry，Unix 时间戳，0 表示不过期
 }
 
 // TableName 设置表名
@@ -33,53 +37,70 @@ func (FiberSession) TableName() string {
 	return "sessions"
 }
 
-// SQLiteStorage 实现 fiber.Storage 接口
-type SQLiteStorage struct {
-	db *gorm.DB
+// GormStorage 基于应用数据库连接实现 fiber.Storage 接口，支持 sqlite、mysql 和 postgres
+type GormStorage struct {
+	db    *gorm.DB
+	table string
+	done  chan struct{}
 }
 
-// NewSQLiteStorage 创建新的SQLite存储
-func NewSQLiteStorage(dsn string) (*SQLiteStorage, error) {
-	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, err
-	}
+// NewGormStorage 创建会话存储并启动过期会话清理，与应用共用数据库连接
+func NewGormStorage(db *gorm.DB, table string) (*GormStorage, error) {
+	s := &GormStorage{db: db, table: table, done: make(chan struct{})}
 
 	// 使用GORM的自动迁移来创建或更新表结构
-	err = db.AutoMigrate(&FiberSession{})
-	if err != nil {
+	if err := s.query().AutoMigrate(&FiberSession{}); err != nil {
 		return nil, err
 	}
 
-	// 启动定期清理过期会话的goroutine
-	storage := &SQLiteStorage{db: db}
-	go storage.gcLoop()
+	go s.gcLoop()
+
+	return s, nil
+}
 
-	return storage, nil
+// query 指向会话表的查询
+func (s *GormStorage) query() *gorm.DB {
+	return s.db.Table(s.table)
 }
 
-func (s *SQLiteStorage) gcLoop() {
-	ticker := time.NewTicker(10 * time.Second)
-	for range ticker.C {
-		now := time.Now().Unix()
-		s.db.Delete(&FiberSession{}, "e <= ? AND e != 0", now)
+func (s *GormStorage) gcLoop() {
+	ticker := time.NewTicker(sessionGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			now := time.Now().Unix()
+			if err := s.query().Where("e <= ? AND e != 0", now).Delete(&FiberSession{}).Error; err != nil {
+				log.Printf("清理过期会话数据失败: %v", err)
+			}
+		}
 	}
 }
 
-// Get 获取会话数据
-func (s *SQLiteStorage) Get(key string) ([]byte, error) {
+// Get 获取会话数据，会话不存在或已过期时返回 nil
+func (s *GormStorage) Get(key string) ([]byte, error) {
+	if key == "" {
+		return nil, nil
+	}
+
 	var session FiberSession
-	if err := s.db.First(&session, "k = ? AND (e > ? OR e = 0)", key, time.Now().Unix()).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	if err := s.query().Where("k = ? AND (e > ? OR e = 0)", key, time.Now().Unix()).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return []byte(session.V), nil
+	return session.V, nil
 }
 
-// Set 设置会话数据
-func (s *SQLiteStorage) Set(key string, val []byte, exp time.Duration) error {
+// Set 设置会话数据，exp 为 0 时不过期
+func (s *GormStorage) Set(key string, val []byte, exp time.Duration) error {
+	if key == "" || len(val) == 0 {
+		return nil
+	}
+
 	var expiry int64
 	if exp != 0 {
 		expiry = time.Now().Add(exp).Unix()
@@ -87,58 +108,49 @@ func (s *SQLiteStorage) Set(key string, val []byte, exp time.Duration) error {
 
 	session := FiberSession{
 		K: key,
-		V: string(val),
+		V: val,
 		E: expiry,
 	}
-
-	return s.db.Save(&session).Error
+	return s.query().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "k"}},
+		DoUpdates: clause.AssignmentColumns([]string{"v", "e"}),
+	}).Create(&session).Error
 }
 
 // Delete 删除会话数据
-func (s *SQLiteStorage) Delete(key string) error {
-	return s.db.Delete(&FiberSession{}, "k = ?", key).Error
+func (s *GormStorage) Delete(key string) error {
+	if key == "" {
+		return nil
+	}
+	return s.query().Where("k = ?", key).Delete(&FiberSession{}).Error
 }
 
 // Reset 重置存储
-func (s *SQLiteStorage) Reset() error {
-	return s.db.Where("1 = 1").Delete(&FiberSession{}).Error
+func (s *GormStorage) Reset() error {
+	return s.query().Where("1 = 1").Delete(&FiberSession{}).Error
 }
 
-// Close 关闭存储
-func (s *SQLiteStorage) Close() error {
-	sqlDB, err := s.db.DB()
-	if err != nil {
-		return err
-	}
-	return sqlDB.Close()
+// Close 停止过期会话清理，数据库连接由应用统一关闭
+func (s *GormStorage) Close() error {
+	close(s.done)
+	return nil
 }
 
-// SessionSetup 初始化session存储
-func SessionSetup(dbDriver string, db *sql.DB, dsn, tableName string) {
-	var storage fiber.Storage
-
-	// 根据数据库类型选择存储方式
-	switch dbDriver {
-	case "mysql":
-		if db != nil {
-			storage = mysql.New(mysql.Config{
-				Db:         db,
-				Table:      tableName,
-				Reset:      false,
-				GCInterval: 10 * time.Second,
-			})
-		}
-	case "sqlite":
-		sqliteStorage, err := NewSQLiteStorage(dsn)
-		if err == nil {
-			storage = sqliteStorage
+// SessionSetup 初始化session存储，使用应用的数据库连接，db 为空或建表失败时使用内存存储
+func SessionSetup(db *gorm.DB, tableName string) {
+	if db != nil {
+		gormStorage, err := NewGormStorage(db, tableName)
+		if err != nil {
+			log.Printf("创建会话存储失败，使用内存存储，重启后会话将失效: %v", err)
+		} else {
+			storage = gormStorage
 		}
 	}
 
 	// 如果没有成功创建数据库存储，则使用内存存储作为后备
 	if storage == nil {
 		storage = memory.New(memory.Config{
-			GCInterval: 10 * time.Second,
+			GCInterval: sessionGCInterval,
 		})
 	}
 
@@ -155,15 +167,28 @@ func SessionSetup(dbDriver string, db *sql.DB, dsn, tableName string) {
 	})
 }
 
-// StoreSession 存储用户认证信息
+// SessionClose 关闭session存储
+func SessionClose() error {
+	if storage == nil {
+		return nil
+	}
+	return storage.Close()
+}
+
+// StoreSession 存储用户认证信息，并记录会话索引用于查询和撤销
 func StoreSession(c *fiber.Ctx, userID uint) error {
 	sess, err := store.Get(c)
 	if err != nil {
 		return err
 	}
 
+	sessionID := sess.ID()
 	sess.Set(userIDKey, userID)
-	return sess.Save()
+	if err := sess.Save(); err != nil {
+		return err
+	}
+
+	return sessions.record(c, sessionID, userID, time.Now().Add(store.Expiration))
 }
 
 // GetSession 获取用户认证信息
@@ -178,27 +203,35 @@ func GetSession(c *fiber.Ctx) (bool, uint) {
 		return false, 0
 	}
 
-	// 转换为uint类型
-	if id, ok := userID.(uint); ok {
-		return true, id
+	// 转换为uint类型，处理可能存储为float64的情况
+	var id uint
+	switch v := userID.(type) {
+	case uint:
+		id = v
+	case float64:
+		id = uint(v)
+	default:
+		return false, 0
 	}
 
-	// 处理可能存储为float64的情况
-	if id, ok := userID.(float64); ok {
-		return true, uint(id)
-	}
+	// 更新会话的最近访问时间
+	sessions.touch(c, sess.ID(), id)
 
-	return false, 0
+	return true, id
 }
 
-// DestroySession 销毁用户认证信息
+// DestroySession 销毁用户认证信息，同时删除会话索引
 func DestroySession(c *fiber.Ctx) error {
 	sess, err := store.Get(c)
 	if err != nil {
 		return err
 	}
 
-	return sess.Destroy()
+	sessionID := sess.ID()
+	if err := sess.Destroy(); err != nil {
+		return err
+	}
+	return sessions.forget(sessionID)
 }
 
 // SetSessionExpiration 设置session过期时间
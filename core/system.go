@@ -0,0 +1,73 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// systemModule 核心系统接口的权限所属的模块名称
+const systemModule = "system"
+
+// systemPermissions 核心系统接口使用的权限，与模块声明的权限一起同步
+var systemPermissions = []PermissionDecl{
+	{Code: "system:module:list", Name: "模块状态", Description: "查看模块运行状态和启动错误"},
+	{Code: "system:config:reload", Name: "重新加载配置", Description: "重新加载配置文件"},
+}
+
+// AuditFunc 写入操作日志
+type AuditFunc func(c *fiber.Ctx, action, resource string, resourceID uint, details string) error
+
+var auditor AuditFunc
+
+// RegisterAuditor 注册核心系统接口写入操作日志的方法，由操作日志模块在 Awake 中调用
+func RegisterAuditor(fn AuditFunc) {
+	auditor = fn
+}
+
+// audit 写入操作日志，未注册时忽略
+func audit(c *fiber.Ctx, action, resource string, resourceID uint, details string) {
+	if auditor == nil {
+		return
+	}
+	if err := auditor(c, action, resource, resourceID, details); err != nil {
+		log.Printf("写入操作日志失败: %v", err)
+	}
+}
+
+// getModulesAction 获取模块状态列表
+func getModulesAction(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"msg":  "success",
+		"data": GetModuleStatuses(),
+	})
+}
+
+// reloadConfigAction 重新加载配置文件
+func reloadConfigAction(c *fiber.Ctx) error {
+	result, err := ReloadConfig()
+	if err != nil {
+		audit(c, "reload", "config", 0, fmt.Sprintf("重新加载配置失败：%v", err))
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	details := "重新加载配置"
+	if len(result.Changed) > 0 {
+		details += fmt.Sprintf("，已生效：%s", strings.Join(result.Changed, ", "))
+	}
+	if len(result.RequireRestart) > 0 {
+		details += fmt.Sprintf("，需要重启：%s", strings.Join(result.RequireRestart, ", "))
+	}
+	audit(c, "reload", "config", 0, details)
+
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"msg":  "success",
+		"data": result,
+	})
+}
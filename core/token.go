@@ -0,0 +1,302 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 默认的令牌有效期
+const (
+	defaultAccessTokenExpire   = 15 * time.Minute
+	defaultRefreshTokenExpire  = 7 * 24 * time.Hour
+	rememberRefreshTokenExpire = 30 * 24 * time.Hour
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("无效的刷新令牌")
+	ErrRefreshTokenExpired = errors.New("刷新令牌已过期")
+	ErrRefreshTokenReused  = errors.New("刷新令牌已被使用，该用户的所有令牌均已撤销")
+)
+
+// TokenPair 登录或刷新后签发的访问令牌和刷新令牌
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// TokenService 签发、轮换和撤销 JWT 令牌，撤销记录保存在数据库中，由 JWT 认证器检查
+type TokenService struct {
+	db *gorm.DB
+}
+
+var tokens = &TokenService{}
+
+// autoMigrate 令牌相关的数据迁移
+func (s *TokenService) autoMigrate() error {
+	return s.db.AutoMigrate(&models.RefreshToken{}, &models.TokenRevocation{})
+}
+
+// IssueTokens 为用户签发新的令牌对，remember 为 true 时刷新令牌有效期更长
+func (s *TokenService) IssueTokens(user *models.User, remember bool) (*TokenPair, error) {
+	refreshExpire := refreshTokenExpire()
+	if remember {
+		refreshExpire = rememberRefreshTokenExpire
+	}
+
+	refreshToken, hash, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	accessToken, jti, accessExpiresAt, err := signAccessToken(user, now)
+	if err != nil {
+		return nil, err
+	}
+
+	record := models.RefreshToken{
+		UserID:          user.ID,
+		TokenHash:       hash,
+		AccessJTI:       jti,
+		AccessExpiresAt: accessExpiresAt,
+		ExpiresAt:       now.Add(refreshExpire),
+		CreatedAt:       now,
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresAt:        accessExpiresAt,
+		RefreshExpiresAt: record.ExpiresAt,
+	}, nil
+}
+
+// RefreshTokens 使用刷新令牌换取新的令牌对，旧的刷新令牌和访问令牌同时失效。
+// 已轮换的刷新令牌再次使用时视为泄露，撤销该用户的所有令牌
+func (s *TokenService) RefreshTokens(refreshToken string) (*TokenPair, error) {
+	var record models.RefreshToken
+	if err := s.db.Where("token_hash = ?", hashToken(refreshToken)).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRefreshTokenInvalid
+		}
+		return nil, err
+	}
+
+	if record.RevokedAt != nil {
+		if record.ReplacedByID != 0 {
+			if err := s.RevokeUserTokens(record.UserID); err != nil {
+				log.Printf("撤销用户 %d 的令牌失败: %v", record.UserID, err)
+			}
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	now := time.Now()
+	if !now.Before(record.ExpiresAt) {
+		return nil, ErrRefreshTokenExpired
+	}
+
+	var user models.User
+	if err := s.db.First(&user, record.UserID).Error; err != nil {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if user.Status != 1 {
+		return nil, fmt.Errorf("用户已被禁用")
+	}
+
+	newToken, hash, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	accessToken, jti, accessExpiresAt, err := signAccessToken(&user, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// 新令牌沿用旧令牌的过期时间，登录会话不会因为刷新而无限延长
+	next := models.RefreshToken{
+		UserID:          user.ID,
+		TokenHash:       hash,
+		AccessJTI:       jti,
+		AccessExpiresAt: accessExpiresAt,
+		ExpiresAt:       record.ExpiresAt,
+		CreatedAt:       now,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&next).Error; err != nil {
+			return err
+		}
+
+		// 只有未被并发轮换时才能更新成功
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", record.ID).
+			Updates(map[string]interface{}{"revoked_at": now, "replaced_by_id": next.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenInvalid
+		}
+
+		return revokeAccessToken(tx, record.UserID, record.AccessJTI, record.AccessExpiresAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     newToken,
+		ExpiresAt:        accessExpiresAt,
+		RefreshExpiresAt: next.ExpiresAt,
+	}, nil
+}
+
+// RevokeUserTokens 撤销用户的所有刷新令牌和仍在有效期内的访问令牌
+func (s *TokenService) RevokeUserTokens(userID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var records []models.RefreshToken
+		if err := tx.Where("user_id = ? AND revoked_at IS NULL", userID).Find(&records).Error; err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			if err := revokeAccessToken(tx, userID, record.AccessJTI, record.AccessExpiresAt); err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// IsRevoked 访问令牌是否已撤销
+func (s *TokenService) IsRevoked(jti string) (bool, error) {
+	var count int64
+	if err := s.db.Model(&models.TokenRevocation{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// purgeExpired 清理已过期的刷新令牌和撤销记录
+func (s *TokenService) purgeExpired() {
+	now := time.Now()
+	if err := s.db.Where("expires_at < ?", now).Delete(&models.RefreshToken{}).Error; err != nil {
+		log.Printf("清理过期刷新令牌失败: %v", err)
+	}
+	if err := s.db.Where("expires_at < ?", now).Delete(&models.TokenRevocation{}).Error; err != nil {
+		log.Printf("清理过期撤销记录失败: %v", err)
+	}
+}
+
+// gcLoop 定期清理过期令牌，done 关闭时退出
+func (s *TokenService) gcLoop(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.purgeExpired()
+		case <-done:
+			return
+		}
+	}
+}
+
+// revokeAccessToken 将访问令牌加入撤销列表，已过期的令牌无需记录
+func revokeAccessToken(tx *gorm.DB, userID uint, jti string, expiresAt time.Time) error {
+	if jti == "" || !time.Now().Before(expiresAt) {
+		return nil
+	}
+
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.TokenRevocation{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}).Error
+}
+
+// signAccessToken 签发访问令牌，返回令牌、令牌ID和过期时间
+func signAccessToken(user *models.User, now time.Time) (string, string, time.Time, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	expiresAt := now.Add(accessTokenExpire())
+	claims := jwt.MapClaims{
+		"jti":      jti,
+		"sub":      user.ID,
+		"user_id":  user.ID,
+		"username": user.Username,
+		"exp":      expiresAt.Unix(),
+		"iat":      now.Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(GetConfig().Auth.JWTSecret))
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	return tokenString, jti, expiresAt, nil
+}
+
+// generateRefreshToken 生成刷新令牌，返回明文和哈希值
+func generateRefreshToken() (string, string, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, hashToken(token), nil
+}
+
+// hashToken 计算令牌的 SHA-256 哈希值
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func accessTokenExpire() time.Duration {
+	if expire := GetConfig().Auth.TokenExpire; expire > 0 {
+		return time.Duration(expire) * time.Second
+	}
+	return defaultAccessTokenExpire
+}
+
+func refreshTokenExpire() time.Duration {
+	if expire := GetConfig().Auth.RefreshTokenExpire; expire > 0 {
+		return time.Duration(expire) * time.Second
+	}
+	return defaultRefreshTokenExpire
+}
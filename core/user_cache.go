@@ -0,0 +1,166 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// currentUserKey 当前请求解析出的用户，保存在 c.Locals 中
+const currentUserKey = "current_user"
+
+// resolvedUser 解析后的用户、角色和权限集合，缓存中的对象只读
+type resolvedUser struct {
+	user        *models.User
+	roles       []models.Role // 直接分配和继承的所有角色
+	permissions *PermissionSet
+	expiresAt   time.Time
+}
+
+// userCache 跨请求的用户缓存，角色、权限或用户变更时由对应模块失效
+type userCache struct {
+	mu         sync.RWMutex
+	entries    map[uint]*resolvedUser
+	generation uint64 // 每次失效时递增，避免失效前读取的旧数据在失效后写入缓存
+}
+
+var users = &userCache{entries: make(map[uint]*resolvedUser)}
+
+// get 返回缓存的条目和当前的失效代数
+func (uc *userCache) get(userID uint) (*resolvedUser, uint64) {
+	uc.mu.RLock()
+	defer uc.mu.RUnlock()
+
+	entry, ok := uc.entries[userID]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, uc.generation
+	}
+	return entry, uc.generation
+}
+
+// put 写入缓存，读取数据期间发生过失效时放弃写入
+func (uc *userCache) put(userID uint, entry *resolvedUser, generation uint64) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if generation != uc.generation {
+		return
+	}
+
+	// 顺便清理过期的条目，缓存大小不超过活跃用户数
+	now := time.Now()
+	for id, e := range uc.entries {
+		if now.After(e.expiresAt) {
+			delete(uc.entries, id)
+		}
+	}
+	uc.entries[userID] = entry
+}
+
+func (uc *userCache) invalidate(userIDs ...uint) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	uc.generation++
+	if len(userIDs) == 0 {
+		uc.entries = make(map[uint]*resolvedUser)
+		return
+	}
+	for _, id := range userIDs {
+		delete(uc.entries, id)
+	}
+}
+
+// userCacheTTL 跨请求缓存的有效期，0 表示只在单个请求内缓存
+func userCacheTTL() time.Duration {
+	return time.Duration(GetConfig().Auth.UserCacheTTL) * time.Second
+}
+
+// resolveUser 解析当前请求的用户，依次使用请求内缓存、跨请求缓存和数据库，用户已禁用时返回 nil
+func (a *App) resolveUser(c *fiber.Ctx) *resolvedUser {
+	identity := CurrentIdentity(c)
+	if identity == nil {
+		return nil
+	}
+
+	if entry, ok := c.Locals(currentUserKey).(*resolvedUser); ok && entry.user.ID == identity.UserID {
+		return entry
+	}
+
+	ttl := userCacheTTL()
+	entry, generation := users.get(identity.UserID)
+	if entry == nil || ttl <= 0 {
+		var user models.User
+		if err := a.DB.Preload("Roles").First(&user, identity.UserID).Error; err != nil {
+			return nil
+		}
+		// 缓存中不保留密码哈希
+		user.Password = ""
+
+		roles, err := EffectiveRoles(a.DB, user.ID)
+		if err != nil {
+			return nil
+		}
+		extra, until, err := ExtraGrants(user.ID)
+		if err != nil {
+			return nil
+		}
+
+		// 临时权限失效时缓存同时失效
+		expiresAt := time.Now().Add(ttl)
+		if !until.IsZero() && until.Before(expiresAt) {
+			expiresAt = until
+		}
+
+		entry = &resolvedUser{
+			user:        &user,
+			roles:       roles,
+			permissions: NewRolePermissionSet(roles, extra...),
+			expiresAt:   expiresAt,
+		}
+		if ttl > 0 {
+			users.put(user.ID, entry, generation)
+		}
+	}
+
+	// 已禁用的用户无论使用哪种认证方式都视为未登录
+	if entry.user.Status != 1 {
+		return nil
+	}
+
+	c.Locals(currentUserKey, entry)
+	return entry
+}
+
+// CurrentPermissions 获取当前用户的权限集合，未登录时返回 nil
+func (a *App) CurrentPermissions(c *fiber.Ctx) *PermissionSet {
+	entry := a.resolveUser(c)
+	if entry == nil {
+		return nil
+	}
+	return entry.permissions
+}
+
+// CurrentRoles 获取当前用户直接分配和继承的所有角色，未登录时返回 nil
+func (a *App) CurrentRoles(c *fiber.Ctx) []models.Role {
+	entry := a.resolveUser(c)
+	if entry == nil {
+		return nil
+	}
+	return entry.roles
+}
+
+// InvalidateUser 使指定用户的缓存失效，用户信息或角色变更后调用
+func (a *App) InvalidateUser(userIDs ...uint) {
+	if len(userIDs) == 0 {
+		return
+	}
+	users.invalidate(userIDs...)
+}
+
+// InvalidateAllUsers 使所有用户的缓存失效，角色或权限变更后调用
+func (a *App) InvalidateAllUsers() {
+	users.invalidate()
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sessionTouchInterval 会话最近访问时间的更新间隔，避免每个请求都写数据库
+const sessionTouchInterval = time.Minute
+
+// SessionService 维护登录会话的索引，支持按用户查询和撤销会话。
+// 会话数据仍由会话存储管理，撤销时同时删除存储中的会话
+type SessionService struct {
+	db *gorm.DB
+
+	mu      sync.Mutex
+	touched map[string]time.Time // 会话ID -> 最近一次写入访问时间的时间
+}
+
+var sessions = &SessionService{touched: make(map[string]time.Time)}
+
+// autoMigrate 会话索引的数据迁移
+func (s *SessionService) autoMigrate() error {
+	return s.db.AutoMigrate(&models.UserSession{})
+}
+
+// record 登录时记录会话，同一会话再次登录时覆盖原有记录
+func (s *SessionService) record(c *fiber.Ctx, sessionID string, userID uint, expiresAt time.Time) error {
+	var user models.User
+	if err := s.db.Select("id", "username").First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	session := models.UserSession{
+		SessionID:  sessionID,
+		UserID:     userID,
+		Username:   user.Username,
+		IP:         c.IP(),
+		UserAgent:  truncate(c.Get(fiber.HeaderUserAgent), 255),
+		LastSeenAt: now,
+		ExpiresAt:  expiresAt,
+	}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "session_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "username", "ip", "user_agent", "last_seen_at", "expires_at"}),
+	}).Create(&session).Error
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.touched[sessionID] = now
+	s.mu.Unlock()
+	return nil
+}
+
+// touch 更新会话的最近访问时间和来源，距上次更新超过间隔才写入。
+// 没有索引的会话（例如升级前创建的会话）在首次访问时补录
+func (s *SessionService) touch(c *fiber.Ctx, sessionID string, userID uint) {
+	now := time.Now()
+	s.mu.Lock()
+	if last, ok := s.touched[sessionID]; ok && now.Sub(last) < sessionTouchInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.touched[sessionID] = now
+	s.mu.Unlock()
+
+	result := s.db.Model(&models.UserSession{}).
+		Where("session_id = ? AND user_id = ?", sessionID, userID).
+		Updates(map[string]interface{}{
+			"ip":           c.IP(),
+			"user_agent":   truncate(c.Get(fiber.HeaderUserAgent), 255),
+			"last_seen_at": now,
+		})
+	if result.Error != nil {
+		log.Printf("更新会话访问时间失败: %v", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		if err := s.record(c, sessionID, userID, now.Add(store.Expiration)); err != nil {
+			log.Printf("记录会话失败: %v", err)
+		}
+	}
+}
+
+// forget 删除会话索引，会话已从存储中删除时调用
+func (s *SessionService) forget(sessionIDs ...string) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	for _, id := range sessionIDs {
+		delete(s.touched, id)
+	}
+	s.mu.Unlock()
+
+	return s.db.Where("session_id IN ?", sessionIDs).Delete(&models.UserSession{}).Error
+}
+
+// revoke 从会话存储中删除会话并删除索引
+func (s *SessionService) revoke(list []models.UserSession) error {
+	ids := make([]string, 0, len(list))
+	for _, session := range list {
+		if err := store.Delete(session.SessionID); err != nil {
+			return err
+		}
+		ids = append(ids, session.SessionID)
+	}
+	return s.forget(ids...)
+}
+
+// UserSessions 获取用户未过期的会话，最近访问的在前
+func (s *SessionService) UserSessions(userID uint) ([]models.UserSession, error) {
+	var list []models.UserSession
+	if err := s.db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Revoke 撤销单个会话，会话在下一次请求时失效，返回被撤销的会话
+func (s *SessionService) Revoke(id uint) (*models.UserSession, error) {
+	var session models.UserSession
+	if err := s.db.First(&session, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.revoke([]models.UserSession{session}); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RevokeUserSessions 撤销用户的所有会话，exceptSessionID 不为空时保留该会话，返回撤销的数量
+func (s *SessionService) RevokeUserSessions(userID uint, exceptSessionID string) (int, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if exceptSessionID != "" {
+		query = query.Where("session_id <> ?", exceptSessionID)
+	}
+
+	var list []models.UserSession
+	if err := query.Find(&list).Error; err != nil {
+		return 0, err
+	}
+	if err := s.revoke(list); err != nil {
+		return 0, err
+	}
+	return len(list), nil
+}
+
+// purgeExpired 清理已过期的会话索引
+func (s *SessionService) purgeExpired() {
+	now := time.Now()
+	if err := s.db.Where("expires_at < ?", now).Delete(&models.UserSession{}).Error; err != nil {
+		log.Printf("清理过期会话失败: %v", err)
+	}
+
+	s.mu.Lock()
+	for id, last := range s.touched {
+		if now.Sub(last) >= sessionTouchInterval {
+			delete(s.touched, id)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// gcLoop 定期清理过期会话索引，done 关闭时退出
+func (s *SessionService) gcLoop(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.purgeExpired()
+		case <-done:
+			return
+		}
+	}
+}
+
+// CurrentSessionID 当前请求使用的会话ID，不是通过会话认证时返回空字符串
+func CurrentSessionID(c *fiber.Ctx) string {
+	identity := CurrentIdentity(c)
+	if identity == nil || identity.Method != AuthMethodSession {
+		return ""
+	}
+	return c.Cookies(sessionName)
+}
+
+// truncate 截断过长的字符串，避免超出字段长度
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
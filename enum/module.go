@@ -1,19 +1,22 @@
 package enum
 
-// 定义模块优先级
+// 定义模块名称，用于声明模块及其依赖关系
 const (
-	ModulePriorityUser       = 1000
-	ModulePriorityRole       = 999
-	ModulePriorityPermission = 998
-	ModulePriorityLogin      = 900
-	ModulePriorityMenu       = 800
-	ModulePriorityAdminlog   = 700
-	ModulePriorityStats      = 600
-	ModulePriorityGamelog    = 500
-	ModulePriorityServerconf = 400
-	ModulePriorityShell      = 300
-	ModulePriorityBrowse     = 200
-	ModulePriorityCitask     = 100
-	ModulePriorityNote       = 50
-	ModulePriorityUnibuild   = 40
+	ModuleUser       = "user"
+	ModuleRole       = "role"
+	ModulePermission = "permission"
+	ModuleLogin      = "login"
+	ModuleMenu       = "menu"
+	ModuleAdminlog   = "adminlog"
+	ModuleStats      = "stats"
+	ModuleGamelog    = "gamelog"
+	ModuleServerconf = "serverconf"
+	ModuleShell      = "shell"
+	ModuleBrowse     = "browse"
+	ModuleCitask     = "citask"
+	ModuleNote       = "note"
+	ModuleUnibuild   = "unibuild"
+	ModuleAPIKey     = "apikey"
+	ModuleElevation  = "elevation"
+	ModuleACL        = "acl"
 )
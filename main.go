@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/andycai/unitool/core"
 	"github.com/andycai/unitool/lib/database"
@@ -96,8 +100,39 @@ func main() {
 	})
 
 	app := core.NewApp()
-	app.Start([]*gorm.DB{db}, fiberApp)
+	if err := app.Start([]*gorm.DB{db}, fiberApp); err != nil {
+		log.Fatalf("应用启动失败: %v", err)
+	}
 
 	// 启动服务器
-	fiberApp.Listen(fmt.Sprintf("%s:%d", app.Config.Server.Host, app.Config.Server.Port))
+	go func() {
+		if err := fiberApp.Listen(fmt.Sprintf("%s:%d", app.Config().Server.Host, app.Config().Server.Port)); err != nil {
+			log.Fatalf("服务器启动失败: %v", err)
+		}
+	}()
+
+	// 等待退出信号
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+	log.Printf("收到信号 %v，开始关闭服务器", sig)
+
+	// 先结束事件流等长连接并停止接收新请求，再按逆序停止模块。
+	// 两个阶段分别计时，HTTP服务关闭得慢时模块仍有完整的时间停止
+	timeout := time.Duration(app.Config().Server.ShutdownTimeout) * time.Second
+	app.BeginShutdown()
+
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), timeout)
+	if err := fiberApp.ShutdownWithContext(httpCtx); err != nil {
+		log.Printf("关闭HTTP服务失败: %v", err)
+	}
+	cancelHTTP()
+
+	stopCtx, cancelStop := context.WithTimeout(context.Background(), timeout)
+	if err := app.Stop(stopCtx); err != nil {
+		log.Printf("关闭模块失败: %v", err)
+	}
+	cancelStop()
+
+	log.Println("服务器已关闭")
 }
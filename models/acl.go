@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// 资源授权的资源类型
+const (
+	ACLResourceTask = "citask_task" // 构建任务，资源标识为任务ID
+	ACLResourcePath = "browse_path" // 文件浏览路径前缀，相对于浏览根目录，空字符串表示整个根目录
+)
+
+// 资源授权的授权对象类型
+const (
+	ACLSubjectRole = "role" // 角色，包括继承该角色的角色
+	ACLSubjectUser = "user" // 用户
+)
+
+// ResourceACL 资源授权，资源存在授权条目时只有被授权的角色或用户可以访问，
+// 没有授权条目的资源仍按模块权限开放
+type ResourceACL struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ResourceType string    `json:"resource_type" gorm:"size:20;not null;uniqueIndex:idx_resource_acl"` // 资源类型
+	Resource     string    `json:"resource" gorm:"size:255;not null;uniqueIndex:idx_resource_acl"`     // 资源标识：任务ID或路径前缀
+	SubjectType  string    `json:"subject_type" gorm:"size:10;not null;uniqueIndex:idx_resource_acl"`  // 授权对象类型
+	SubjectID    uint      `json:"subject_id" gorm:"not null;uniqueIndex:idx_resource_acl"`            // 角色ID或用户ID
+	CreatedBy    string    `json:"created_by" gorm:"size:50"`                                          // 创建人
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
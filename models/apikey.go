@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// APIKey 用户的个人访问令牌，只保存令牌的哈希值
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"index"`                    // 所属用户ID
+	Name       string     `json:"name" gorm:"size:100;not null"`           // 令牌名称
+	Prefix     string     `json:"prefix" gorm:"size:20"`                   // 令牌前缀，用于识别令牌
+	KeyHash    string     `json:"-" gorm:"size:64;uniqueIndex;not null"`   // 令牌的 SHA-256 哈希值
+	Scopes     []string   `json:"scopes" gorm:"type:text;serializer:json"` // 授权的权限编码
+	ExpiresAt  *time.Time `json:"expires_at"`                              // 过期时间，为空表示永不过期
+	LastUsedAt *time.Time `json:"last_used_at"`                            // 最后使用时间
+	LastUsedIP string     `json:"last_used_ip" gorm:"size:64"`             // 最后使用IP
+	RevokedAt  *time.Time `json:"revoked_at"`                              // 撤销时间，为空表示未撤销
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// IsExpired 令牌是否已过期
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
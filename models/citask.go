@@ -6,34 +6,61 @@ import (
 
 // Task 任务表
 type Task struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	Name        string    `json:"name" gorm:"size:100;not null"`                 // 任务名称
-	Description string    `json:"description" gorm:"type:text"`                  // 任务描述
-	Type        string    `json:"type" gorm:"size:20;not null;default:'script'"` // 任务类型：script(脚本), http(远程调用)
-	Script      string    `json:"script" gorm:"type:text"`                       // 脚本内容
-	URL         string    `json:"url" gorm:"size:255"`                           // HTTP URL
-	Method      string    `json:"method" gorm:"size:10;default:'GET'"`           // HTTP 方法
-	Headers     string    `json:"headers" gorm:"type:text"`                      // HTTP 请求头
-	Body        string    `json:"body" gorm:"type:text"`                         // HTTP 请求体
-	Timeout     int       `json:"timeout" gorm:"default:300"`                    // 超时时间(秒)
-	Status      string    `json:"status" gorm:"size:20;default:'active'"`        // 状态：active, inactive
-	EnableCron  uint8     `json:"enable_cron" gorm:"type:tinyint;default:0"`     // 是否启用定时执行：0-否，1-是
-	CronExpr    string    `json:"cron_expr"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID                 uint        `json:"id" gorm:"primaryKey"`
+	Name               string      `json:"name" gorm:"size:100;not null"`                 // 任务名称
+	Description        string      `json:"description" gorm:"type:text"`                  // 任务描述
+	Type               string      `json:"type" gorm:"size:20;not null;default:'script'"` // 任务类型：script(脚本), http(远程调用)
+	Script             string      `json:"script" gorm:"type:text"`                       // 脚本内容
+	URL                string      `json:"url" gorm:"size:255"`                           // HTTP URL
+	Method             string      `json:"method" gorm:"size:10;default:'GET'"`           // HTTP 方法
+	Headers            string      `json:"headers" gorm:"type:text"`                      // HTTP 请求头
+	Body               string      `json:"body" gorm:"type:text"`                         // HTTP 请求体
+	Timeout            int         `json:"timeout" gorm:"default:300"`                    // 超时时间(秒)
+	Status             string      `json:"status" gorm:"size:20;default:'active'"`        // 状态：active, inactive
+	EnableCron         uint8       `json:"enable_cron" gorm:"type:tinyint;default:0"`     // 是否启用定时执行：0-否，1-是
+	CronExpr           string      `json:"cron_expr"`
+	MaxConcurrent      int         `json:"max_concurrent" gorm:"default:0"`                   // 同时运行的最大数量，0 表示使用全局默认值
+	Priority           int         `json:"priority" gorm:"default:0"`                         // 排队时的默认优先级，越大越先执行
+	RequeueInterrupted uint8       `json:"requeue_interrupted" gorm:"type:tinyint;default:0"` // 运行被中断时是否自动重新排队：0-否，1-是
+	Params             []TaskParam `json:"params" gorm:"type:text;serializer:json"`           // 参数定义
+	CreatedAt          time.Time   `json:"created_at"`
+	UpdatedAt          time.Time   `json:"updated_at"`
+}
+
+// TaskParam 任务参数定义，执行时作为环境变量传给脚本，或作为模板变量用于HTTP请求
+type TaskParam struct {
+	Name     string   `json:"name"`              // 参数名，只能包含字母、数字和下划线
+	Label    string   `json:"label"`             // 显示名称
+	Type     string   `json:"type"`              // 类型：string, enum, bool, number, secret
+	Default  string   `json:"default"`           // 默认值，secret 类型不能设置
+	Required bool     `json:"required"`          // 是否必填
+	Options  []string `json:"options,omitempty"` // enum 类型的可选值
+	Pattern  string   `json:"pattern,omitempty"` // string 和 secret 类型需要匹配的正则表达式
+	Min      *float64 `json:"min,omitempty"`     // number 类型的最小值
+	Max      *float64 `json:"max,omitempty"`     // number 类型的最大值
 }
 
 // TaskLog 任务执行日志表
 type TaskLog struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	TaskID    uint      `json:"task_id" gorm:"index"`                    // 任务ID
-	Task      Task      `json:"task" gorm:"foreignKey:TaskID"`           // 任务关联
-	Status    string    `json:"status" gorm:"size:20;default:'pending'"` // 执行状态：success, failed, running
-	Output    string    `json:"output" gorm:"type:text"`                 // 执行输出
-	Error     string    `json:"error" gorm:"type:text"`                  // 错误信息
-	StartTime time.Time `json:"start_time"`                              // 开始时间
-	EndTime   time.Time `json:"end_time"`                                // 结束时间
-	Duration  int       `json:"duration"`                                // 执行时长(秒)
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         uint              `json:"id" gorm:"primaryKey"`
+	TaskID     uint              `json:"task_id" gorm:"index"`                    // 任务ID
+	Task       Task              `json:"task" gorm:"foreignKey:TaskID"`           // 任务关联
+	Status     string            `json:"status" gorm:"size:20;default:'pending'"` // 执行状态：queued, running, success, failed, cancelled, interrupted
+	Priority   int               `json:"priority" gorm:"default:0"`               // 优先级，越大越先执行
+	Sequence   int64             `json:"sequence" gorm:"index"`                   // 同优先级内的排队顺序，越小越先执行
+	Source     string            `json:"source" gorm:"size:20"`                   // 触发来源：manual, cron, requeue
+	Operator   string            `json:"operator" gorm:"size:50"`                 // 手动执行的用户
+	QueuedAt   time.Time         `json:"queued_at"`                               // 进入队列时间
+	Attempt    int               `json:"attempt"`                                 // 第几次尝试，中断后重新排队时递增
+	RetryOf    uint              `json:"retry_of"`                                // 被中断后重新排队时，原运行的ID
+	Params     map[string]string `json:"params" gorm:"type:text;serializer:json"` // 本次运行的参数值，secret 参数已隐藏
+	Secrets    map[string]string `json:"-" gorm:"-"`                              // secret 参数的值，只保存在内存中
+	Output     string            `json:"output" gorm:"type:text"`                 // 执行输出的末尾，完整输出保存在日志文件中
+	OutputSize int64             `json:"output_size"`                             // 执行输出的总字节数
+	Error      string            `json:"error" gorm:"type:text"`                  // 错误信息
+	StartTime  time.Time         `json:"start_time"`                              // 开始时间
+	EndTime    time.Time         `json:"end_time"`                                // 结束时间
+	Duration   int               `json:"duration"`                                // 执行时长(秒)
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
 }
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// 临时提权申请状态
+const (
+	ElevationPending   = "pending"   // 待审批
+	ElevationApproved  = "approved"  // 已批准，有效期内生效
+	ElevationRejected  = "rejected"  // 已拒绝
+	ElevationExpired   = "expired"   // 已到期
+	ElevationRevoked   = "revoked"   // 生效期间被审批人撤销
+	ElevationCancelled = "cancelled" // 申请人取消或提前结束
+)
+
+// Elevation 临时提权申请，批准后在有效期内为用户额外授予权限
+type Elevation struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"index"`                         // 申请人ID
+	Username     string     `json:"username" gorm:"size:50"`                      // 申请人用户名
+	Permissions  []string   `json:"permissions" gorm:"type:text;serializer:json"` // 申请的权限编码
+	Reason       string     `json:"reason" gorm:"size:500"`                       // 申请理由
+	Duration     int        `json:"duration"`                                     // 有效时长（分钟），批准时开始计时
+	Status       string     `json:"status" gorm:"size:20;index"`                  // 状态
+	ApproverID   uint       `json:"approver_id"`                                  // 审批人ID
+	ApproverName string     `json:"approver_name" gorm:"size:50"`                 // 审批人用户名
+	ReviewNote   string     `json:"review_note" gorm:"size:500"`                  // 审批意见
+	ReviewedAt   *time.Time `json:"reviewed_at"`                                  // 审批时间
+	ExpiresAt    *time.Time `json:"expires_at" gorm:"index"`                      // 到期时间，批准后设置
+	EndedAt      *time.Time `json:"ended_at"`                                     // 实际结束时间，到期、撤销或提前结束时设置
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// IsActive 是否在有效期内
+func (e *Elevation) IsActive(now time.Time) bool {
+	return e.Status == ElevationApproved && e.ExpiresAt != nil && now.Before(*e.ExpiresAt)
+}
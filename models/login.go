@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// 登录失败计数的类型
+const (
+	LoginAttemptUsername = "username"
+	LoginAttemptIP       = "ip"
+)
+
+// LoginAttempt 登录失败计数，按用户名和IP分别统计，超过阈值后临时锁定
+type LoginAttempt struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Kind         string     `json:"kind" gorm:"size:20;uniqueIndex:idx_login_attempt_key"`   // 计数类型：username, ip
+	Value        string     `json:"value" gorm:"size:100;uniqueIndex:idx_login_attempt_key"` // 用户名或IP
+	Failures     int        `json:"failures"`                                                // 连续失败次数
+	LastFailedAt time.Time  `json:"last_failed_at"`                                          // 最后失败时间
+	LockedUntil  *time.Time `json:"locked_until"`                                            // 锁定截止时间，为空表示未锁定
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
@@ -14,6 +14,8 @@ type Menu struct {
 	Sort       int       `gorm:"default:0" json:"sort"`         // 排序
 	Permission string    `gorm:"size:100" json:"permission"`    // 绑定的权限
 	IsShow     bool      `gorm:"default:true" json:"is_show"`   // 是否显示
+	Module     string    `gorm:"size:50;index" json:"module"`   // 声明该菜单的模块，为空表示手动创建
+	Orphaned   bool      `gorm:"default:false" json:"orphaned"` // 声明该菜单的模块已不再声明它
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 }
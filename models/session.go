@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// UserSession 登录会话的索引，会话数据仍保存在会话存储中，按用户查询和撤销会话时使用
+type UserSession struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	SessionID  string    `json:"-" gorm:"size:64;uniqueIndex;not null"` // 会话存储中的键，不对外暴露
+	UserID     uint      `json:"user_id" gorm:"index"`                  // 所属用户ID
+	Username   string    `json:"username" gorm:"size:50"`               // 用户名
+	IP         string    `json:"ip" gorm:"size:64"`                     // 最近访问的IP
+	UserAgent  string    `json:"user_agent" gorm:"size:255"`            // 最近访问的浏览器标识
+	LastSeenAt time.Time `json:"last_seen_at"`                          // 最近访问时间，按间隔更新
+	ExpiresAt  time.Time `json:"expires_at" gorm:"index"`               // 会话过期时间
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// RefreshToken 刷新令牌，只保存令牌的哈希值，每次刷新后轮换为新令牌
+type RefreshToken struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	UserID          uint       `json:"user_id" gorm:"index"`                  // 所属用户ID
+	TokenHash       string     `json:"-" gorm:"size:64;uniqueIndex;not null"` // 令牌的 SHA-256 哈希值
+	AccessJTI       string     `json:"access_jti" gorm:"size:64"`             // 最近一次签发的访问令牌ID
+	AccessExpiresAt time.Time  `json:"access_expires_at"`                     // 最近一次签发的访问令牌过期时间
+	ReplacedByID    uint       `json:"replaced_by_id"`                        // 轮换后的新令牌ID
+	ExpiresAt       time.Time  `json:"expires_at" gorm:"index"`               // 过期时间
+	RevokedAt       *time.Time `json:"revoked_at"`                            // 撤销时间，为空表示未撤销
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// TokenRevocation 已撤销的访问令牌，访问令牌过期后即可清理
+type TokenRevocation struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	JTI       string    `json:"jti" gorm:"size:64;uniqueIndex;not null"` // 访问令牌ID
+	UserID    uint      `json:"user_id" gorm:"index"`                    // 所属用户ID
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`                 // 访问令牌过期时间
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RecoveryCode 两步验证的恢复码，只保存哈希值，每个恢复码只能使用一次
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index"`            // 所属用户ID
+	CodeHash  string     `json:"-" gorm:"size:64;not null;index"` // 恢复码的 SHA-256 哈希值
+	UsedAt    *time.Time `json:"used_at"`                         // 使用时间，为空表示未使用
+	CreatedAt time.Time  `json:"created_at"`
+}
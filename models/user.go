@@ -10,31 +10,41 @@ type User struct {
 	Username      string    `json:"username" gorm:"uniqueIndex;size:50"`
 	Password      string    `json:"-" gorm:"size:100"` // 密码不返回给前端
 	Nickname      string    `json:"nickname" gorm:"size:50"`
-	RoleID        uint      `json:"role_id"`
-	Role          Role      `json:"role" gorm:"foreignKey:RoleID"`
-	Status        int       `json:"status" gorm:"default:1"` // 1:启用 0:禁用
+	RoleID        uint      `json:"-"`                                  // 已废弃，启动时迁移到 user_roles 后清零
+	Roles         []Role    `json:"roles" gorm:"many2many:user_roles;"` // 直接分配的角色
+	Status        int       `json:"status" gorm:"default:1"`            // 1:启用 0:禁用
 	LastLogin     time.Time `json:"last_login"`
-	HasChangedPwd bool      `json:"has_changed_pwd" gorm:"default:false"` // 是否已修改初始密码
+	HasChangedPwd bool      `json:"has_changed_pwd" gorm:"default:false"`                // 是否已修改初始密码
+	TOTPEnabled   bool      `json:"totp_enabled" gorm:"default:false"`                   // 是否已启用两步验证
+	TOTPSecret    string    `json:"-" gorm:"size:64"`                                    // 两步验证密钥，base32 编码
+	TOTPCounter   int64     `json:"-"`                                                   // 最后一次使用的 TOTP 步数，防止重放
+	Provider      string    `json:"provider" gorm:"size:50;index:idx_user_provider"`     // 外部身份源名称，为空表示本地账号
+	ExternalID    string    `json:"external_id" gorm:"size:255;index:idx_user_provider"` // 外部身份源中的唯一标识
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 // Role 角色表
 type Role struct {
-	ID          uint         `json:"id" gorm:"primaryKey"`
-	Name        string       `json:"name" gorm:"uniqueIndex;size:50"`
-	Description string       `json:"description"`
-	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions;"`
-	CreatedAt   time.Time    `json:"created_at"`
-	UpdatedAt   time.Time    `json:"updated_at"`
+	ID                uint         `json:"id" gorm:"primaryKey"`
+	Name              string       `json:"name" gorm:"uniqueIndex;size:50"`
+	Description       string       `json:"description"`
+	Permissions       []Permission `json:"permissions" gorm:"many2many:role_permissions;"`
+	Parents           []Role       `json:"parents" gorm:"many2many:role_parents;joinForeignKey:RoleID;joinReferences:ParentID"` // 继承的角色
+	RequireTOTP       bool         `json:"require_totp" gorm:"default:false"`                                                   // 该角色的用户是否必须启用两步验证
+	DeniedPermissions []string     `json:"denied_permissions" gorm:"type:text;serializer:json"`                                 // 禁止的权限编码，支持通配符，优先于授予的权限
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
 }
 
 // Permission 权限表
 type Permission struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
 	Name        string    `json:"name" gorm:"uniqueIndex;size:50"`
-	Code        string    `json:"code" gorm:"uniqueIndex;size:50"` // 权限编码
+	Code        string    `json:"code" gorm:"uniqueIndex;size:50"` // 权限编码，按 ":" 分段，"*" 匹配任意分段
 	Description string    `json:"description"`
+	Module      string    `json:"module" gorm:"size:50;index"`   // 声明该权限的模块，为空表示手动创建
+	Orphaned    bool      `json:"orphaned" gorm:"default:false"` // 声明该权限的模块已不再声明它
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -45,6 +55,18 @@ type RolePermission struct {
 	PermissionID uint `gorm:"primaryKey"`
 }
 
+// UserRole 用户-角色关联表
+type UserRole struct {
+	UserID uint `gorm:"primaryKey"`
+	RoleID uint `gorm:"primaryKey"`
+}
+
+// RoleParent 角色继承关联表，角色拥有父角色的全部权限和禁止列表
+type RoleParent struct {
+	RoleID   uint `gorm:"primaryKey"`
+	ParentID uint `gorm:"primaryKey"`
+}
+
 // ModuleInit 模块是否初始化的数据库表
 type ModuleInit struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
@@ -0,0 +1,254 @@
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/adminlog"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type CreateACLRequest struct {
+	ResourceType string `json:"resource_type"` // 资源类型：citask_task, browse_path
+	Resource     string `json:"resource"`      // 任务ID或路径前缀
+	SubjectType  string `json:"subject_type"`  // 授权对象类型：role, user
+	SubjectID    uint   `json:"subject_id"`    // 角色ID或用户ID
+}
+
+// ACLVO 授权条目，附带资源和授权对象的名称，对象已删除时名称为空
+type ACLVO struct {
+	models.ResourceACL
+	ResourceName string `json:"resource_name"`
+	SubjectName  string `json:"subject_name"`
+}
+
+// getACLsAction 获取授权列表
+func getACLsAction(c *fiber.Ctx) error {
+	var total int64
+
+	page := c.QueryInt("page", 1)
+	pageSize := c.QueryInt("pageSize", 20)
+	resourceType := c.Query("resource_type")
+	resource := c.Query("resource")
+
+	query := app.DB.Model(&models.ResourceACL{})
+	if resourceType != "" {
+		query = query.Where("resource_type = ?", resourceType)
+	}
+	if resource != "" {
+		query = query.Where("resource LIKE ?", "%"+resource+"%")
+	}
+
+	query.Count(&total)
+
+	var list []models.ResourceACL
+	if err := query.Order("resource_type asc, resource asc, id asc").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&list).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取授权列表失败"})
+	}
+
+	return c.JSON(fiber.Map{
+		"total": total,
+		"data":  describeACLs(list),
+	})
+}
+
+// describeACLs 补充任务、角色和用户的名称
+func describeACLs(list []models.ResourceACL) []ACLVO {
+	var taskIDs, roleIDs, userIDs []uint
+	for _, entry := range list {
+		if entry.ResourceType == models.ACLResourceTask {
+			if id, err := strconv.ParseUint(entry.Resource, 10, 32); err == nil {
+				taskIDs = append(taskIDs, uint(id))
+			}
+		}
+		if entry.SubjectType == models.ACLSubjectRole {
+			roleIDs = append(roleIDs, entry.SubjectID)
+		} else {
+			userIDs = append(userIDs, entry.SubjectID)
+		}
+	}
+
+	taskNames := make(map[string]string)
+	if len(taskIDs) > 0 {
+		var tasks []models.Task
+		app.DB.Select("id", "name").Where("id IN ?", taskIDs).Find(&tasks)
+		for _, task := range tasks {
+			taskNames[strconv.FormatUint(uint64(task.ID), 10)] = task.Name
+		}
+	}
+	roleNames := make(map[uint]string)
+	if len(roleIDs) > 0 {
+		var roles []models.Role
+		app.DB.Select("id", "name").Where("id IN ?", roleIDs).Find(&roles)
+		for _, role := range roles {
+			roleNames[role.ID] = role.Name
+		}
+	}
+	userNames := make(map[uint]string)
+	if len(userIDs) > 0 {
+		var users []models.User
+		app.DB.Select("id", "username").Where("id IN ?", userIDs).Find(&users)
+		for _, user := range users {
+			userNames[user.ID] = user.Username
+		}
+	}
+
+	result := make([]ACLVO, 0, len(list))
+	for _, entry := range list {
+		vo := ACLVO{ResourceACL: entry}
+		if entry.ResourceType == models.ACLResourceTask {
+			vo.ResourceName = taskNames[entry.Resource]
+		} else {
+			vo.ResourceName = "/" + entry.Resource
+		}
+		if entry.SubjectType == models.ACLSubjectRole {
+			vo.SubjectName = roleNames[entry.SubjectID]
+		} else {
+			vo.SubjectName = userNames[entry.SubjectID]
+		}
+		result = append(result, vo)
+	}
+	return result
+}
+
+// getOptionsAction 获取创建授权时可选的任务、角色和用户
+func getOptionsAction(c *fiber.Ctx) error {
+	var tasks []models.Task
+	if err := app.DB.Select("id", "name").Order("id asc").Find(&tasks).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取任务列表失败"})
+	}
+	var roles []models.Role
+	if err := app.DB.Select("id", "name").Order("id asc").Find(&roles).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取角色列表失败"})
+	}
+	var users []models.User
+	if err := app.DB.Select("id", "username").Order("id asc").Find(&users).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取用户列表失败"})
+	}
+
+	taskOptions := make([]fiber.Map, 0, len(tasks))
+	for _, task := range tasks {
+		taskOptions = append(taskOptions, fiber.Map{"id": task.ID, "name": task.Name})
+	}
+	roleOptions := make([]fiber.Map, 0, len(roles))
+	for _, role := range roles {
+		roleOptions = append(roleOptions, fiber.Map{"id": role.ID, "name": role.Name})
+	}
+	userOptions := make([]fiber.Map, 0, len(users))
+	for _, user := range users {
+		userOptions = append(userOptions, fiber.Map{"id": user.ID, "name": user.Username})
+	}
+
+	return c.JSON(fiber.Map{
+		"tasks": taskOptions,
+		"roles": roleOptions,
+		"users": userOptions,
+	})
+}
+
+// createACLAction 创建授权
+func createACLAction(c *fiber.Ctx) error {
+	var req CreateACLRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
+	}
+
+	entry := models.ResourceACL{
+		ResourceType: req.ResourceType,
+		SubjectType:  req.SubjectType,
+		SubjectID:    req.SubjectID,
+	}
+
+	switch req.ResourceType {
+	case models.ACLResourceTask:
+		id, err := strconv.ParseUint(strings.TrimSpace(req.Resource), 10, 32)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "无效的任务ID"})
+		}
+		if err := app.DB.Select("id").First(&models.Task{}, id).Error; err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "任务不存在"})
+		}
+		entry.Resource = strconv.FormatUint(id, 10)
+	case models.ACLResourcePath:
+		entry.Resource = NormalizePath(req.Resource)
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "无效的资源类型"})
+	}
+
+	switch req.SubjectType {
+	case models.ACLSubjectRole:
+		if err := app.DB.Select("id").First(&models.Role{}, req.SubjectID).Error; err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "角色不存在"})
+		}
+	case models.ACLSubjectUser:
+		if err := app.DB.Select("id").First(&models.User{}, req.SubjectID).Error; err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "用户不存在"})
+		}
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "无效的授权对象类型"})
+	}
+
+	err := app.DB.Where(&models.ResourceACL{
+		ResourceType: entry.ResourceType,
+		Resource:     entry.Resource,
+		SubjectType:  entry.SubjectType,
+		SubjectID:    entry.SubjectID,
+	}).First(&models.ResourceACL{}).Error
+	if err == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "授权已存在"})
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(500).JSON(fiber.Map{"error": "创建授权失败"})
+	}
+
+	if user := app.CurrentUser(c); user != nil {
+		entry.CreatedBy = user.Username
+	}
+	if err := app.DB.Create(&entry).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "创建授权失败"})
+	}
+
+	// 记录操作日志
+	vo := describeACLs([]models.ResourceACL{entry})[0]
+	adminlog.CreateAdminLog(c, "create", "acl", entry.ID, describe(&vo))
+
+	return c.JSON(vo)
+}
+
+// deleteACLAction 删除授权
+func deleteACLAction(c *fiber.Ctx) error {
+	var entry models.ResourceACL
+	if err := app.DB.First(&entry, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "授权不存在"})
+	}
+
+	if err := app.DB.Delete(&entry).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "删除授权失败"})
+	}
+
+	// 记录操作日志
+	vo := describeACLs([]models.ResourceACL{entry})[0]
+	adminlog.CreateAdminLog(c, "delete", "acl", entry.ID, "删除"+describe(&vo))
+
+	return c.JSON(fiber.Map{"message": "删除成功"})
+}
+
+// describe 授权条目的描述，用于操作日志
+func describe(vo *ACLVO) string {
+	resource := "路径 /" + vo.Resource
+	if vo.ResourceType == models.ACLResourceTask {
+		resource = fmt.Sprintf("任务 %s(#%s)", vo.ResourceName, vo.Resource)
+	}
+	subject := "角色 "
+	if vo.SubjectType == models.ACLSubjectUser {
+		subject = "用户 "
+	}
+	return fmt.Sprintf("授权%s%s 访问%s", subject, vo.SubjectName, resource)
+}
@@ -0,0 +1,52 @@
+package acl
+
+import (
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/enum"
+	"github.com/gofiber/fiber/v2"
+)
+
+var app *core.App
+
+type aclModule struct {
+	core.BaseModule
+}
+
+func init() {
+	core.RegisterModule(&aclModule{}, core.ModuleInfo{
+		Name:    enum.ModuleACL,
+		Depends: []string{enum.ModuleUser, enum.ModuleRole, enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "acl:list", Name: "资源授权查看", Description: "查看构建任务和文件路径的授权"},
+			{Code: "acl:manage", Name: "资源授权管理", Description: "管理资源授权，并可访问所有受限资源"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin", Name: "资源授权", Path: "/admin/acl", Icon: "acl", Sort: 9, Permission: "acl:list"},
+		},
+	})
+}
+
+func (m *aclModule) Awake(a *core.App) error {
+	app = a
+	return autoMigrate()
+}
+
+func (m *aclModule) AddAuthRouters() error {
+	// admin
+	app.RouterAdmin.Get("/acl", app.HasPermission("acl:list"), func(c *fiber.Ctx) error {
+		return c.Render("admin/acl", fiber.Map{
+			"Title": "资源授权",
+			"Scripts": []string{
+				"/static/js/admin/acl.js",
+			},
+		}, "admin/layout")
+	})
+
+	// api
+	app.RouterApi.Get("/acl", app.HasPermission("acl:list"), getACLsAction)
+	app.RouterApi.Get("/acl/options", app.HasPermission("acl:list"), getOptionsAction)
+	app.RouterApi.Post("/acl", app.HasPermission("acl:manage"), createACLAction)
+	app.RouterApi.Delete("/acl/:id", app.HasPermission("acl:manage"), deleteACLAction)
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package acl
+
+import (
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Checker 检查当前请求对受限资源的访问，资源的授权条目按类型在首次使用时加载
+type Checker struct {
+	bypass  bool
+	userID  uint
+	roleIDs map[uint]bool
+	entries map[string][]models.ResourceACL
+}
+
+// For 创建当前请求的访问检查，拥有 acl:manage 权限的用户可以访问所有资源
+func For(c *fiber.Ctx) *Checker {
+	ch := &Checker{
+		roleIDs: make(map[uint]bool),
+		entries: make(map[string][]models.ResourceACL),
+	}
+
+	identity := core.CurrentIdentity(c)
+	if identity == nil {
+		return ch
+	}
+	ch.userID = identity.UserID
+
+	if permissions := app.CurrentPermissions(c); permissions != nil {
+		ch.bypass = permissions.Has("acl:manage") && identity.AllowsPermission("acl:manage")
+	}
+	for _, role := range app.CurrentRoles(c) {
+		ch.roleIDs[role.ID] = true
+	}
+	return ch
+}
+
+// load 加载某类资源的所有授权条目，查询失败时返回 false，调用方应拒绝访问
+func (ch *Checker) load(resourceType string) ([]models.ResourceACL, bool) {
+	if list, ok := ch.entries[resourceType]; ok {
+		return list, true
+	}
+
+	var list []models.ResourceACL
+	if err := app.DB.Where("resource_type = ?", resourceType).Find(&list).Error; err != nil {
+		log.Printf("加载资源授权失败: %v", err)
+		return nil, false
+	}
+	ch.entries[resourceType] = list
+	return list, true
+}
+
+// matches 授权条目是否授予当前用户
+func (ch *Checker) matches(entry *models.ResourceACL) bool {
+	switch entry.SubjectType {
+	case models.ACLSubjectUser:
+		return entry.SubjectID == ch.userID
+	case models.ACLSubjectRole:
+		return ch.roleIDs[entry.SubjectID]
+	}
+	return false
+}
+
+// CanAccessTask 是否可以访问构建任务，任务没有授权条目时不受限制
+func (ch *Checker) CanAccessTask(taskID uint) bool {
+	if ch.bypass {
+		return true
+	}
+	list, ok := ch.load(models.ACLResourceTask)
+	if !ok {
+		return false
+	}
+
+	key := strconv.FormatUint(uint64(taskID), 10)
+	restricted := false
+	for i := range list {
+		if list[i].Resource != key {
+			continue
+		}
+		if ch.matches(&list[i]) {
+			return true
+		}
+		restricted = true
+	}
+	return !restricted
+}
+
+// CanAccessPath 是否可以访问浏览根目录下的路径。
+// 路径被某个授权前缀覆盖时，只有被该前缀或其它覆盖该路径的前缀授权的用户可以访问
+func (ch *Checker) CanAccessPath(relPath string) bool {
+	if ch.bypass {
+		return true
+	}
+	list, ok := ch.load(models.ACLResourcePath)
+	if !ok {
+		return false
+	}
+
+	relPath = NormalizePath(relPath)
+	restricted := false
+	for i := range list {
+		if !coversPath(list[i].Resource, relPath) {
+			continue
+		}
+		if ch.matches(&list[i]) {
+			return true
+		}
+		restricted = true
+	}
+	return !restricted
+}
+
+// CanBrowsePath 是否可以进入目录。除了可以访问的目录，
+// 受限目录中包含授权给当前用户的子路径时也可以进入，但只能看到授权的内容
+func (ch *Checker) CanBrowsePath(relPath string) bool {
+	if ch.CanAccessPath(relPath) {
+		return true
+	}
+	list, ok := ch.load(models.ACLResourcePath)
+	if !ok {
+		return false
+	}
+
+	relPath = NormalizePath(relPath)
+	for i := range list {
+		if coversPath(relPath, list[i].Resource) && ch.matches(&list[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizePath 规范化浏览路径：使用正斜杠，去掉首尾的斜杠和 ..，根目录为空字符串
+func NormalizePath(p string) string {
+	p = path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+	return strings.TrimPrefix(p, "/")
+}
+
+// coversPath 路径前缀 prefix 是否覆盖 p，两者都已规范化
+func coversPath(prefix, p string) bool {
+	return prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// DeleteResource 删除资源的所有授权条目，在资源删除后调用
+func DeleteResource(resourceType, resource string) {
+	if err := app.DB.Where("resource_type = ? AND resource = ?", resourceType, resource).
+		Delete(&models.ResourceACL{}).Error; err != nil {
+		log.Printf("删除资源 %s:%s 的授权失败: %v", resourceType, resource, err)
+	}
+}
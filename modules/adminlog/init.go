@@ -14,11 +14,24 @@ type adminlogModule struct {
 }
 
 func init() {
-	core.RegisterModule(&adminlogModule{}, enum.ModulePriorityAdminlog)
+	core.RegisterModule(&adminlogModule{}, core.ModuleInfo{
+		Name: enum.ModuleAdminlog,
+		Permissions: []core.PermissionDecl{
+			{Code: "adminlog:list", Name: "日志列表", Description: "查看操作日志"},
+			{Code: "adminlog:delete", Name: "删除日志", Description: "删除操作日志"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin", Name: "操作日志", Path: "/admin/adminlog", Icon: "adminlog", Sort: 5, Permission: "adminlog:list"},
+		},
+	})
 }
 
 func (m *adminlogModule) Awake(a *core.App) error {
 	app = a
+
+	// 核心系统接口的操作也写入操作日志
+	core.RegisterAuditor(CreateAdminLog)
+
 	return app.DB.AutoMigrate(&models.AdminLog{})
 }
 
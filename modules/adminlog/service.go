@@ -11,13 +11,18 @@ import (
 func CreateAdminLog(c *fiber.Ctx, action string, resource string, resourceID uint, details string) error {
 	currentUser := app.CurrentUser(c)
 
-	if currentUser.ID == 0 {
+	if currentUser == nil || currentUser.ID == 0 {
 		return fmt.Errorf("登录已过期，请重新登录")
 	}
 
+	return CreateAdminLogAs(c, currentUser.ID, currentUser.Username, action, resource, resourceID, details)
+}
+
+// CreateAdminLogAs 以指定用户创建操作日志，用于登录失败等尚未认证的请求，userID 未知时为 0
+func CreateAdminLogAs(c *fiber.Ctx, userID uint, username string, action string, resource string, resourceID uint, details string) error {
 	log := models.AdminLog{
-		UserID:     currentUser.ID,
-		Username:   currentUser.Username,
+		UserID:     userID,
+		Username:   username,
 		Action:     action,
 		Resource:   resource,
 		ResourceID: resourceID,
@@ -33,3 +38,17 @@ func CreateAdminLog(c *fiber.Ctx, action string, resource string, resourceID uin
 
 	return nil
 }
+
+// CreateSystemAdminLog 创建系统操作日志，用于定时任务等没有请求上下文的操作
+func CreateSystemAdminLog(action string, resource string, resourceID uint, details string) error {
+	log := models.AdminLog{
+		Username:   "system",
+		Action:     action,
+		Resource:   resource,
+		ResourceID: resourceID,
+		Details:    details,
+		CreatedAt:  app.DB.NowFunc(),
+	}
+
+	return app.DB.Create(&log).Error
+}
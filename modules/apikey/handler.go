@@ -0,0 +1,214 @@
+package apikey
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/adminlog"
+	"github.com/gofiber/fiber/v2"
+)
+
+// 令牌最长有效天数
+const maxExpiresDays = 365
+
+type CreateAPIKeyRequest struct {
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`       // 授权的权限编码，必须是当前用户拥有的权限
+	ExpiresDays int      `json:"expires_days"` // 有效天数，0 表示永不过期
+}
+
+// APIKeyVO 管理员查看的令牌信息，附带所属用户名
+type APIKeyVO struct {
+	models.APIKey
+	Username string `json:"username"`
+}
+
+// getAPIKeysAction 获取当前用户的令牌列表
+func getAPIKeysAction(c *fiber.Ctx) error {
+	identity := core.CurrentIdentity(c)
+
+	var keys []models.APIKey
+	if err := app.DB.Where("user_id = ?", identity.UserID).Order("created_at desc").Find(&keys).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取令牌列表失败"})
+	}
+	return c.JSON(keys)
+}
+
+// getScopesAction 获取当前用户可授权给令牌的权限
+func getScopesAction(c *fiber.Ctx) error {
+	permissions := app.CurrentPermissions(c)
+	if permissions == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "请先登录"})
+	}
+
+	granted, err := core.GrantedPermissions(app.DB, permissions)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取权限列表失败"})
+	}
+	return c.JSON(granted)
+}
+
+// createAPIKeyAction 创建令牌，明文只在创建时返回一次
+func createAPIKeyAction(c *fiber.Ctx) error {
+	var req CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
+	}
+	if req.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "令牌名称不能为空"})
+	}
+	if len(req.Scopes) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "请至少选择一个权限"})
+	}
+	if req.ExpiresDays < 0 || req.ExpiresDays > maxExpiresDays {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("有效天数必须在 0 到 %d 之间", maxExpiresDays)})
+	}
+
+	// 不允许使用令牌创建新的令牌，避免令牌绕过授权范围
+	identity := core.CurrentIdentity(c)
+	if identity.Method == core.AuthMethodAPIKey {
+		return c.Status(403).JSON(fiber.Map{"error": "不能使用访问令牌创建令牌"})
+	}
+
+	currentUser := app.CurrentUser(c)
+	if currentUser == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "请先登录"})
+	}
+
+	// 授权范围必须是当前用户权限的子集
+	owned := app.CurrentPermissions(c)
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !owned.Has(scope) {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("没有权限：%s", scope)})
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	key, hash, err := generateKey()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "生成令牌失败"})
+	}
+
+	now := time.Now()
+	apiKey := models.APIKey{
+		UserID:    currentUser.ID,
+		Name:      req.Name,
+		Prefix:    key[:len(keyPrefix)+6],
+		KeyHash:   hash,
+		Scopes:    scopes,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if req.ExpiresDays > 0 {
+		expiresAt := now.AddDate(0, 0, req.ExpiresDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	if err := app.DB.Create(&apiKey).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "创建令牌失败"})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "create", "apikey", apiKey.ID, fmt.Sprintf("创建访问令牌：%s，权限：%v", apiKey.Name, apiKey.Scopes))
+
+	return c.JSON(fiber.Map{
+		"code":    0,
+		"message": "创建成功，请妥善保存令牌，关闭后将无法再次查看",
+		"data": fiber.Map{
+			"key":     key,
+			"api_key": apiKey,
+		},
+	})
+}
+
+// revokeAPIKeyAction 撤销当前用户的令牌
+func revokeAPIKeyAction(c *fiber.Ctx) error {
+	identity := core.CurrentIdentity(c)
+
+	var apiKey models.APIKey
+	if err := app.DB.Where("user_id = ?", identity.UserID).First(&apiKey, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "令牌不存在"})
+	}
+
+	return revokeAPIKey(c, &apiKey)
+}
+
+// deleteAPIKeyAction 删除当前用户的令牌
+func deleteAPIKeyAction(c *fiber.Ctx) error {
+	id := c.Params("id")
+	identity := core.CurrentIdentity(c)
+
+	var apiKey models.APIKey
+	if err := app.DB.Where("user_id = ?", identity.UserID).First(&apiKey, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "令牌不存在"})
+	}
+
+	if err := app.DB.Delete(&apiKey).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "删除令牌失败"})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "delete", "apikey", apiKey.ID, fmt.Sprintf("删除访问令牌：%s", apiKey.Name))
+
+	return c.JSON(fiber.Map{"message": "删除成功"})
+}
+
+// getAllAPIKeysAction 管理员获取所有用户的令牌列表
+func getAllAPIKeysAction(c *fiber.Ctx) error {
+	var keys []models.APIKey
+	if err := app.DB.Order("created_at desc").Find(&keys).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取令牌列表失败"})
+	}
+
+	userIDs := make([]uint, 0, len(keys))
+	for _, key := range keys {
+		userIDs = append(userIDs, key.UserID)
+	}
+	var users []models.User
+	if err := app.DB.Select("id", "username").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取令牌列表失败"})
+	}
+	usernames := make(map[uint]string, len(users))
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+
+	list := make([]APIKeyVO, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, APIKeyVO{APIKey: key, Username: usernames[key.UserID]})
+	}
+	return c.JSON(list)
+}
+
+// adminRevokeAPIKeyAction 管理员撤销任意用户的令牌
+func adminRevokeAPIKeyAction(c *fiber.Ctx) error {
+	var apiKey models.APIKey
+	if err := app.DB.First(&apiKey, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "令牌不存在"})
+	}
+
+	return revokeAPIKey(c, &apiKey)
+}
+
+// revokeAPIKey 撤销令牌，撤销后立即失效，记录保留用于审计
+func revokeAPIKey(c *fiber.Ctx, apiKey *models.APIKey) error {
+	if apiKey.RevokedAt != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "令牌已撤销"})
+	}
+
+	now := time.Now()
+	if err := app.DB.Model(apiKey).Updates(map[string]interface{}{"revoked_at": now, "updated_at": now}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "撤销令牌失败"})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "revoke", "apikey", apiKey.ID, fmt.Sprintf("撤销访问令牌：%s", apiKey.Name))
+
+	return c.JSON(fiber.Map{"message": "撤销成功"})
+}
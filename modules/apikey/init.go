@@ -0,0 +1,64 @@
+package apikey
+
+import (
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/enum"
+	"github.com/gofiber/fiber/v2"
+)
+
+var app *core.App
+
+type apikeyModule struct {
+	core.BaseModule
+}
+
+func init() {
+	core.RegisterModule(&apikeyModule{}, core.ModuleInfo{
+		Name:    enum.ModuleAPIKey,
+		Depends: []string{enum.ModuleUser, enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "apikey:list", Name: "令牌列表", Description: "查看所有用户的访问令牌"},
+			{Code: "apikey:revoke", Name: "撤销令牌", Description: "撤销任意用户的访问令牌"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin", Name: "访问令牌", Path: "/admin/apikeys", Icon: "apikey", Sort: 6},
+		},
+	})
+}
+
+func (m *apikeyModule) Awake(a *core.App) error {
+	app = a
+	if err := autoMigrate(); err != nil {
+		return err
+	}
+
+	// 加入认证链，位于 session 和 JWT 之后
+	core.RegisterAuthenticator(&apiKeyAuthenticator{})
+
+	return nil
+}
+
+func (m *apikeyModule) AddAuthRouters() error {
+	// admin，所有登录用户都可以管理自己的令牌
+	app.RouterAdmin.Get("/apikeys", func(c *fiber.Ctx) error {
+		return c.Render("admin/apikeys", fiber.Map{
+			"Title": "访问令牌",
+			"Scripts": []string{
+				"/static/js/admin/apikeys.js",
+			},
+		}, "admin/layout")
+	})
+
+	// api，管理自己的令牌，不允许使用访问令牌操作
+	app.RouterApi.Get("/apikeys", core.DenyAPIKey, getAPIKeysAction)
+	app.RouterApi.Get("/apikeys/scopes", core.DenyAPIKey, getScopesAction)
+	app.RouterApi.Post("/apikeys", core.DenyAPIKey, createAPIKeyAction)
+	app.RouterApi.Post("/apikeys/:id/revoke", core.DenyAPIKey, revokeAPIKeyAction)
+	app.RouterApi.Delete("/apikeys/:id", core.DenyAPIKey, deleteAPIKeyAction)
+
+	// api，管理所有用户的令牌
+	app.RouterApi.Get("/apikeys/all", app.HasPermission("apikey:list"), getAllAPIKeysAction)
+	app.RouterApi.Post("/apikeys/all/:id/revoke", app.HasPermission("apikey:revoke"), adminRevokeAPIKeyAction)
+
+	return nil
+}
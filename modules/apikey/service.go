@@ -0,0 +1,109 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/adminlog"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// 密钥前缀，便于识别和扫描泄露的密钥
+const keyPrefix = "unt_"
+
+// generateKey 生成新的密钥，返回明文和哈希值
+func generateKey() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	key := keyPrefix + hex.EncodeToString(buf)
+	return key, hashKey(key), nil
+}
+
+// hashKey 计算密钥的 SHA-256 哈希值
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyAuthenticator 基于个人访问令牌的认证，支持 X-API-Key 请求头和 Authorization: Bearer
+type apiKeyAuthenticator struct{}
+
+func (a *apiKeyAuthenticator) Name() string {
+	return core.AuthMethodAPIKey
+}
+
+func (a *apiKeyAuthenticator) Authenticate(c *fiber.Ctx) (*core.Identity, error) {
+	key := c.Get("X-API-Key")
+	if key == "" {
+		key = core.BearerToken(c)
+	}
+	if !strings.HasPrefix(key, keyPrefix) {
+		return nil, nil
+	}
+
+	var apiKey models.APIKey
+	if err := app.DB.Where("key_hash = ?", hashKey(key)).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("无效的访问令牌")
+		}
+		return nil, err
+	}
+
+	if apiKey.RevokedAt != nil {
+		return nil, fmt.Errorf("访问令牌已撤销")
+	}
+	if apiKey.IsExpired(time.Now()) {
+		return nil, fmt.Errorf("访问令牌已过期")
+	}
+
+	// 所有者被删除或禁用后，其访问令牌同时失效
+	var owner models.User
+	if err := app.DB.Select("id", "status").First(&owner, apiKey.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("访问令牌的所有者不存在")
+		}
+		return nil, err
+	}
+	if owner.Status != 1 {
+		return nil, fmt.Errorf("访问令牌的所有者已被禁用")
+	}
+
+	// 授权范围为空的令牌不能使用任何权限
+	scopes := apiKey.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return &core.Identity{
+		UserID:       apiKey.UserID,
+		Method:       core.AuthMethodAPIKey,
+		CredentialID: apiKey.ID,
+		Scopes:       scopes,
+	}, nil
+}
+
+// OnAuthenticated 记录令牌的最后使用时间和IP，并写入操作日志，便于审计构建机等调用方
+func (a *apiKeyAuthenticator) OnAuthenticated(c *fiber.Ctx, identity *core.Identity) {
+	now := time.Now()
+	if err := app.DB.Model(&models.APIKey{}).Where("id = ?", identity.CredentialID).
+		UpdateColumns(map[string]interface{}{"last_used_at": now, "last_used_ip": c.IP()}).Error; err != nil {
+		log.Printf("更新访问令牌使用记录失败: %v", err)
+	}
+
+	details := fmt.Sprintf("使用访问令牌：%s %s", c.Method(), c.Path())
+	if err := adminlog.CreateAdminLog(c, "use", "apikey", identity.CredentialID, details); err != nil {
+		log.Printf("记录访问令牌使用日志失败: %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/andycai/unitool/modules/acl"
 	"github.com/andycai/unitool/modules/adminlog"
 	"github.com/andycai/unitool/utils"
 	"github.com/gofiber/fiber/v2"
@@ -47,8 +48,8 @@ func formatFileSize(size int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
-// handleBrowseDirectory 处理目录浏览请求
-func handleBrowseDirectory(c *fiber.Ctx, path string) error {
+// handleBrowseDirectory 处理目录浏览请求，只显示当前用户可以访问的文件和目录
+func handleBrowseDirectory(c *fiber.Ctx, checker *acl.Checker, path string) error {
 	files, err := ioutil.ReadDir(path)
 	if err != nil {
 		return err
@@ -89,7 +90,7 @@ func handleBrowseDirectory(c *fiber.Ctx, path string) error {
 	})
 
 	// 获取相对于根目录的路径
-	rootDir := app.Config.Server.Output
+	rootDir := app.Config().Server.Output
 	absRootDir, err := filepath.Abs(rootDir)
 	if err != nil {
 		return c.Status(500).SendString("Error resolving root path")
@@ -112,6 +113,16 @@ func handleBrowseDirectory(c *fiber.Ctx, path string) error {
 	// 规范化路径分隔符
 	relPath = normalizePath(relPath)
 
+	// 过滤没有授权的文件和目录，目录中包含授权的子路径时仍然显示
+	visible := entries[:0]
+	for _, entry := range entries {
+		child := relPath + "/" + entry.Name
+		if entry.IsDir && checker.CanBrowsePath(child) || !entry.IsDir && checker.CanAccessPath(child) {
+			visible = append(visible, entry)
+		}
+	}
+	entries = visible
+
 	rootPath := "/admin/browse"
 
 	return c.Render("admin/directory", fiber.Map{
@@ -163,7 +174,7 @@ func handleBrowseFile(c *fiber.Ctx, path string) error {
 	}
 
 	// 获取相对于根目录的路径
-	rootDir := app.Config.Server.Output
+	rootDir := app.Config().Server.Output
 	absRootDir, err := filepath.Abs(rootDir)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "获取根目录失败")
@@ -276,6 +287,31 @@ func uploadByFTP(c *fiber.Ctx, rootPath string) error {
 
 	fullPath := filepath.Join(rootPath, decodedPath)
 
+	// 确保上传的文件在根目录内，并且当前用户有访问授权
+	absRootDir, err := filepath.Abs(rootPath)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "无效的根目录配置",
+		})
+	}
+	absPath, err := filepath.Abs(fullPath)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "无效的文件路径",
+		})
+	}
+	relPath, err := filepath.Rel(absRootDir, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "不能上传根目录以外的文件",
+		})
+	}
+	if !acl.For(c).CanAccessPath(relPath) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "没有访问该文件的权限",
+		})
+	}
+
 	// 上传到 FTP
 	if err := uploadToFTP(fullPath, fileType); err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -295,14 +331,14 @@ func uploadByFTP(c *fiber.Ctx, rootPath string) error {
 // 上传文件到 FTP
 func uploadToFTP(localPath string, fileType string) error {
 	// 连接 FTP
-	conn, err := ftp.Dial(fmt.Sprintf("%s:%s", app.Config.FTP.Host, app.Config.FTP.Port))
+	conn, err := ftp.Dial(fmt.Sprintf("%s:%s", app.Config().FTP.Host, app.Config().FTP.Port))
 	if err != nil {
 		writeUploadLog(localPath, fileType, false, fmt.Sprintf("FTP连接失败: %v", err))
 		return fmt.Errorf("FTP连接失败: %v", err)
 	}
 	defer conn.Quit()
 
-	username, password, err := utils.ReadFromBinaryFile(app.Config.Server.UserDataPath)
+	username, password, err := utils.ReadFromBinaryFile(app.Config().Server.UserDataPath)
 	if err != nil {
 		writeUploadLog(localPath, fileType, false, fmt.Sprintf("读取用户数据失败: %v", err))
 		return fmt.Errorf("读取用户数据失败: %v", err)
@@ -315,9 +351,9 @@ func uploadToFTP(localPath string, fileType string) error {
 	}
 
 	// 根据文件类型选择上传路径
-	remotePath := app.Config.FTP.APKPath
+	remotePath := app.Config().FTP.APKPath
 	if fileType == "zip" {
-		remotePath = app.Config.FTP.ZIPPath
+		remotePath = app.Config().FTP.ZIPPath
 	}
 
 	// 确保远程路径使用正斜杠
@@ -397,7 +433,7 @@ func createRemoteDirectories(conn *ftp.ServerConn, path string) error {
 // 添加日志写入函数
 func writeUploadLog(localPath, fileType string, success bool, message string) error {
 	// 确保日志目录存在
-	if err := os.MkdirAll(app.Config.FTP.LogDir, 0755); err != nil {
+	if err := os.MkdirAll(app.Config().FTP.LogDir, 0755); err != nil {
 		return fmt.Errorf("创建日志目录失败: %v", err)
 	}
 
@@ -411,7 +447,7 @@ func writeUploadLog(localPath, fileType string, success bool, message string) er
 	)
 
 	// 获取当前日志文件路径
-	logFile := filepath.Join(app.Config.FTP.LogDir, fmt.Sprintf("ftpupload_%s.log", time.Now().Format("20060102150405")))
+	logFile := filepath.Join(app.Config().FTP.LogDir, fmt.Sprintf("ftpupload_%s.log", time.Now().Format("20060102150405")))
 
 	// 追加写入日志
 	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
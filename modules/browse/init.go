@@ -9,6 +9,7 @@ import (
 
 	"github.com/andycai/unitool/core"
 	"github.com/andycai/unitool/enum"
+	"github.com/andycai/unitool/modules/acl"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -19,7 +20,18 @@ type browseModule struct {
 }
 
 func init() {
-	core.RegisterModule(&browseModule{}, enum.ModulePriorityBrowse)
+	core.RegisterModule(&browseModule{}, core.ModuleInfo{
+		Name:    enum.ModuleBrowse,
+		Depends: []string{enum.ModuleACL, enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "browse:list", Name: "文件浏览", Description: "查看文件浏览"},
+			{Code: "browse:ftp", Name: "文件FTP上传", Description: "FTP上传文件"},
+			{Code: "browse:delete", Name: "文件删除", Description: "删除文件"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin/tools", Name: "文件浏览", Path: "/admin/browse", Icon: "browse", Sort: 2, Permission: "browse:list"},
+		},
+	})
 }
 
 func (m *browseModule) Awake(a *core.App) error {
@@ -27,6 +39,26 @@ func (m *browseModule) Awake(a *core.App) error {
 	return nil
 }
 
+func (m *browseModule) OnConfigChange(old, new *core.Config) error {
+	// 浏览根目录变化时，确认新目录可用
+	if old.Server.Output != new.Server.Output {
+		if _, err := os.Stat(new.Server.Output); err != nil {
+			return fmt.Errorf("浏览根目录不可用: %v", err)
+		}
+		fmt.Printf("浏览根目录已切换为: %s\n", new.Server.Output)
+	}
+
+	// FTP 上传日志目录变化时，提前创建新目录
+	if old.FTP != new.FTP {
+		if err := os.MkdirAll(new.FTP.LogDir, 0755); err != nil {
+			return fmt.Errorf("创建FTP日志目录失败: %v", err)
+		}
+		fmt.Printf("FTP配置已更新: %s:%s\n", new.FTP.Host, new.FTP.Port)
+	}
+
+	return nil
+}
+
 func (m *browseModule) AddAuthRouters() error {
 	// admin
 	// 浏览目录和文件的路由
@@ -43,7 +75,7 @@ func (m *browseModule) AddAuthRouters() error {
 		}
 
 		// 获取配置的根目录的绝对路径
-		rootDir := app.Config.Server.Output
+		rootDir := app.Config().Server.Output
 		absRootDir, err := filepath.Abs(rootDir)
 		if err != nil {
 			return c.Status(500).SendString("Invalid root directory configuration")
@@ -68,12 +100,24 @@ func (m *browseModule) AddAuthRouters() error {
 			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("File not found: %s", decodedPath))
 		}
 
+		relPath, err := filepath.Rel(absRootDir, absPath)
+		if err != nil {
+			return c.Status(400).SendString("Invalid path")
+		}
+		checker := acl.For(c)
+
 		// 如果是目录，显示目录内容
 		if fileInfo.IsDir() {
-			return handleBrowseDirectory(c, absPath)
+			if !checker.CanBrowsePath(relPath) {
+				return fiber.NewError(fiber.StatusForbidden, "Access denied: No permission for this path")
+			}
+			return handleBrowseDirectory(c, checker, absPath)
 		}
 
 		// 如果是文件，显示文件内容
+		if !checker.CanAccessPath(relPath) {
+			return fiber.NewError(fiber.StatusForbidden, "Access denied: No permission for this path")
+		}
 		return handleBrowseFile(c, absPath)
 	})
 
@@ -91,7 +135,7 @@ func (m *browseModule) AddAuthRouters() error {
 		}
 
 		// 获取配置的根目录的绝对路径
-		rootDir := app.Config.Server.Output
+		rootDir := app.Config().Server.Output
 		absRootDir, err := filepath.Abs(rootDir)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).SendString("Invalid root directory configuration")
@@ -120,12 +164,20 @@ func (m *browseModule) AddAuthRouters() error {
 			return c.Status(fiber.StatusBadRequest).SendString("Cannot delete directories")
 		}
 
+		relPath, err := filepath.Rel(absRootDir, absPath)
+		if err != nil {
+			return c.Status(400).SendString("Invalid path")
+		}
+		if !acl.For(c).CanAccessPath(relPath) {
+			return fiber.NewError(fiber.StatusForbidden, "Access denied: No permission for this path")
+		}
+
 		return handleBrowseDelete(c, absPath)
 	})
 
 	// FTP 上传路由
 	app.RouterAdmin.Post("/ftp/upload", app.HasPermission("browse:ftp"), func(c *fiber.Ctx) error {
-		return uploadByFTP(c, app.Config.Server.Output)
+		return uploadByFTP(c, app.Config().Server.Output)
 	})
 
 	// api
@@ -0,0 +1,66 @@
+package citask
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/enum"
+)
+
+// moduleConfig 模块配置 [modules.citask]
+type moduleConfig struct {
+	MaxConcurrent     int    `toml:"max_concurrent"`      // 所有任务同时运行的最大数量
+	TaskMaxConcurrent int    `toml:"task_max_concurrent"` // 任务没有单独设置时，同一任务同时运行的最大数量
+	CoalesceCron      bool   `toml:"coalesce_cron"`       // 任务已有排队中的运行时，跳过新的定时触发
+	MaxAttempts       int    `toml:"max_attempts"`        // 被中断的运行自动重新排队时，最多尝试的次数
+	LogDir            string `toml:"log_dir"`             // 运行输出的保存目录
+	LogMaxSize        int    `toml:"log_max_size"`        // 每次运行保存的输出上限（MB），超过时丢弃最早的输出
+	LogRetentionDays  int    `toml:"log_retention_days"`  // 已结束的运行记录和输出的保留天数，0 表示不清理
+}
+
+var conf atomic.Pointer[moduleConfig]
+
+// getConfig 获取当前生效的模块配置
+func getConfig() *moduleConfig {
+	return conf.Load()
+}
+
+// loadConfig 读取模块配置，未配置的字段使用默认值
+func loadConfig() (*moduleConfig, error) {
+	mc := &moduleConfig{
+		MaxConcurrent:     2,
+		TaskMaxConcurrent: 1,
+		CoalesceCron:      true,
+		MaxAttempts:       3,
+		LogDir:            "data/citask/logs",
+		LogMaxSize:        200,
+		LogRetentionDays:  30,
+	}
+
+	if err := core.DecodeModuleConfig(enum.ModuleCitask, mc); err != nil {
+		return nil, err
+	}
+
+	if mc.MaxConcurrent <= 0 {
+		return nil, fmt.Errorf("modules.citask 的 max_concurrent 必须大于 0")
+	}
+	if mc.TaskMaxConcurrent <= 0 {
+		return nil, fmt.Errorf("modules.citask 的 task_max_concurrent 必须大于 0")
+	}
+
+	if mc.LogDir == "" {
+		return nil, fmt.Errorf("modules.citask 的 log_dir 不能为空")
+	}
+	if mc.LogMaxSize <= 0 {
+		return nil, fmt.Errorf("modules.citask 的 log_max_size 必须大于 0")
+	}
+	if mc.LogRetentionDays < 0 {
+		return nil, fmt.Errorf("modules.citask 的 log_retention_days 不能小于 0")
+	}
+	if mc.MaxAttempts <= 0 {
+		return nil, fmt.Errorf("modules.citask 的 max_attempts 必须大于 0")
+	}
+
+	return mc, nil
+}
@@ -0,0 +1,428 @@
+package citask
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/acl"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// 事件流使用 Server-Sent Events，浏览器断线重连时通过 Last-Event-ID 从断开的位置继续
+const (
+	eventHistorySize    = 512                    // 保留的最近事件数，用于重连时补发
+	eventBufferSize     = 64                     // 每个订阅方的缓冲，处理不过来时断开，由客户端重连
+	streamHeartbeat     = 15 * time.Second       // 心跳间隔，及时发现已断开的连接
+	streamPollInterval  = 250 * time.Millisecond // 运行输出的读取间隔
+	streamRetryInterval = 3000                   // 建议客户端的重连间隔（毫秒）
+)
+
+// RunEvent 运行状态变化事件
+type RunEvent struct {
+	ID        string    `json:"id,omitempty"`
+	LogID     uint      `json:"log_id"`
+	TaskID    uint      `json:"task_id"`
+	TaskName  string    `json:"task_name"`
+	Status    string    `json:"status"`
+	Progress  int       `json:"progress"`
+	Error     string    `json:"error,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Time      time.Time `json:"time"`
+}
+
+// eventHub 分发运行状态变化事件，事件ID由进程启动时间和序号组成，重启后旧的ID不会被误用
+type eventHub struct {
+	mu          sync.Mutex
+	epoch       string
+	seq         uint64
+	history     []RunEvent
+	subscribers map[chan RunEvent]struct{}
+}
+
+var events = &eventHub{
+	epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+	subscribers: make(map[chan RunEvent]struct{}),
+}
+
+// eventID 序号对应的事件ID
+func (h *eventHub) eventID(seq uint64) string {
+	return h.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// parseEventID 解析事件ID中的序号，不是本进程产生的事件ID时返回 false
+func (h *eventHub) parseEventID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != h.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
+
+// publish 发布事件，订阅方的缓冲已满时断开该订阅方
+func (h *eventHub) publish(e RunEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	e.ID = h.eventID(h.seq)
+	e.Time = time.Now()
+
+	h.history = append(h.history, e)
+	if len(h.history) > eventHistorySize {
+		h.history = append(h.history[:0], h.history[len(h.history)-eventHistorySize:]...)
+	}
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe 订阅事件。lastID 是客户端收到的最后一个事件，
+// 之后的事件仍在历史中时返回需要补发的事件，否则 resumed 为 false，调用方应先发送当前状态
+func (h *eventHub) subscribe(lastID string) (ch chan RunEvent, replay []RunEvent, current string, resumed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch = make(chan RunEvent, eventBufferSize)
+	h.subscribers[ch] = struct{}{}
+	current = h.eventID(h.seq)
+
+	seq, ok := h.parseEventID(lastID)
+	if !ok || seq > h.seq {
+		return ch, nil, current, false
+	}
+	if seq == h.seq {
+		return ch, nil, current, true
+	}
+	if len(h.history) == 0 {
+		return ch, nil, current, false
+	}
+
+	first, _ := h.parseEventID(h.history[0].ID)
+	if seq+1 < first {
+		return ch, nil, current, false
+	}
+	for _, e := range h.history {
+		if n, _ := h.parseEventID(e.ID); n > seq {
+			replay = append(replay, e)
+		}
+	}
+	return ch, replay, current, true
+}
+
+// unsubscribe 取消订阅
+func (h *eventHub) unsubscribe(ch chan RunEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publishRun 发布运行的当前状态
+func publishRun(run *models.TaskLog, taskName string, progress int) {
+	events.publish(RunEvent{
+		LogID:     run.ID,
+		TaskID:    run.TaskID,
+		TaskName:  taskName,
+		Status:    run.Status,
+		Progress:  progress,
+		Error:     run.Error,
+		StartTime: run.StartTime,
+		EndTime:   run.EndTime,
+	})
+}
+
+// isFinished 运行是否已结束
+func isFinished(status string) bool {
+	return status != runStatusQueued && status != runStatusRunning
+}
+
+// prepareStream 设置事件流的响应头
+func prepareStream(c *fiber.Ctx) {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // 禁止反向代理缓冲
+}
+
+// writeEvent 写入一个事件并立即发送，连接已断开时返回错误
+func writeEvent(w *bufio.Writer, event, id string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return w.Flush()
+}
+
+// writeHeartbeat 写入心跳注释，连接已断开时返回错误
+func writeHeartbeat(w *bufio.Writer) error {
+	w.WriteString(": ping\n\n")
+	return w.Flush()
+}
+
+// lastEventID 客户端收到的最后一个事件ID，浏览器重连时通过请求头携带，也可以通过查询参数指定
+func lastEventID(c *fiber.Ctx) string {
+	if id := c.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	return c.Query("last_event_id")
+}
+
+// streamEvents 所有运行状态变化的事件流，用于正在执行的任务和任务队列。
+// 无法从断开的位置继续时先发送 snapshot 事件，包含所有排队中和运行中的运行
+func streamEvents(c *fiber.Ctx) error {
+	checker := acl.For(c)
+	ch, replay, current, resumed := events.subscribe(lastEventID(c))
+
+	var snapshot []RunEvent
+	if !resumed {
+		var runs []models.TaskLog
+		if err := app.DB.Preload("Task", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "name")
+		}).Where("status IN ?", []string{runStatusQueued, runStatusRunning}).
+			Order("priority desc, sequence asc, id asc").Find(&runs).Error; err != nil {
+			events.unsubscribe(ch)
+			return c.Status(500).JSON(fiber.Map{
+				"error": fmt.Sprintf("获取运行状态失败: %v", err),
+			})
+		}
+
+		snapshot = make([]RunEvent, 0, len(runs))
+		for i := range runs {
+			run := &runs[i]
+			if !checker.CanAccessTask(run.TaskID) {
+				continue
+			}
+			snapshot = append(snapshot, RunEvent{
+				LogID:     run.ID,
+				TaskID:    run.TaskID,
+				TaskName:  run.Task.Name,
+				Status:    run.Status,
+				Progress:  currentProgress(run.ID),
+				StartTime: run.StartTime,
+			})
+		}
+	}
+
+	prepareStream(c)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer events.unsubscribe(ch)
+
+		fmt.Fprintf(w, "retry: %d\n\n", streamRetryInterval)
+		if !resumed {
+			if err := writeEvent(w, "snapshot", current, snapshot); err != nil {
+				return
+			}
+		}
+		for _, e := range replay {
+			if checker.CanAccessTask(e.TaskID) {
+				if err := writeEvent(w, "run", e.ID, e); err != nil {
+					return
+				}
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					// 处理过慢被断开，客户端重连后补发
+					return
+				}
+				if !checker.CanAccessTask(e.TaskID) {
+					continue
+				}
+				if err := writeEvent(w, "run", e.ID, e); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if err := writeHeartbeat(w); err != nil {
+					return
+				}
+			case <-app.Closing():
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// currentProgress 运行在内存中的进度
+func currentProgress(id uint) int {
+	progressMutex.RLock()
+	defer progressMutex.RUnlock()
+
+	if progress, ok := taskProgressMap[id]; ok {
+		return progress.Progress
+	}
+	return 0
+}
+
+// streamRunOutput 单个运行的事件流，发送新的输出（output）和状态变化（status），运行结束并发送完输出后发送 end。
+// 输出事件的ID是输出的偏移量，重连时从 Last-Event-ID 继续；首次连接可以用 offset 指定起始位置，
+// 或用 tail 只从最后若干字节开始
+func streamRunOutput(c *fiber.Ctx) error {
+	// 先订阅再读取运行状态，避免错过两者之间的状态变化
+	ch, _, _, _ := events.subscribe("")
+	run, err := loadRunLog(c)
+	if run == nil {
+		events.unsubscribe(ch)
+		return err
+	}
+
+	var taskName string
+	var task models.Task
+	if err := app.DB.Select("id", "name").First(&task, run.TaskID).Error; err == nil {
+		taskName = task.Name
+	}
+
+	dir := runLogDir(run.ID)
+	offset := int64(c.QueryInt("offset", 0))
+	if id := lastEventID(c); id != "" {
+		if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+			offset = n
+		}
+	} else if tail := int64(c.QueryInt("tail", 0)); tail > 0 {
+		_, size, err := scanRunLog(dir)
+		if err != nil {
+			events.unsubscribe(ch)
+			return c.Status(500).JSON(fiber.Map{
+				"error": fmt.Sprintf("读取任务输出失败: %v", err),
+			})
+		}
+		offset = max(size-tail, 0)
+	}
+
+	legacy := run.OutputSize == 0 && run.Output != ""
+
+	prepareStream(c)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer events.unsubscribe(ch)
+
+		status := RunEvent{
+			LogID:     run.ID,
+			TaskID:    run.TaskID,
+			TaskName:  taskName,
+			Status:    run.Status,
+			Progress:  currentProgress(run.ID),
+			Error:     run.Error,
+			StartTime: run.StartTime,
+			EndTime:   run.EndTime,
+		}
+		id := strconv.FormatInt(offset, 10)
+
+		fmt.Fprintf(w, "retry: %d\n\n", streamRetryInterval)
+		if err := writeEvent(w, "status", id, status); err != nil {
+			return
+		}
+
+		// flush 发送偏移量之后的所有输出，final 为 true 时不再等待不完整的行
+		flush := func(final bool) error {
+			for {
+				data, actual, _, size, err := readRunLog(dir, offset, logChunkLimit)
+				if err != nil {
+					return err
+				}
+				if legacy && size == 0 {
+					// 输出保存到文件之前的运行
+					output := []byte(run.Output)
+					actual = min(max(offset, 0), int64(len(output)))
+					data = output[actual:]
+				}
+				if !final {
+					if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+						data = data[:i+1]
+					}
+				}
+				data = trimRuneEnd(data)
+				if len(data) == 0 {
+					offset = actual
+					return nil
+				}
+
+				next := actual + int64(len(data))
+				id = strconv.FormatInt(next, 10)
+				if err := writeEvent(w, "output", id, fiber.Map{
+					"offset":      actual,
+					"next_offset": next,
+					"data":        string(data),
+				}); err != nil {
+					return err
+				}
+				offset = next
+			}
+		}
+
+		finished := isFinished(run.Status)
+		poll := time.NewTicker(streamPollInterval)
+		defer poll.Stop()
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			if err := flush(finished); err != nil {
+				return
+			}
+			if finished {
+				writeEvent(w, "end", id, status)
+				return
+			}
+
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				if e.LogID != run.ID {
+					continue
+				}
+				status = e
+				status.ID = ""
+				finished = isFinished(e.Status)
+				// 先发送状态变化之前产生的输出
+				if err := flush(finished); err != nil {
+					return
+				}
+				if err := writeEvent(w, "status", id, status); err != nil {
+					return
+				}
+			case <-poll.C:
+			case <-heartbeat.C:
+				if err := writeHeartbeat(w); err != nil {
+					return
+				}
+			case <-app.Closing():
+				return
+			}
+		}
+	})
+	return nil
+}
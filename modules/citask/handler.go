@@ -6,22 +6,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/acl"
 	"github.com/andycai/unitool/modules/adminlog"
 	"github.com/gofiber/fiber/v2"
 	"github.com/robfig/cron/v3"
 	"golang.org/x/text/encoding/simplifiedchinese"
+	"gorm.io/gorm"
 )
 
 // TaskProgress 任务进度
@@ -38,12 +41,79 @@ type TaskProgress struct {
 	Progress  int       `json:"progress"` // 0-100
 }
 
+// 执行任务的协程通过以下方法更新进度，读取方在 progressMutex 下复制后使用，
+// progress 为 nil 时忽略
+
+// setStatus 更新运行状态和错误信息
+func (p *TaskProgress) setStatus(status, errMsg string) {
+	if p == nil {
+		return
+	}
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	p.Status = status
+	p.Error = errMsg
+}
+
+// succeed 标记运行成功
+func (p *TaskProgress) succeed() {
+	if p == nil {
+		return
+	}
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	p.Status = "success"
+	p.Progress = 100
+}
+
+// setOutput 更新输出的末尾
+func (p *TaskProgress) setOutput(output string) {
+	if p == nil {
+		return
+	}
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	p.Output = output
+}
+
+// finish 运行结束后根据任务日志更新进度
+func (p *TaskProgress) finish(log *models.TaskLog) {
+	if p == nil {
+		return
+	}
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+	p.Status = log.Status
+	p.Output = log.Output
+	p.EndTime = log.EndTime
+	p.Duration = log.Duration
+	p.Progress = 100
+}
+
+// lookupProgress 返回内存中进度信息的副本
+func lookupProgress(id uint) (*TaskProgress, bool) {
+	progressMutex.RLock()
+	defer progressMutex.RUnlock()
+
+	progress, ok := taskProgressMap[id]
+	if !ok {
+		return nil, false
+	}
+	snapshot := *progress
+	return &snapshot, true
+}
+
 var (
 	taskProgressMap = make(map[uint]*TaskProgress)
 	taskCmdMap      = make(map[uint]*exec.Cmd)
 	cronEntries     = make(map[uint]cron.EntryID)
 	progressMutex   sync.RWMutex
 	cronScheduler   *cron.Cron
+
+	// 运行中任务的生命周期控制，用于服务关闭时等待或取消任务
+	runCtx, runCancel = context.WithCancel(context.Background())
+	runningTasks      sync.WaitGroup
+	shuttingDown      atomic.Bool
 )
 
 // 初始化定时任务调度器
@@ -73,46 +143,33 @@ func scheduleCronTask(task *models.Task) error {
 		return nil
 	}
 
+	taskID := task.ID
 	entryID, err := cronScheduler.AddFunc(task.CronExpr, func() {
-		// 创建任务日志
-		taskLog := &models.TaskLog{
-			TaskID:    task.ID,
-			StartTime: time.Now(),
-			Status:    "running",
+		if shuttingDown.Load() {
+			return
 		}
 
-		if err := app.DB.Create(taskLog).Error; err != nil {
-			fmt.Printf("创建任务日志失败: %v\n", err)
+		// 按最新的任务配置入队
+		var current models.Task
+		if err := app.DB.First(&current, taskID).Error; err != nil {
+			fmt.Printf("加载定时任务失败 [%d]: %v\n", taskID, err)
 			return
 		}
-
-		// 创建进度信息
-		progress := &TaskProgress{
-			Status:    "running",
-			StartTime: time.Now(),
+		if getConfig().CoalesceCron && hasQueuedRun(current.ID) {
+			fmt.Printf("任务 [%d] 已在排队，跳过本次定时触发\n", current.ID)
+			return
 		}
 
-		progressMutex.Lock()
-		taskProgressMap[taskLog.ID] = progress
-		progressMutex.Unlock()
-
-		// 执行任务
-		go func() {
-			if task.Type == "script" {
-				executeScriptTask(task, taskLog, progress)
-			} else {
-				executeHTTPTask(task, taskLog, progress)
-			}
+		// 定时执行时参数都使用默认值
+		values, err := resolveParams(current.Params, nil)
+		if err != nil {
+			fmt.Printf("任务 [%d] 的参数无效，跳过本次定时触发: %v\n", current.ID, err)
+			return
+		}
 
-			// 更新任务日志
-			taskLog.EndTime = time.Now()
-			taskLog.Status = progress.Status
-			taskLog.Output = progress.Output
-			taskLog.Error = progress.Error
-			if err := app.DB.Save(taskLog).Error; err != nil {
-				fmt.Printf("更新任务日志失败: %v\n", err)
-			}
-		}()
+		if _, err := enqueueRun(&current, "cron", "", current.Priority, values); err != nil {
+			fmt.Printf("创建任务日志失败: %v\n", err)
+		}
 	})
 
 	if err != nil {
@@ -135,7 +192,29 @@ func getTasks(c *fiber.Ctx) error {
 			"error": fmt.Sprintf("获取任务列表失败: %v", err),
 		})
 	}
-	return c.JSON(tasks)
+	return c.JSON(filterTasks(c, tasks, 0))
+}
+
+// filterTasks 过滤出当前用户可以访问的任务，limit 大于 0 时最多返回 limit 个
+func filterTasks(c *fiber.Ctx, tasks []models.Task, limit int) []models.Task {
+	checker := acl.For(c)
+	result := make([]models.Task, 0, len(tasks))
+	for _, task := range tasks {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		if checker.CanAccessTask(task.ID) {
+			result = append(result, task)
+		}
+	}
+	return result
+}
+
+// taskForbidden 没有任务的访问授权时的响应
+func taskForbidden(c *fiber.Ctx) error {
+	return c.Status(403).JSON(fiber.Map{
+		"error": "没有访问该任务的权限",
+	})
 }
 
 // createTask 创建任务
@@ -161,6 +240,18 @@ func createTask(c *fiber.Ctx) error {
 		}
 	}
 
+	if task.MaxConcurrent < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "最大并发数不能小于0",
+		})
+	}
+
+	if err := checkTaskParams(&task); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	if err := app.DB.Create(&task).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fmt.Sprintf("创建任务失败: %v", err),
@@ -188,6 +279,9 @@ func getTask(c *fiber.Ctx) error {
 			"error": fmt.Sprintf("任务不存在: %v", err),
 		})
 	}
+	if !acl.For(c).CanAccessTask(task.ID) {
+		return taskForbidden(c)
+	}
 	return c.JSON(task)
 }
 
@@ -214,6 +308,9 @@ func updateTask(c *fiber.Ctx) error {
 			"error": fmt.Sprintf("任务不存在: %v", err),
 		})
 	}
+	if !acl.For(c).CanAccessTask(task.ID) {
+		return taskForbidden(c)
+	}
 
 	// 检查定时任务状态变化
 	cronChanged := task.EnableCron != updates.EnableCron ||
@@ -234,7 +331,23 @@ func updateTask(c *fiber.Ctx) error {
 	}
 
 	// 更新任务信息
-	if err := app.DB.Model(&task).Updates(updates).Update("enable_cron", updates.EnableCron).Error; err != nil {
+	if updates.MaxConcurrent < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "最大并发数不能小于0",
+		})
+	}
+
+	if err := checkTaskParams(&updates); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// 更新任务信息，选中的字段即使是零值也会更新
+	if err := app.DB.Model(&task).Select(
+		"name", "description", "type", "script", "url", "method", "headers", "body", "timeout", "status",
+		"enable_cron", "cron_expr", "max_concurrent", "priority", "requeue_interrupted", "params", "updated_at",
+	).Updates(&updates).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fmt.Sprintf("更新任务失败: %v", err),
 		})
@@ -278,12 +391,24 @@ func deleteTask(c *fiber.Ctx) error {
 			"error": fmt.Sprintf("任务不存在: %v", err),
 		})
 	}
+	if !acl.For(c).CanAccessTask(task.ID) {
+		return taskForbidden(c)
+	}
 
 	if err := app.DB.Delete(&task).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fmt.Sprintf("删除任务失败: %v", err),
 		})
 	}
+	acl.DeleteResource(models.ACLResourceTask, strconv.FormatUint(uint64(task.ID), 10))
+	cancelQueuedRuns(task.ID, "任务已删除")
+
+	// 删除任务已结束的运行记录和输出，仍在运行的由过期清理删除
+	if ids, err := finishedRuns("task_id = ?", task.ID); err != nil {
+		fmt.Printf("加载任务 [%d] 的运行记录失败: %v\n", task.ID, err)
+	} else if err := deleteRuns(ids); err != nil {
+		fmt.Printf("删除任务 [%d] 的运行记录失败: %v\n", task.ID, err)
+	}
 
 	// 记录操作日志
 	adminlog.CreateAdminLog(c, "delete", "task", task.ID, fmt.Sprintf("删除任务：%s", task.Name))
@@ -291,8 +416,19 @@ func deleteTask(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "删除成功"})
 }
 
-// runTask 执行任务
+type runTaskRequest struct {
+	Priority *int                   `json:"priority"` // 本次运行的优先级
+	Params   map[string]interface{} `json:"params"`   // 本次运行的参数值，没有提供的参数使用默认值
+}
+
+// runTask 执行任务，任务进入队列后按并发限制执行
 func runTask(c *fiber.Ctx) error {
+	if shuttingDown.Load() {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "服务正在关闭，无法执行任务",
+		})
+	}
+
 	id := c.Params("id")
 	var task models.Task
 	if err := app.DB.First(&task, id).Error; err != nil {
@@ -300,44 +436,62 @@ func runTask(c *fiber.Ctx) error {
 			"error": fmt.Sprintf("任务不存在: %v", err),
 		})
 	}
+	if !acl.For(c).CanAccessTask(task.ID) {
+		return taskForbidden(c)
+	}
 
-	// 创建任务日志
-	taskLog := models.TaskLog{
-		TaskID:    task.ID,
-		Status:    "running",
-		StartTime: time.Now(),
+	// 可以指定本次运行的优先级，默认使用任务的优先级
+	req := runTaskRequest{Priority: &task.Priority}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": fmt.Sprintf("无效的请求数据: %v", err),
+			})
+		}
 	}
-	if err := app.DB.Create(&taskLog).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": fmt.Sprintf("创建任务日志失败: %v", err),
+
+	values, err := resolveParams(task.Params, req.Params)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
 		})
 	}
 
-	// 初始化进度信息
-	progress := &TaskProgress{
-		ID:        taskLog.ID,
-		TaskID:    task.ID,
-		TaskName:  task.Name,
-		Status:    "running",
-		StartTime: taskLog.StartTime,
-		Progress:  0,
+	operator := ""
+	if user := app.CurrentUser(c); user != nil {
+		operator = user.Username
 	}
-	progressMutex.Lock()
-	taskProgressMap[taskLog.ID] = progress
-	progressMutex.Unlock()
 
-	// 记录操作日志
-	adminlog.CreateAdminLog(c, "run", "task", task.ID, fmt.Sprintf("执行任务：%s", task.Name))
+	// 创建排队中的任务日志，由调度按并发限制执行
+	taskLog, err := enqueueRun(&task, "manual", operator, *req.Priority, values)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fmt.Sprintf("创建任务日志失败: %v", err),
+		})
+	}
 
-	// 异步执行任务
-	go executeTask(&task, &taskLog)
+	// 记录操作日志，secret 参数只记录隐藏后的值
+	details := fmt.Sprintf("执行任务：%s", task.Name)
+	if len(taskLog.Params) > 0 {
+		details += fmt.Sprintf("，参数：%s", formatParams(taskLog.Params))
+	}
+	adminlog.CreateAdminLog(c, "run", "task", task.ID, details)
 
 	return c.JSON(taskLog)
 }
 
 // getTaskLogs 获取任务日志
 func getTaskLogs(c *fiber.Ctx) error {
-	taskID := c.Params("id")
+	taskID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "无效的任务ID",
+		})
+	}
+	if !acl.For(c).CanAccessTask(uint(taskID)) {
+		return taskForbidden(c)
+	}
+
 	var logs []models.TaskLog
 	if err := app.DB.Where("task_id = ?", taskID).Order("created_at desc").Find(&logs).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -376,14 +530,20 @@ func getTaskProgress(c *fiber.Ctx) error {
 		})
 	}
 
-	progressMutex.RLock()
-	progress, exists := taskProgressMap[uint(id)]
-	progressMutex.RUnlock()
+	progress, exists := lookupProgress(uint(id))
 
+	// 进度信息只保存在内存中，服务重启后从任务日志构建
 	if !exists {
-		return c.Status(404).JSON(fiber.Map{
-			"error": "找不到任务进度信息",
-		})
+		var run models.TaskLog
+		if err := app.DB.Preload("Task").First(&run, id).Error; err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "找不到任务进度信息",
+			})
+		}
+		progress = progressFromLog(&run)
+	}
+	if !acl.For(c).CanAccessTask(progress.TaskID) {
+		return taskForbidden(c)
 	}
 
 	return c.JSON(progress)
@@ -391,20 +551,38 @@ func getTaskProgress(c *fiber.Ctx) error {
 
 // executeTask 执行任务
 func executeTask(task *models.Task, log *models.TaskLog) {
+	progressMutex.RLock()
 	progress := taskProgressMap[log.ID]
+	progressMutex.RUnlock()
+
+	// 输出写入日志文件，任务日志只保存输出的末尾
+	out, err := openRunOutput(log.ID)
+	if err != nil {
+		log.Status = "failed"
+		log.Error = fmt.Sprintf("创建输出文件失败: %v", err)
+		log.EndTime = time.Now()
+		app.DB.Save(log)
+		clearSecrets(log.ID)
+		progress.setStatus(log.Status, log.Error)
+		progress.finish(log)
+		publishRun(log, task.Name, 100)
+		return
+	}
+
 	defer func() {
+		out.Close()
+		log.Output = out.Tail()
+		log.OutputSize = out.Size()
 		log.EndTime = time.Now()
 		log.Duration = int(log.EndTime.Sub(log.StartTime).Seconds())
 
 		// 执行完成任务，保存任务日志到数据库
 		app.DB.Save(log)
+		clearSecrets(log.ID)
 
 		// 更新并清理进度信息
 		if progress != nil {
-			progress.Status = log.Status
-			progress.EndTime = log.EndTime
-			progress.Duration = log.Duration
-			progress.Progress = 100
+			progress.finish(log)
 
 			// 延迟删除进度信息
 			time.AfterFunc(time.Hour*2, func() {
@@ -413,20 +591,26 @@ func executeTask(task *models.Task, log *models.TaskLog) {
 				progressMutex.Unlock()
 			})
 		}
+
+		// 输出已全部写入文件后再通知运行结束
+		publishRun(log, task.Name, 100)
 	}()
 
 	switch task.Type {
 	case "script":
-		executeScriptTask(task, log, progress)
+		executeScriptTask(task, log, progress, out)
 	case "http":
-		executeHTTPTask(task, log, progress)
+		executeHTTPTask(task, log, progress, out)
 	default:
 		log.Status = "failed"
 		log.Error = "未知的任务类型"
-		if progress != nil {
-			progress.Status = "failed"
-			progress.Error = log.Error
-		}
+		progress.setStatus("failed", log.Error)
+	}
+
+	// 错误信息中可能包含渲染后的请求地址等参数值
+	if redacted := redactSecrets(log.Error, log.Secrets); redacted != log.Error {
+		log.Error = redacted
+		progress.setStatus(log.Status, log.Error)
 	}
 }
 
@@ -569,17 +753,14 @@ func (w *gbkOutputWriter) Write(p []byte) (n int, err error) {
 }
 
 // executeScriptTask 执行脚本任务
-func executeScriptTask(task *models.Task, log *models.TaskLog, progress *TaskProgress) {
+func executeScriptTask(task *models.Task, log *models.TaskLog, progress *TaskProgress, out *runOutput) {
 	fmt.Printf("开始执行脚本任务: %s (ID: %d)\n", task.Name, task.ID)
 
 	// 首先检查脚本安全性
 	if unsafe, reason := isUnsafeCommand(task.Script); unsafe {
 		log.Status = "failed"
 		log.Error = fmt.Sprintf("脚本包含不安全的命令: %s", reason)
-		if progress != nil {
-			progress.Status = "failed"
-			progress.Error = log.Error
-		}
+		progress.setStatus("failed", log.Error)
 		fmt.Printf("脚本安全检查失败: %s\n", reason)
 		return
 	}
@@ -594,10 +775,7 @@ func executeScriptTask(task *models.Task, log *models.TaskLog, progress *TaskPro
 	if err != nil {
 		log.Status = "failed"
 		log.Error = fmt.Sprintf("创建临时文件失败: %v", err)
-		if progress != nil {
-			progress.Status = "failed"
-			progress.Error = log.Error
-		}
+		progress.setStatus("failed", log.Error)
 		fmt.Printf("创建临时文件失败: %v\n", err)
 		return
 	}
@@ -613,10 +791,7 @@ func executeScriptTask(task *models.Task, log *models.TaskLog, progress *TaskPro
 	if _, err := tmpFile.WriteString(scriptContent); err != nil {
 		log.Status = "failed"
 		log.Error = fmt.Sprintf("写入脚本失败: %v", err)
-		if progress != nil {
-			progress.Status = "failed"
-			progress.Error = log.Error
-		}
+		progress.setStatus("failed", log.Error)
 		fmt.Printf("写入脚本内容失败: %v\n", err)
 		return
 	}
@@ -628,10 +803,7 @@ func executeScriptTask(task *models.Task, log *models.TaskLog, progress *TaskPro
 		if err := os.Chmod(tmpFile.Name(), 0755); err != nil {
 			log.Status = "failed"
 			log.Error = fmt.Sprintf("设置脚本权限失败: %v", err)
-			if progress != nil {
-				progress.Status = "failed"
-				progress.Error = log.Error
-			}
+			progress.setStatus("failed", log.Error)
 			fmt.Printf("设置脚本权限失败: %v\n", err)
 			return
 		}
@@ -665,9 +837,15 @@ func executeScriptTask(task *models.Task, log *models.TaskLog, progress *TaskPro
 	cmd.Dir = tmpDir
 	fmt.Printf("工作目录: %s\n", tmpDir)
 
-	// 创建输出缓冲区
-	var outputBuffer bytes.Buffer
-	var errorBuffer bytes.Buffer
+	// 标准输出和标准错误按顺序写入输出文件，另外保留标准错误的末尾作为错误信息，
+	// 写入前隐藏 secret 参数的值
+	var errorTail tailBuffer
+	stdout := newSecretRedactor(io.MultiWriter(out, os.Stdout), log.Secrets)
+	stderr := newSecretRedactor(io.MultiWriter(out, &errorTail, os.Stderr), log.Secrets)
+	flushOutput := func() {
+		stdout.Flush()
+		stderr.Flush()
+	}
 
 	// 设置标准输入为 null 设备
 	if runtime.GOOS == "windows" {
@@ -684,8 +862,8 @@ func executeScriptTask(task *models.Task, log *models.TaskLog, progress *TaskPro
 		}
 	}
 
-	cmd.Stdout = io.MultiWriter(&outputBuffer, os.Stdout)
-	cmd.Stderr = io.MultiWriter(&errorBuffer, os.Stderr)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	// 设置超时
 	timeout := time.Duration(task.Timeout) * time.Second
@@ -694,15 +872,20 @@ func executeScriptTask(task *models.Task, log *models.TaskLog, progress *TaskPro
 	}
 	fmt.Printf("设置超时时间: %v\n", timeout)
 
-	// 创建一个带有超时的context
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	// 创建一个带有超时的context，服务关闭时会被取消
+	ctx, cancel := context.WithTimeout(runCtx, timeout)
 	defer cancel()
 
-	// 使用context创建新的命令
+	// 使用context创建新的命令，参数通过环境变量传给脚本
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
 	cmd = exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
+	cmd.Env = append(env, paramEnv(runParams(log))...)
 	cmd.Dir = tmpDir
-	cmd.Stdout = io.MultiWriter(&outputBuffer, os.Stdout)
-	cmd.Stderr = io.MultiWriter(&errorBuffer, os.Stderr)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	// 保存命令到映射中
 	progressMutex.Lock()
@@ -713,10 +896,7 @@ func executeScriptTask(task *models.Task, log *models.TaskLog, progress *TaskPro
 	if err := cmd.Start(); err != nil {
 		log.Status = "failed"
 		log.Error = fmt.Sprintf("启动命令失败: %v", err)
-		if progress != nil {
-			progress.Status = "failed"
-			progress.Error = log.Error
-		}
+		progress.setStatus("failed", log.Error)
 		fmt.Printf("启动命令失败: %v\n", err)
 		return
 	}
@@ -731,69 +911,72 @@ func executeScriptTask(task *models.Task, log *models.TaskLog, progress *TaskPro
 	// 清理函数
 	cleanup := func() {
 		progressMutex.Lock()
-		delete(taskCmdMap, task.ID)
+		delete(taskCmdMap, log.ID)
 		progressMutex.Unlock()
 	}
 	defer cleanup()
 
 	ticker := time.NewTicker(100 * time.Millisecond)
 	defer ticker.Stop()
+	lastCheckpoint := time.Now()
+	lastSize := int64(-1)
 
 	for {
 		select {
 		case <-ctx.Done():
+			flushOutput()
 			if ctx.Err() == context.DeadlineExceeded {
 				log.Status = "failed"
-				log.Error = fmt.Sprintf("执行超时（%d秒）\n%s\n%s", task.Timeout, outputBuffer.String(), errorBuffer.String())
-				if progress != nil {
-					progress.Status = "failed"
-					progress.Error = log.Error
-					progress.Output = outputBuffer.String() + "\nError: " + errorBuffer.String()
-				}
+				log.Error = fmt.Sprintf("执行超时（%d秒）\n%s", task.Timeout, errorTail.String())
+				progress.setStatus("failed", log.Error)
 				fmt.Printf("命令执行超时: %v\n", ctx.Err())
 				return
 			}
-		case err := <-done:
-			output := outputBuffer.String()
-			errorOutput := errorBuffer.String()
 
+			// 服务关闭导致任务被取消
+			log.Status = runStatusInterrupted
+			log.Error = fmt.Sprintf("服务关闭，任务被中断\n%s", errorTail.String())
+			progress.setStatus(runStatusInterrupted, log.Error)
+			fmt.Printf("命令被中断: %v\n", ctx.Err())
+			return
+		case err := <-done:
+			flushOutput()
 			if err != nil {
 				log.Status = "failed"
-				log.Error = fmt.Sprintf("执行失败: %v\n%s\n%s", err, output, errorOutput)
-				if progress != nil {
-					progress.Status = "failed"
-					progress.Error = log.Error
-					progress.Output = output + "\nError: " + errorOutput
-				}
+				log.Error = fmt.Sprintf("执行失败: %v\n%s", err, errorTail.String())
+				progress.setStatus("failed", log.Error)
 				fmt.Printf("命令执行失败: %v\n", err)
 				return
 			}
 
-			// 更新任务状态和输出
+			// 更新任务状态
 			log.Status = "success"
-			log.Output = outputBuffer.String()
-			log.Error = errorBuffer.String()
+			log.Error = errorTail.String()
 
-			if progress != nil {
-				progress.Status = "success"
-				progress.Output = log.Output
-				progress.Progress = 100
-			}
+			progress.succeed()
 			fmt.Printf("任务执行成功完成: %s (ID: %d)\n", task.Name, task.ID)
 			return
 		case <-ticker.C:
-			if progress != nil {
-				progress.Output = outputBuffer.String()
-				if errorBuffer.Len() > 0 {
-					progress.Output += "\nError: " + errorBuffer.String()
-				}
+			// 输出有变化时才更新进度中的输出末尾
+			size := out.Size()
+			if size == lastSize {
+				continue
+			}
+			lastSize = size
+			tail := out.Tail()
+			progress.setOutput(tail)
+
+			// 定期保存输出的末尾，进程异常退出后启动时仍能看到
+			if time.Since(lastCheckpoint) >= checkpointInterval {
+				checkpointOutput(log.ID, tail, size)
+				lastCheckpoint = time.Now()
 			}
 		}
 	}
 }
 
 // executeHTTPTask 执行HTTP任务
-func executeHTTPTask(task *models.Task, log *models.TaskLog, progress *TaskProgress) {
+func executeHTTPTask(task *models.Task, log *models.TaskLog, progress *TaskProgress, out *runOutput) {
 	fmt.Printf("开始执行HTTP任务: %s (ID: %d)\n", task.Name, task.ID)
 
 	// 创建HTTP客户端
@@ -801,19 +984,38 @@ func executeHTTPTask(task *models.Task, log *models.TaskLog, progress *TaskProgr
 		Timeout: time.Duration(task.Timeout) * time.Second,
 	}
 
+	// 任务定义了参数时，URL、请求头和请求体中可以引用参数，如 {{.platform}}
+	render := func(name, text string) (string, error) { return text, nil }
+	if len(task.Params) > 0 {
+		values := runParams(log)
+		render = func(name, text string) (string, error) {
+			return renderParams(name, text, values)
+		}
+	}
+
+	reqURL, err := render("url", task.URL)
+	var reqBody string
+	if err == nil {
+		reqBody, err = render("body", task.Body)
+	}
+	if err != nil {
+		log.Status = "failed"
+		log.Error = fmt.Sprintf("渲染请求参数失败: %v", err)
+		progress.setStatus("failed", log.Error)
+		fmt.Printf("渲染HTTP请求参数失败: %v\n", err)
+		return
+	}
+
 	// 创建请求
 	var body io.Reader
-	if task.Body != "" {
-		body = strings.NewReader(task.Body)
+	if reqBody != "" {
+		body = strings.NewReader(reqBody)
 	}
-	req, err := http.NewRequest(task.Method, task.URL, body)
+	req, err := http.NewRequestWithContext(runCtx, task.Method, reqURL, body)
 	if err != nil {
 		log.Status = "failed"
 		log.Error = fmt.Sprintf("创建请求失败: %v", err)
-		if progress != nil {
-			progress.Status = "failed"
-			progress.Error = log.Error
-		}
+		progress.setStatus("failed", log.Error)
 		fmt.Printf("创建HTTP请求失败: %v\n", err)
 		return
 	}
@@ -824,14 +1026,19 @@ func executeHTTPTask(task *models.Task, log *models.TaskLog, progress *TaskProgr
 		if err := json.Unmarshal([]byte(task.Headers), &headers); err != nil {
 			log.Status = "failed"
 			log.Error = fmt.Sprintf("解析请求头失败: %v", err)
-			if progress != nil {
-				progress.Status = "failed"
-				progress.Error = log.Error
-			}
+			progress.setStatus("failed", log.Error)
 			fmt.Printf("解析请求头失败: %v\n", err)
 			return
 		}
 		for key, value := range headers {
+			value, err := render("header "+key, value)
+			if err != nil {
+				log.Status = "failed"
+				log.Error = fmt.Sprintf("渲染请求头 %s 失败: %v", key, err)
+				progress.setStatus("failed", log.Error)
+				fmt.Printf("渲染请求头失败: %v\n", err)
+				return
+			}
 			req.Header.Set(key, value)
 		}
 	}
@@ -841,10 +1048,12 @@ func executeHTTPTask(task *models.Task, log *models.TaskLog, progress *TaskProgr
 	if err != nil {
 		log.Status = "failed"
 		log.Error = fmt.Sprintf("发送请求失败: %v", err)
-		if progress != nil {
-			progress.Status = "failed"
-			progress.Error = log.Error
+		if runCtx.Err() != nil {
+			// 服务关闭导致请求被取消
+			log.Status = runStatusInterrupted
+			log.Error = "服务关闭，任务被中断"
 		}
+		progress.setStatus(log.Status, log.Error)
 		fmt.Printf("发送HTTP请求失败: %v\n", err)
 		return
 	}
@@ -855,10 +1064,7 @@ func executeHTTPTask(task *models.Task, log *models.TaskLog, progress *TaskProgr
 	if err != nil {
 		log.Status = "failed"
 		log.Error = fmt.Sprintf("读取响应失败: %v", err)
-		if progress != nil {
-			progress.Status = "failed"
-			progress.Error = log.Error
-		}
+		progress.setStatus("failed", log.Error)
 		fmt.Printf("读取HTTP响应失败: %v\n", err)
 		return
 	}
@@ -870,27 +1076,22 @@ func executeHTTPTask(task *models.Task, log *models.TaskLog, progress *TaskProgr
 			respBody = gbkOutput.buffer.Bytes()
 		}
 	}
+	redactor := newSecretRedactor(out, log.Secrets)
+	redactor.Write(respBody)
+	redactor.Flush()
 
 	// 检查响应状态码
 	if resp.StatusCode >= 400 {
 		log.Status = "failed"
-		log.Error = fmt.Sprintf("HTTP请求失败: %s\n响应内容: %s", resp.Status, string(respBody))
-		if progress != nil {
-			progress.Status = "failed"
-			progress.Error = log.Error
-		}
+		log.Error = fmt.Sprintf("HTTP请求失败: %s\n响应内容: %s", resp.Status, out.Tail())
+		progress.setStatus("failed", log.Error)
 		fmt.Printf("HTTP请求返回错误状态码: %d\n", resp.StatusCode)
 		return
 	}
 
 	// 更新任务状态
 	log.Status = "success"
-	log.Output = string(respBody)
-	if progress != nil {
-		progress.Status = "success"
-		progress.Output = log.Output
-		progress.Progress = 100
-	}
+	progress.succeed()
 	fmt.Printf("HTTP任务执行成功完成: %s (ID: %d)\n", task.Name, task.ID)
 }
 
@@ -913,15 +1114,20 @@ func stopTask(c *fiber.Ctx) error {
 	taskId := uint(id)
 
 	// 获取进度信息
-	progressMutex.Lock()
-	progress, exists := taskProgressMap[taskId]
-	progressMutex.Unlock()
-
+	progress, exists := lookupProgress(taskId)
 	if !exists {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "任务不存在或已结束",
 		})
 	}
+	if !acl.For(c).CanAccessTask(progress.TaskID) {
+		return taskForbidden(c)
+	}
+
+	// 排队中的任务直接取消
+	if progress.Status == runStatusQueued {
+		return cancelQueuedRun(c)
+	}
 
 	// 如果任务不是运行状态，返回错误
 	if progress.Status != "running" {
@@ -962,9 +1168,11 @@ func stopTask(c *fiber.Ctx) error {
 
 	// 更新任务状态
 	progressMutex.Lock()
-	progress.Status = "failed"
-	progress.Error = "任务被手动停止"
-	progress.EndTime = time.Now()
+	if progress, ok := taskProgressMap[taskId]; ok {
+		progress.Status = "failed"
+		progress.Error = "任务被手动停止"
+		progress.EndTime = time.Now()
+	}
 	progressMutex.Unlock()
 
 	// 清理命令映射
@@ -978,43 +1186,45 @@ func stopTask(c *fiber.Ctx) error {
 	})
 }
 
-// GetRunningTasks 获取正在执行的任务列表
+// GetRunningTasks 获取正在执行的任务列表，以数据库中的运行状态为准，进度和输出取自内存
 func GetRunningTasks(c *fiber.Ctx) error {
-	progressMutex.Lock()
-	defer progressMutex.Unlock()
+	var runs []models.TaskLog
+	if err := app.DB.Preload("Task", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "name")
+	}).Where("status = ?", runStatusRunning).Order("start_time desc").Find(&runs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fmt.Sprintf("获取正在执行的任务失败: %v", err),
+		})
+	}
 
-	// 从内存中获取所有正在执行的任务
-	var runningTasks []fiber.Map
-	for id, progress := range taskProgressMap {
-		if progress.Status == "running" {
-			// 查询任务信息
-			var taskLog models.TaskLog
-			if err := app.DB.First(&taskLog, id).Error; err != nil {
-				continue
-			}
+	checker := acl.For(c)
+	items := make([]fiber.Map, 0, len(runs))
+	for i := range runs {
+		run := &runs[i]
+		if !checker.CanAccessTask(run.TaskID) {
+			continue
+		}
 
-			// 构建返回数据
-			runningTasks = append(runningTasks, fiber.Map{
-				"id":         id,
-				"name":       progress.TaskName,
-				"status":     progress.Status,
-				"progress":   progress.Progress,
-				"output":     progress.Output,
-				"error":      progress.Error,
-				"start_time": progress.StartTime.Unix(),
-			})
+		progress, ok := lookupProgress(run.ID)
+		if !ok {
+			progress = progressFromLog(run)
 		}
-	}
 
-	// 按开始时间倒序排序
-	sort.Slice(runningTasks, func(i, j int) bool {
-		return runningTasks[i]["start_time"].(int64) > runningTasks[j]["start_time"].(int64)
-	})
+		items = append(items, fiber.Map{
+			"id":         run.ID,
+			"name":       run.Task.Name,
+			"status":     run.Status,
+			"progress":   progress.Progress,
+			"output":     progress.Output,
+			"error":      progress.Error,
+			"start_time": run.StartTime.Unix(),
+		})
+	}
 
 	return c.JSON(fiber.Map{
 		"code": 0,
 		"msg":  "success",
-		"data": runningTasks,
+		"data": items,
 	})
 }
 
@@ -1058,11 +1268,43 @@ func searchTasks(c *fiber.Ctx) error {
 	var tasks []models.Task
 	if err := app.DB.Where("name LIKE ?", "%"+keyword+"%").
 		Order("created_at desc").
-		Limit(10).
 		Find(&tasks).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fmt.Sprintf("搜索任务失败: %v", err),
 		})
 	}
-	return c.JSON(tasks)
+	return c.JSON(filterTasks(c, tasks, 10))
+}
+
+// stopRunningTasks 停止定时调度并等待运行中的任务结束，超时后取消剩余任务
+func stopRunningTasks(ctx context.Context) error {
+	shuttingDown.Store(true)
+
+	// 停止定时调度器，不再触发新的任务
+	if cronScheduler != nil {
+		cronScheduler.Stop()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		runningTasks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	// 等待超时，取消所有仍在运行的任务
+	log.Printf("等待任务结束超时，取消运行中的任务")
+	runCancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("仍有任务未能在关闭前结束")
+	}
 }
@@ -1,6 +1,8 @@
 package citask
 
 import (
+	"context"
+
 	"github.com/andycai/unitool/core"
 	"github.com/andycai/unitool/enum"
 	"github.com/gofiber/fiber/v2"
@@ -10,20 +12,71 @@ var app *core.App
 
 type taskModule struct {
 	core.BaseModule
+	done chan struct{}
 }
 
 func init() {
-	core.RegisterModule(&taskModule{}, enum.ModulePriorityCitask)
+	core.RegisterModule(&taskModule{}, core.ModuleInfo{
+		Name:    enum.ModuleCitask,
+		Depends: []string{enum.ModuleACL, enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "citask:list", Name: "构建任务查看", Description: "查看构建任务"},
+			{Code: "citask:create", Name: "构建任务创建", Description: "创建构建任务"},
+			{Code: "citask:update", Name: "构建任务更新", Description: "更新构建任务"},
+			{Code: "citask:delete", Name: "构建任务删除", Description: "删除构建任务"},
+			{Code: "citask:run", Name: "构建任务执行", Description: "执行构建任务"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin/tools", Name: "构建任务", Path: "/admin/citask", Icon: "citask", Sort: 1, Permission: "citask:list"},
+		},
+	})
 }
 
 func (m *taskModule) Awake(a *core.App) error {
 	app = a
+
+	mc, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	conf.Store(mc)
+
 	return autoMigrate()
 }
 
 func (m *taskModule) Start() error {
+	// 先处理上次退出时中断的运行，再启动调度
+	recoverRuns()
 	initCron()
 
+	// 启动调度，继续执行停机前排队中的任务
+	m.done = make(chan struct{})
+	go dispatchLoop(m.done)
+
+	// 清理过期的运行记录
+	go cleanupLoop(m.done)
+
+	return nil
+}
+
+func (m *taskModule) Stop(ctx context.Context) error {
+	if m.done != nil {
+		close(m.done)
+		m.done = nil
+	}
+	return stopRunningTasks(ctx)
+}
+
+func (m *taskModule) OnConfigChange(old, new *core.Config) error {
+	mc, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	conf.Store(mc)
+
+	// 并发限制可能调大，立即调度排队中的任务
+	wakeDispatcher()
+
 	return nil
 }
 
@@ -39,18 +92,27 @@ func (m *taskModule) AddAuthRouters() error {
 	})
 
 	// api
-	app.RouterApi.Get("/citask", app.HasPermission("citask:list"), getTasks)                        // 获取任务列表
-	app.RouterApi.Post("/citask", app.HasPermission("citask:create"), createTask)                   // 创建任务
-	app.RouterApi.Get("/citask/running", app.HasPermission("citask:list"), GetRunningTasks)         // 获取正在执行的任务
-	app.RouterApi.Get("/citask/next-run", app.HasPermission("citask:list"), getNextRunTime)         // 计算下次执行时间
-	app.RouterApi.Get("/citask/search", app.HasPermission("citask:list"), searchTasks)              // 添加搜索接口
-	app.RouterApi.Get("/citask/:id", app.HasPermission("citask:list"), getTask)                     // 获取任务详情
-	app.RouterApi.Put("/citask/:id", app.HasPermission("citask:update"), updateTask)                // 更新任务
-	app.RouterApi.Delete("/citask/:id", app.HasPermission("citask:delete"), deleteTask)             // 删除任务
-	app.RouterApi.Post("/citask/run/:id", app.HasPermission("citask:run"), runTask)                 // 执行任务
-	app.RouterApi.Get("/citask/logs/:id", app.HasPermission("citask:list"), getTaskLogs)            // 获取任务日志
-	app.RouterApi.Get("/citask/progress/:logId", app.HasPermission("citask:list"), getTaskProgress) // 获取任务进度
-	app.RouterApi.Post("/citask/stop/:logId", app.HasPermission("citask:run"), stopTask)            // 停止任务
+	app.RouterApi.Get("/citask", app.HasPermission("citask:list"), getTasks)                                 // 获取任务列表
+	app.RouterApi.Post("/citask", app.HasPermission("citask:create"), createTask)                            // 创建任务
+	app.RouterApi.Get("/citask/running", app.HasPermission("citask:list"), GetRunningTasks)                  // 获取正在执行的任务
+	app.RouterApi.Get("/citask/queue", app.HasPermission("citask:list"), getQueue)                           // 获取任务队列
+	app.RouterApi.Post("/citask/queue/reorder", app.HasPermission("citask:run"), reorderQueue)               // 调整队列顺序
+	app.RouterApi.Put("/citask/queue/:logId/priority", app.HasPermission("citask:run"), updateQueuePriority) // 调整排队优先级
+	app.RouterApi.Post("/citask/queue/:logId/cancel", app.HasPermission("citask:run"), cancelQueuedRun)      // 取消排队中的任务
+	app.RouterApi.Get("/citask/events", app.HasPermission("citask:list"), streamEvents)                      // 运行状态事件流
+	app.RouterApi.Get("/citask/next-run", app.HasPermission("citask:list"), getNextRunTime)                  // 计算下次执行时间
+	app.RouterApi.Get("/citask/search", app.HasPermission("citask:list"), searchTasks)                       // 添加搜索接口
+	app.RouterApi.Get("/citask/:id", app.HasPermission("citask:list"), getTask)                              // 获取任务详情
+	app.RouterApi.Put("/citask/:id", app.HasPermission("citask:update"), updateTask)                         // 更新任务
+	app.RouterApi.Delete("/citask/:id", app.HasPermission("citask:delete"), deleteTask)                      // 删除任务
+	app.RouterApi.Post("/citask/run/:id", app.HasPermission("citask:run"), runTask)                          // 执行任务
+	app.RouterApi.Get("/citask/logs/:logId/stream", app.HasPermission("citask:list"), streamRunOutput)       // 运行输出事件流
+	app.RouterApi.Get("/citask/logs/:logId/output", app.HasPermission("citask:list"), getRunOutput)          // 读取运行输出
+	app.RouterApi.Get("/citask/logs/:logId/download", app.HasPermission("citask:list"), downloadRunOutput)   // 下载完整输出
+	app.RouterApi.Get("/citask/logs/:id", app.HasPermission("citask:list"), getTaskLogs)                     // 获取任务日志
+	app.RouterApi.Delete("/citask/logs/:logId", app.HasPermission("citask:delete"), deleteTaskLog)           // 删除运行记录
+	app.RouterApi.Get("/citask/progress/:logId", app.HasPermission("citask:list"), getTaskProgress)          // 获取任务进度
+	app.RouterApi.Post("/citask/stop/:logId", app.HasPermission("citask:run"), stopTask)                     // 停止任务
 
 	return nil
 }
@@ -0,0 +1,514 @@
+package citask
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/acl"
+	"github.com/andycai/unitool/modules/adminlog"
+	"github.com/gofiber/fiber/v2"
+)
+
+// 运行输出按运行写入 log_dir/<日志ID>/ 下的分段文件，每段固定大小，
+// 第 n 段保存输出中 [n*logSegmentSize, (n+1)*logSegmentSize) 的内容，
+// 总大小超过 log_max_size 时删除最早的分段，偏移量始终按输出的总字节数计算
+const (
+	logSegmentSize  = 4 << 20  // 分段文件大小
+	logTailSize     = 64 << 10 // 任务日志和进度中保存的输出末尾
+	logChunkDefault = 64 << 10 // 读取输出时默认返回的大小
+	logChunkLimit   = 1 << 20  // 读取输出时最多返回的大小
+)
+
+// 过期运行记录的清理间隔和每批删除的数量
+const (
+	logCleanupInterval = time.Hour
+	logCleanupBatch    = 500
+)
+
+// runOutput 运行输出的写入器，同时保留输出的末尾，可以同时写入标准输出和标准错误
+type runOutput struct {
+	mu          sync.Mutex
+	dir         string
+	maxSegments int64
+	size        int64
+	file        *os.File
+	fileSegment int64
+	tail        tailBuffer
+	failed      bool
+	closed      bool
+}
+
+// tailBuffer 只保留最后 logTailSize 字节的缓冲区
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Write 追加内容，超过两倍大小时丢弃前面的内容
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > logTailSize*2 {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-logTailSize:]...)
+	}
+	return len(p), nil
+}
+
+// String 最后 logTailSize 字节的内容，不从半个字符开始
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buf := t.buf
+	if len(buf) > logTailSize {
+		buf = buf[len(buf)-logTailSize:]
+	}
+	return string(trimRuneStart(buf))
+}
+
+// runLogDir 运行输出所在的目录
+func runLogDir(id uint) string {
+	return filepath.Join(getConfig().LogDir, strconv.FormatUint(uint64(id), 10))
+}
+
+// segmentPath 分段文件的路径
+func segmentPath(dir string, segment int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.log", segment))
+}
+
+// openRunOutput 创建运行输出的写入器
+func openRunOutput(id uint) (*runOutput, error) {
+	dir := runLogDir(id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// 重复打开时从已有输出的末尾继续写入
+	_, size, err := scanRunLog(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSegments := (int64(getConfig().LogMaxSize)<<20 + logSegmentSize - 1) / logSegmentSize
+	return &runOutput{
+		dir:         dir,
+		maxSegments: max(maxSegments, 1),
+		size:        size,
+		fileSegment: -1,
+	}, nil
+}
+
+// Write 写入输出，写文件失败时只保留末尾，不影响任务执行
+func (o *runOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// 超时或中断后命令的输出可能晚于关闭到达
+	n := len(p)
+	if o.closed {
+		return n, nil
+	}
+	o.tail.Write(p)
+
+	for len(p) > 0 && !o.failed {
+		segment := o.size / logSegmentSize
+		if segment != o.fileSegment {
+			if err := o.rotate(segment); err != nil {
+				o.fail(err)
+				break
+			}
+		}
+
+		room := (segment+1)*logSegmentSize - o.size
+		chunk := p
+		if int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		written, err := o.file.Write(chunk)
+		o.size += int64(written)
+		if err != nil {
+			o.fail(err)
+			break
+		}
+		p = p[written:]
+	}
+	return n, nil
+}
+
+// rotate 切换到新的分段文件，并删除超出总大小上限的最早分段
+func (o *runOutput) rotate(segment int64) error {
+	if o.file != nil {
+		o.file.Close()
+		o.file = nil
+	}
+
+	file, err := os.OpenFile(segmentPath(o.dir, segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	o.file = file
+	o.fileSegment = segment
+
+	if expired := segment - o.maxSegments; expired >= 0 {
+		if err := os.Remove(segmentPath(o.dir, expired)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("删除过期的输出文件失败: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// fail 记录写文件失败，之后的输出只保留末尾
+func (o *runOutput) fail(err error) {
+	o.failed = true
+	fmt.Printf("写入任务输出失败 [%s]: %v\n", o.dir, err)
+}
+
+// Tail 输出的末尾
+func (o *runOutput) Tail() string {
+	return o.tail.String()
+}
+
+// Size 已写入输出的总字节数
+func (o *runOutput) Size() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.size
+}
+
+// Close 关闭当前的分段文件
+func (o *runOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.closed = true
+	if o.file == nil {
+		return nil
+	}
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
+
+// scanRunLog 扫描运行的输出文件，返回最早可读的偏移量和输出的总字节数，没有输出文件时都为 0
+func scanRunLog(dir string) (start, size int64, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+
+	first, last := int64(-1), int64(-1)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		segment, err := strconv.ParseInt(strings.TrimSuffix(name, ".log"), 10, 64)
+		if err != nil {
+			continue
+		}
+		if first < 0 || segment < first {
+			first = segment
+		}
+		if segment > last {
+			last = segment
+		}
+	}
+	if last < 0 {
+		return 0, 0, nil
+	}
+
+	info, err := os.Stat(segmentPath(dir, last))
+	if err != nil {
+		return 0, 0, err
+	}
+	return first * logSegmentSize, last*logSegmentSize + info.Size(), nil
+}
+
+// readRunLog 从偏移量开始读取最多 limit 字节的输出。
+// 偏移量早于最早可读的位置时从最早可读的位置开始，返回实际的偏移量
+func readRunLog(dir string, offset int64, limit int) (data []byte, actual, start, size int64, err error) {
+	start, size, err = scanRunLog(dir)
+	if err != nil {
+		return nil, 0, 0, 0, err
+	}
+
+	actual = min(max(offset, start), size)
+	data = make([]byte, 0, min(int64(limit), size-actual))
+	for pos := actual; pos < size && len(data) < limit; {
+		segment := pos / logSegmentSize
+		file, err := os.Open(segmentPath(dir, segment))
+		if err != nil {
+			return nil, 0, 0, 0, err
+		}
+		buf := make([]byte, min(int64(limit-len(data)), (segment+1)*logSegmentSize-pos))
+		n, err := file.ReadAt(buf, pos-segment*logSegmentSize)
+		file.Close()
+		data = append(data, buf[:n]...)
+		pos += int64(n)
+		if err != nil {
+			// 分段文件比预期短，例如正在写入，已读到的部分有效
+			break
+		}
+	}
+	return data, actual, start, size, nil
+}
+
+// tailRunLog 读取输出的末尾，用于进程退出后恢复任务日志
+func tailRunLog(dir string) (string, int64, error) {
+	_, size, err := scanRunLog(dir)
+	if err != nil {
+		return "", 0, err
+	}
+	data, _, _, size, err := readRunLog(dir, size-logTailSize, logTailSize)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(trimRuneStart(data)), size, nil
+}
+
+// writeRunLog 按顺序把所有可读的输出写入 w，最早的分段已被删除时先写入说明
+func writeRunLog(w *bufio.Writer, dir string) error {
+	start, size, err := scanRunLog(dir)
+	if err != nil {
+		return err
+	}
+	if start > 0 {
+		fmt.Fprintf(w, "[输出超过大小上限，前 %d 字节已丢弃]\n", start)
+	}
+
+	for segment := start / logSegmentSize; segment*logSegmentSize < size; segment++ {
+		file, err := os.Open(segmentPath(dir, segment))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// trimRuneStart 去掉开头不完整的字符
+func trimRuneStart(p []byte) []byte {
+	for i := 0; i < len(p) && i < utf8.UTFMax; i++ {
+		if utf8.RuneStart(p[i]) {
+			return p[i:]
+		}
+	}
+	return p
+}
+
+// trimRuneEnd 去掉末尾不完整的字符，下次从该字符开始读取
+func trimRuneEnd(p []byte) []byte {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(p[i]) {
+			continue
+		}
+		if !utf8.FullRune(p[i:]) {
+			return p[:i]
+		}
+		break
+	}
+	return p
+}
+
+// deleteRuns 删除运行记录及其输出文件，调用方保证运行已结束
+func deleteRuns(ids []uint) error {
+	for len(ids) > 0 {
+		batch := ids[:min(len(ids), logCleanupBatch)]
+		ids = ids[len(batch):]
+
+		if err := app.DB.Delete(&models.TaskLog{}, batch).Error; err != nil {
+			return err
+		}
+		for _, id := range batch {
+			if err := os.RemoveAll(runLogDir(id)); err != nil {
+				fmt.Printf("删除任务输出失败 [%d]: %v\n", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// finishedRuns 已结束的运行记录ID
+func finishedRuns(query string, args ...interface{}) ([]uint, error) {
+	var ids []uint
+	err := app.DB.Model(&models.TaskLog{}).
+		Where("status NOT IN ?", []string{runStatusQueued, runStatusRunning}).
+		Where(query, args...).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// cleanupRuns 删除结束时间超过保留天数的运行记录和输出文件
+func cleanupRuns() {
+	days := getConfig().LogRetentionDays
+	if days <= 0 {
+		return
+	}
+
+	ids, err := finishedRuns("end_time < ?", time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		fmt.Printf("加载过期的运行记录失败: %v\n", err)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+	if err := deleteRuns(ids); err != nil {
+		fmt.Printf("清理过期的运行记录失败: %v\n", err)
+		return
+	}
+	fmt.Printf("已清理 %d 条超过 %d 天的运行记录\n", len(ids), days)
+}
+
+// cleanupLoop 启动时和之后定期清理过期的运行记录，done 关闭时退出
+func cleanupLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(logCleanupInterval)
+	defer ticker.Stop()
+
+	cleanupRuns()
+	for {
+		select {
+		case <-ticker.C:
+			cleanupRuns()
+		case <-done:
+			return
+		}
+	}
+}
+
+// loadRunLog 加载当前用户可以访问的运行记录，失败时已写入响应
+func loadRunLog(c *fiber.Ctx) (*models.TaskLog, error) {
+	id, ok := parseLogID(c)
+	if !ok {
+		return nil, c.Status(400).JSON(fiber.Map{
+			"error": "无效的日志ID",
+		})
+	}
+
+	var run models.TaskLog
+	if err := app.DB.First(&run, id).Error; err != nil {
+		return nil, c.Status(404).JSON(fiber.Map{
+			"error": "运行记录不存在",
+		})
+	}
+	if !acl.For(c).CanAccessTask(run.TaskID) {
+		return nil, taskForbidden(c)
+	}
+	return &run, nil
+}
+
+// getRunOutput 从偏移量开始读取运行输出，用于持续获取运行中的输出。
+// 下次请求使用返回的 next_offset，偏移量早于最早保存的输出时从最早保存的位置开始
+func getRunOutput(c *fiber.Ctx) error {
+	run, err := loadRunLog(c)
+	if run == nil {
+		return err
+	}
+
+	offset := int64(c.QueryInt("offset", 0))
+	limit := c.QueryInt("limit", logChunkDefault)
+	if limit <= 0 || limit > logChunkLimit {
+		limit = logChunkLimit
+	}
+
+	data, actual, start, size, err := readRunLog(runLogDir(run.ID), offset, limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fmt.Sprintf("读取任务输出失败: %v", err),
+		})
+	}
+	if size == 0 && run.OutputSize == 0 && run.Output != "" {
+		// 输出保存到文件之前的运行，输出全部在任务日志中
+		output := []byte(run.Output)
+		size = int64(len(output))
+		actual = min(max(offset, 0), size)
+		data = output[actual:min(actual+int64(limit), size)]
+	}
+
+	// 不返回末尾不完整的字符，下次从该字符开始读取
+	data = trimRuneEnd(data)
+	next := actual + int64(len(data))
+	finished := run.Status != runStatusQueued && run.Status != runStatusRunning
+
+	return c.JSON(fiber.Map{
+		"offset":      actual,
+		"next_offset": next,
+		"start":       start,
+		"size":        size,
+		"data":        string(data),
+		"status":      run.Status,
+		"eof":         finished && next >= size,
+	})
+}
+
+// downloadRunOutput 下载运行的完整输出
+func downloadRunOutput(c *fiber.Ctx) error {
+	run, err := loadRunLog(c)
+	if run == nil {
+		return err
+	}
+
+	dir := runLogDir(run.ID)
+	_, size, err := scanRunLog(dir)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fmt.Sprintf("读取任务输出失败: %v", err),
+		})
+	}
+
+	c.Attachment(fmt.Sprintf("task-%d-run-%d.log", run.TaskID, run.ID))
+	c.Set(fiber.HeaderContentType, "text/plain; charset=utf-8")
+	if size == 0 {
+		// 输出保存到文件之前的运行
+		return c.SendString(run.Output)
+	}
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := writeRunLog(w, dir); err != nil {
+			fmt.Printf("下载任务输出失败 [%d]: %v\n", run.ID, err)
+		}
+	})
+	return nil
+}
+
+// deleteTaskLog 删除已结束的运行记录和输出文件
+func deleteTaskLog(c *fiber.Ctx) error {
+	run, err := loadRunLog(c)
+	if run == nil {
+		return err
+	}
+	if run.Status == runStatusQueued || run.Status == runStatusRunning {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "任务排队中或正在执行，不能删除",
+		})
+	}
+
+	if err := deleteRuns([]uint{run.ID}); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fmt.Sprintf("删除运行记录失败: %v", err),
+		})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "delete", "task_log", run.ID, fmt.Sprintf("删除任务 [%d] 的运行记录：#%d", run.TaskID, run.ID))
+
+	return c.JSON(fiber.Map{"message": "删除成功"})
+}
@@ -0,0 +1,393 @@
+package citask
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/andycai/unitool/models"
+)
+
+// 参数类型
+const (
+	paramTypeString = "string"
+	paramTypeEnum   = "enum"
+	paramTypeBool   = "bool"
+	paramTypeNumber = "number"
+	paramTypeSecret = "secret"
+)
+
+const (
+	paramEnvPrefix = "PARAM_" // 脚本中参数对应的环境变量前缀，如参数 platform 对应 PARAM_PLATFORM
+	secretMask     = "******" // 任务日志中 secret 参数显示的值
+)
+
+// paramNamePattern 参数名需要同时可以作为环境变量名和模板变量名
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var (
+	// runSecrets 排队中和运行中的运行的 secret 参数值，只保存在内存中，服务重启后丢失
+	runSecrets      = make(map[uint]map[string]string)
+	runSecretsMutex sync.Mutex
+)
+
+// validateParams 检查任务的参数定义
+func validateParams(params []models.TaskParam) error {
+	// 环境变量名不区分参数名的大小写，大小写不同的参数名也不能重复
+	seen := make(map[string]bool, len(params))
+	for i := range params {
+		p := &params[i]
+		if !paramNamePattern.MatchString(p.Name) {
+			return fmt.Errorf("参数名 %q 无效，只能包含字母、数字和下划线，且不能以数字开头", p.Name)
+		}
+		key := strings.ToUpper(p.Name)
+		if seen[key] {
+			return fmt.Errorf("参数名 %s 重复", p.Name)
+		}
+		seen[key] = true
+
+		switch p.Type {
+		case paramTypeString, paramTypeSecret:
+			if p.Pattern != "" {
+				if _, err := regexp.Compile(p.Pattern); err != nil {
+					return fmt.Errorf("参数 %s 的正则表达式无效: %v", p.Name, err)
+				}
+			}
+		case paramTypeEnum:
+			if len(p.Options) == 0 {
+				return fmt.Errorf("参数 %s 是枚举类型，必须提供可选值", p.Name)
+			}
+		case paramTypeBool, paramTypeNumber:
+		default:
+			return fmt.Errorf("参数 %s 的类型 %q 无效", p.Name, p.Type)
+		}
+
+		if p.Type == paramTypeSecret && p.Default != "" {
+			return fmt.Errorf("参数 %s 是 secret 类型，不能设置默认值", p.Name)
+		}
+		if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+			return fmt.Errorf("参数 %s 的最小值不能大于最大值", p.Name)
+		}
+		if p.Default != "" {
+			if _, err := checkParam(p, p.Default); err != nil {
+				return fmt.Errorf("参数 %s 的默认值无效: %v", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkTaskParams 检查任务的参数定义，启用定时执行时参数都使用默认值，必填参数必须有默认值
+func checkTaskParams(task *models.Task) error {
+	if err := validateParams(task.Params); err != nil {
+		return err
+	}
+	if task.EnableCron == 1 {
+		if _, err := resolveParams(task.Params, nil); err != nil {
+			return fmt.Errorf("启用定时执行时参数使用默认值: %v", err)
+		}
+	}
+	return nil
+}
+
+// resolveParams 根据参数定义得到本次运行所有参数的值，values 中没有提供的参数使用默认值
+func resolveParams(params []models.TaskParam, values map[string]interface{}) (map[string]string, error) {
+	for name := range values {
+		if !slices.ContainsFunc(params, func(p models.TaskParam) bool { return p.Name == name }) {
+			return nil, fmt.Errorf("未定义的参数 %s", name)
+		}
+	}
+
+	result := make(map[string]string, len(params))
+	for i := range params {
+		p := &params[i]
+
+		value := p.Default
+		if raw, ok := values[p.Name]; ok && raw != nil {
+			switch v := raw.(type) {
+			case string:
+				value = v
+			case bool:
+				value = strconv.FormatBool(v)
+			case float64:
+				value = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				return nil, fmt.Errorf("参数 %s 的值类型无效", p.Name)
+			}
+		}
+
+		if value == "" {
+			if p.Required {
+				return nil, fmt.Errorf("缺少参数 %s", p.Name)
+			}
+			if p.Type == paramTypeBool {
+				value = "false"
+			}
+			result[p.Name] = value
+			continue
+		}
+
+		value, err := checkParam(p, value)
+		if err != nil {
+			return nil, fmt.Errorf("参数 %s 的值无效: %v", p.Name, err)
+		}
+		result[p.Name] = value
+	}
+	return result, nil
+}
+
+// checkParam 检查参数值是否符合参数定义，返回规范化后的值
+func checkParam(p *models.TaskParam, value string) (string, error) {
+	switch p.Type {
+	case paramTypeString, paramTypeSecret:
+		if p.Pattern != "" {
+			re, err := regexp.Compile(p.Pattern)
+			if err != nil {
+				return "", err
+			}
+			if !re.MatchString(value) {
+				return "", fmt.Errorf("不匹配 %s", p.Pattern)
+			}
+		}
+	case paramTypeEnum:
+		if !slices.Contains(p.Options, value) {
+			return "", fmt.Errorf("只能是 %s 之一", strings.Join(p.Options, ", "))
+		}
+	case paramTypeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("不是有效的布尔值")
+		}
+		value = strconv.FormatBool(b)
+	case paramTypeNumber:
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return "", fmt.Errorf("不是有效的数字")
+		}
+		if p.Min != nil && n < *p.Min {
+			return "", fmt.Errorf("不能小于 %v", *p.Min)
+		}
+		if p.Max != nil && n > *p.Max {
+			return "", fmt.Errorf("不能大于 %v", *p.Max)
+		}
+		value = strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return value, nil
+}
+
+// splitSecrets 把 secret 参数的值从参数值中分离出来，返回隐藏 secret 后的参数值和 secret 参数的值
+func splitSecrets(params []models.TaskParam, values map[string]string) (public, secrets map[string]string) {
+	public = make(map[string]string, len(values))
+	for name, value := range values {
+		public[name] = value
+	}
+	for _, p := range params {
+		if p.Type != paramTypeSecret || values[p.Name] == "" {
+			continue
+		}
+		if secrets == nil {
+			secrets = make(map[string]string)
+		}
+		secrets[p.Name] = values[p.Name]
+		public[p.Name] = secretMask
+	}
+	return public, secrets
+}
+
+// storeSecrets 保存排队中的运行的 secret 参数值
+func storeSecrets(id uint, secrets map[string]string) {
+	if len(secrets) == 0 {
+		return
+	}
+	runSecretsMutex.Lock()
+	defer runSecretsMutex.Unlock()
+	runSecrets[id] = secrets
+}
+
+// loadSecrets 运行的 secret 参数值，没有或已丢失时返回 nil
+func loadSecrets(id uint) map[string]string {
+	runSecretsMutex.Lock()
+	defer runSecretsMutex.Unlock()
+	return runSecrets[id]
+}
+
+// clearSecrets 运行结束后清除 secret 参数值
+func clearSecrets(id uint) {
+	runSecretsMutex.Lock()
+	defer runSecretsMutex.Unlock()
+	delete(runSecrets, id)
+}
+
+// usesSecrets 运行是否提供了 secret 参数的值
+func usesSecrets(params []models.TaskParam, run *models.TaskLog) bool {
+	for _, p := range params {
+		if p.Type == paramTypeSecret && run.Params[p.Name] == secretMask {
+			return true
+		}
+	}
+	return false
+}
+
+// secretsLost 运行提供了 secret 参数的值，但值已不在内存中，例如服务重启前排队的运行
+func secretsLost(params []models.TaskParam, run *models.TaskLog) bool {
+	for _, p := range params {
+		if p.Type == paramTypeSecret && run.Params[p.Name] == secretMask && run.Secrets[p.Name] == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// runParams 运行时使用的参数值，包括 secret 参数的真实值
+func runParams(run *models.TaskLog) map[string]string {
+	values := make(map[string]string, len(run.Params))
+	for name, value := range run.Params {
+		values[name] = value
+	}
+	for name, value := range run.Secrets {
+		values[name] = value
+	}
+	return values
+}
+
+// secretRedactor 把输出中 secret 参数的值替换为 secretMask 后写入 w。
+// 值可能被分成两次写入，末尾可能是某个值开头的部分先暂存，和下次写入的内容一起处理，输出结束后调用 Flush
+type secretRedactor struct {
+	mu      sync.Mutex
+	w       io.Writer
+	secrets [][]byte // 从长到短排列，较长的值先替换
+	pending []byte
+}
+
+func newSecretRedactor(w io.Writer, secrets map[string]string) *secretRedactor {
+	r := &secretRedactor{w: w}
+	for _, value := range secrets {
+		if value != "" {
+			r.secrets = append(r.secrets, []byte(value))
+		}
+	}
+	sort.Slice(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+	return r
+}
+
+func (r *secretRedactor) Write(p []byte) (int, error) {
+	if len(r.secrets) == 0 {
+		return r.w.Write(p)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buf := r.redact(append(r.pending, p...))
+	keep := len(buf) - r.partialSuffix(buf)
+	r.pending = append([]byte(nil), buf[keep:]...)
+	if keep > 0 {
+		if _, err := r.w.Write(buf[:keep]); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush 写入暂存的内容
+func (r *secretRedactor) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) == 0 {
+		return nil
+	}
+	_, err := r.w.Write(r.pending)
+	r.pending = nil
+	return err
+}
+
+// redact 替换内容中所有 secret 参数的值
+func (r *secretRedactor) redact(p []byte) []byte {
+	for _, secret := range r.secrets {
+		p = bytes.ReplaceAll(p, secret, []byte(secretMask))
+	}
+	return p
+}
+
+// partialSuffix 末尾和某个值的开头相同的最大长度
+func (r *secretRedactor) partialSuffix(p []byte) int {
+	longest := 0
+	for _, secret := range r.secrets {
+		for n := min(len(secret)-1, len(p)); n > longest; n-- {
+			if bytes.HasSuffix(p, secret[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
+
+// redactSecrets 把文本中 secret 参数的值替换为 secretMask
+func redactSecrets(text string, secrets map[string]string) string {
+	if len(secrets) == 0 {
+		return text
+	}
+	return string(newSecretRedactor(nil, secrets).redact([]byte(text)))
+}
+
+// formatParams 参数值的文字描述，用于操作日志
+func formatParams(values map[string]string) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+values[name])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// paramEnv 参数对应的环境变量
+func paramEnv(values map[string]string) []string {
+	env := make([]string, 0, len(values))
+	for name, value := range values {
+		env = append(env, paramEnvPrefix+strings.ToUpper(name)+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// renderParams 用参数值渲染模板，如 {{.platform}}，引用未定义的参数时返回错误。
+// 除了 text/template 内置的函数，还可以用 json 函数输出JSON字符串
+func renderParams(name, text string, values map[string]string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"json": func(s string) (string, error) {
+			data, err := json.Marshal(s)
+			return string(data), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
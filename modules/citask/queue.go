@@ -0,0 +1,538 @@
+package citask
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/acl"
+	"github.com/andycai/unitool/modules/adminlog"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// 运行状态，排队中的运行保存在数据库中，服务重启后继续排队
+const (
+	runStatusQueued    = "queued"
+	runStatusRunning   = "running"
+	runStatusCancelled = "cancelled"
+
+	// runStatusInterrupted 服务退出导致运行中断，启动时由 recoverRuns 标记
+	runStatusInterrupted = "interrupted"
+)
+
+// dispatchInterval 调度兜底检查间隔，正常情况下入队和运行结束时立即调度
+const dispatchInterval = 5 * time.Second
+
+var (
+	// dispatchMutex 保证同一时间只有一次调度，同时保护运行计数
+	dispatchMutex sync.Mutex
+	runningTotal  int
+	runningByTask = make(map[uint]int)
+
+	dispatchWake = make(chan struct{}, 1)
+)
+
+// QueueItemVO 队列中的运行
+type QueueItemVO struct {
+	ID        uint      `json:"id"`
+	TaskID    uint      `json:"task_id"`
+	TaskName  string    `json:"task_name"`
+	Status    string    `json:"status"`
+	Priority  int       `json:"priority"`
+	Position  int       `json:"position"` // 排队位置，从1开始，运行中的为0
+	Source    string    `json:"source"`
+	Operator  string    `json:"operator"`
+	QueuedAt  time.Time `json:"queued_at"`
+	StartTime time.Time `json:"start_time"`
+}
+
+type updatePriorityRequest struct {
+	Priority int `json:"priority"`
+}
+
+type reorderQueueRequest struct {
+	IDs []uint `json:"ids"` // 按期望的执行顺序排列的运行ID
+}
+
+// taskConcurrency 任务同时运行的最大数量
+func taskConcurrency(task *models.Task) int {
+	if task.MaxConcurrent > 0 {
+		return task.MaxConcurrent
+	}
+	return getConfig().TaskMaxConcurrent
+}
+
+// enqueueRun 创建排队中的运行并唤醒调度，values 是本次运行的参数值
+func enqueueRun(task *models.Task, source, operator string, priority int, values map[string]string) (*models.TaskLog, error) {
+	now := time.Now()
+	params, secrets := splitSecrets(task.Params, values)
+	return insertQueuedRun(task, &models.TaskLog{
+		Priority: priority,
+		Sequence: now.UnixNano(),
+		Source:   source,
+		Operator: operator,
+		QueuedAt: now,
+		Attempt:  1,
+		Params:   params,
+		Secrets:  secrets,
+	})
+}
+
+// requeueRun 重新排队被中断的运行，沿用原运行的优先级和排队顺序
+func requeueRun(task *models.Task, run *models.TaskLog) (*models.TaskLog, error) {
+	sequence := run.Sequence
+	if sequence == 0 {
+		sequence = time.Now().UnixNano()
+	}
+	return insertQueuedRun(task, &models.TaskLog{
+		Priority: run.Priority,
+		Sequence: sequence,
+		Source:   "requeue",
+		Operator: run.Operator,
+		QueuedAt: time.Now(),
+		Attempt:  max(run.Attempt, 1) + 1,
+		RetryOf:  run.ID,
+		Params:   run.Params,
+		Secrets:  run.Secrets,
+	})
+}
+
+// insertQueuedRun 保存排队中的运行并创建进度信息
+func insertQueuedRun(task *models.Task, taskLog *models.TaskLog) (*models.TaskLog, error) {
+	taskLog.TaskID = task.ID
+	taskLog.Status = runStatusQueued
+	if err := app.DB.Create(taskLog).Error; err != nil {
+		return nil, err
+	}
+	storeSecrets(taskLog.ID, taskLog.Secrets)
+
+	progressMutex.Lock()
+	taskProgressMap[taskLog.ID] = &TaskProgress{
+		ID:       taskLog.ID,
+		TaskID:   task.ID,
+		TaskName: task.Name,
+		Status:   runStatusQueued,
+	}
+	progressMutex.Unlock()
+
+	publishRun(taskLog, task.Name, 0)
+	wakeDispatcher()
+	return taskLog, nil
+}
+
+// wakeDispatcher 唤醒调度，已有待处理的唤醒时忽略
+func wakeDispatcher() {
+	select {
+	case dispatchWake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchLoop 调度循环，done 关闭时退出
+func dispatchLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(dispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		dispatch()
+
+		select {
+		case <-dispatchWake:
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// dispatch 按优先级和排队顺序启动排队中的运行，直到达到全局或任务的并发限制
+func dispatch() {
+	if shuttingDown.Load() {
+		return
+	}
+
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+
+	limit := getConfig().MaxConcurrent
+	if runningTotal >= limit {
+		return
+	}
+
+	var runs []models.TaskLog
+	if err := app.DB.Preload("Task").Where("status = ?", runStatusQueued).
+		Order("priority desc, sequence asc, id asc").Find(&runs).Error; err != nil {
+		fmt.Printf("加载任务队列失败: %v\n", err)
+		return
+	}
+
+	for i := range runs {
+		if runningTotal >= limit {
+			return
+		}
+
+		run := &runs[i]
+		if run.Task.ID == 0 {
+			// 任务已被删除
+			finishQueuedRun(run.ID, runStatusCancelled, "任务已删除")
+			continue
+		}
+		run.Secrets = loadSecrets(run.ID)
+		if secretsLost(run.Task.Params, run) {
+			finishQueuedRun(run.ID, runStatusCancelled, "secret 参数的值只保存在内存中，服务重启后已丢失，请重新执行")
+			continue
+		}
+		if runningByTask[run.TaskID] >= taskConcurrency(&run.Task) {
+			continue
+		}
+
+		now := time.Now()
+		result := app.DB.Model(&models.TaskLog{}).
+			Where("id = ? AND status = ?", run.ID, runStatusQueued).
+			Updates(map[string]interface{}{"status": runStatusRunning, "start_time": now})
+		if result.Error != nil {
+			fmt.Printf("启动任务运行失败 [%d]: %v\n", run.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			// 已被取消
+			continue
+		}
+
+		run.Status = runStatusRunning
+		run.StartTime = now
+		startRun(run)
+	}
+}
+
+// startRun 在工作协程中执行已出队的运行，调用方持有 dispatchMutex
+func startRun(run *models.TaskLog) {
+	runningTotal++
+	runningByTask[run.TaskID]++
+
+	progressMutex.Lock()
+	progress, ok := taskProgressMap[run.ID]
+	if !ok {
+		progress = &TaskProgress{ID: run.ID, TaskID: run.TaskID}
+		taskProgressMap[run.ID] = progress
+	}
+	progress.TaskName = run.Task.Name
+	progress.Status = runStatusRunning
+	progress.StartTime = run.StartTime
+	progressMutex.Unlock()
+
+	publishRun(run, run.Task.Name, 0)
+
+	task := run.Task
+	taskLog := *run
+	taskLog.Task = models.Task{}
+
+	runningTasks.Add(1)
+	go func() {
+		defer runningTasks.Done()
+		defer finishRun(task.ID)
+		executeTask(&task, &taskLog)
+
+		// 服务关闭时被中断，按任务配置重新排队，重启后继续执行
+		if taskLog.Status == runStatusInterrupted {
+			requeueInterrupted(&task, &taskLog)
+		}
+	}()
+}
+
+// finishRun 运行结束后释放并发名额并唤醒调度
+func finishRun(taskID uint) {
+	dispatchMutex.Lock()
+	runningTotal--
+	if runningByTask[taskID]--; runningByTask[taskID] <= 0 {
+		delete(runningByTask, taskID)
+	}
+	dispatchMutex.Unlock()
+
+	wakeDispatcher()
+}
+
+// finishQueuedRun 结束排队中的运行，运行已出队时返回 false
+func finishQueuedRun(id uint, status, reason string) bool {
+	var run models.TaskLog
+	if err := app.DB.Preload("Task", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "name")
+	}).First(&run, id).Error; err != nil {
+		fmt.Printf("加载排队中的运行失败 [%d]: %v\n", id, err)
+		return false
+	}
+
+	now := time.Now()
+	result := app.DB.Model(&models.TaskLog{}).
+		Where("id = ? AND status = ?", id, runStatusQueued).
+		Updates(map[string]interface{}{"status": status, "error": reason, "end_time": now})
+	if result.Error != nil {
+		fmt.Printf("结束排队中的运行失败 [%d]: %v\n", id, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+	clearSecrets(id)
+
+	progressMutex.Lock()
+	if progress, ok := taskProgressMap[id]; ok {
+		progress.Status = status
+		progress.Error = reason
+		progress.EndTime = now
+		time.AfterFunc(time.Hour*2, func() {
+			progressMutex.Lock()
+			delete(taskProgressMap, id)
+			progressMutex.Unlock()
+		})
+	}
+	progressMutex.Unlock()
+
+	run.Status = status
+	run.Error = reason
+	run.EndTime = now
+	publishRun(&run, run.Task.Name, 0)
+	return true
+}
+
+// cancelQueuedRuns 取消任务所有排队中的运行，在任务删除时调用
+func cancelQueuedRuns(taskID uint, reason string) {
+	var ids []uint
+	if err := app.DB.Model(&models.TaskLog{}).
+		Where("task_id = ? AND status = ?", taskID, runStatusQueued).
+		Pluck("id", &ids).Error; err != nil {
+		fmt.Printf("加载任务 [%d] 排队中的运行失败: %v\n", taskID, err)
+		return
+	}
+	for _, id := range ids {
+		finishQueuedRun(id, runStatusCancelled, reason)
+	}
+}
+
+// hasQueuedRun 任务是否有排队中的运行
+func hasQueuedRun(taskID uint) bool {
+	var count int64
+	app.DB.Model(&models.TaskLog{}).Where("task_id = ? AND status = ?", taskID, runStatusQueued).Count(&count)
+	return count > 0
+}
+
+// getQueue 获取排队中和运行中的任务，排队中的按执行顺序排列
+func getQueue(c *fiber.Ctx) error {
+	var runs []models.TaskLog
+	if err := app.DB.Preload("Task", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "name")
+	}).Where("status IN ?", []string{runStatusQueued, runStatusRunning}).
+		Order("priority desc, sequence asc, id asc").Find(&runs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fmt.Sprintf("获取任务队列失败: %v", err),
+		})
+	}
+
+	checker := acl.For(c)
+	queued := make([]QueueItemVO, 0)
+	running := make([]QueueItemVO, 0)
+	position := 0
+	for _, run := range runs {
+		if run.Status == runStatusQueued {
+			// 位置按整个队列计算，包括当前用户无权查看的运行
+			position++
+		}
+		if !checker.CanAccessTask(run.TaskID) {
+			continue
+		}
+
+		item := QueueItemVO{
+			ID:        run.ID,
+			TaskID:    run.TaskID,
+			TaskName:  run.Task.Name,
+			Status:    run.Status,
+			Priority:  run.Priority,
+			Source:    run.Source,
+			Operator:  run.Operator,
+			QueuedAt:  run.QueuedAt,
+			StartTime: run.StartTime,
+		}
+		if run.Status == runStatusQueued {
+			item.Position = position
+			queued = append(queued, item)
+		} else {
+			running = append(running, item)
+		}
+	}
+
+	mc := getConfig()
+	return c.JSON(fiber.Map{
+		"queued":              queued,
+		"running":             running,
+		"max_concurrent":      mc.MaxConcurrent,
+		"task_max_concurrent": mc.TaskMaxConcurrent,
+	})
+}
+
+// loadQueuedRun 加载当前用户可以操作的排队中的运行，失败时已写入响应
+func loadQueuedRun(c *fiber.Ctx, id uint) (*models.TaskLog, error) {
+	var run models.TaskLog
+	if err := app.DB.Preload("Task").First(&run, id).Error; err != nil {
+		return nil, c.Status(404).JSON(fiber.Map{
+			"error": "运行记录不存在",
+		})
+	}
+	if !acl.For(c).CanAccessTask(run.TaskID) {
+		return nil, taskForbidden(c)
+	}
+	if run.Status != runStatusQueued {
+		return nil, c.Status(400).JSON(fiber.Map{
+			"error": "任务已开始执行或已结束，不能调整",
+		})
+	}
+	return &run, nil
+}
+
+// parseLogID 解析路径中的运行ID
+func parseLogID(c *fiber.Ctx) (uint, bool) {
+	id, err := strconv.ParseUint(c.Params("logId"), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// updateQueuePriority 调整排队中运行的优先级
+func updateQueuePriority(c *fiber.Ctx) error {
+	id, ok := parseLogID(c)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "无效的日志ID",
+		})
+	}
+
+	var req updatePriorityRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "无效的请求数据",
+		})
+	}
+
+	run, err := loadQueuedRun(c, id)
+	if run == nil {
+		return err
+	}
+
+	result := app.DB.Model(&models.TaskLog{}).
+		Where("id = ? AND status = ?", run.ID, runStatusQueued).
+		Update("priority", req.Priority)
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fmt.Sprintf("调整优先级失败: %v", result.Error),
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "任务已开始执行或已结束，不能调整",
+		})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "update", "task_queue", run.ID,
+		fmt.Sprintf("调整任务 %s 的运行 #%d 优先级：%d -> %d", run.Task.Name, run.ID, run.Priority, req.Priority))
+
+	wakeDispatcher()
+	return c.JSON(fiber.Map{"message": "优先级已调整"})
+}
+
+// reorderQueue 调整排队中运行的先后顺序。
+// 只在给出的运行之间交换排队顺序，优先级不同的运行仍按优先级执行
+func reorderQueue(c *fiber.Ctx) error {
+	var req reorderQueueRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "无效的请求数据",
+		})
+	}
+	if len(req.IDs) < 2 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "至少需要两个运行",
+		})
+	}
+
+	// 持有调度锁，避免调整过程中运行被启动
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+
+	var runs []models.TaskLog
+	if err := app.DB.Where("id IN ? AND status = ?", req.IDs, runStatusQueued).Find(&runs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fmt.Sprintf("获取任务队列失败: %v", err),
+		})
+	}
+	if len(runs) != len(req.IDs) {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "队列已变化，请刷新后重试",
+		})
+	}
+
+	checker := acl.For(c)
+	sequences := make([]int64, 0, len(runs))
+	for _, run := range runs {
+		if !checker.CanAccessTask(run.TaskID) {
+			return taskForbidden(c)
+		}
+		sequences = append(sequences, run.Sequence)
+	}
+	sort.Slice(sequences, func(i, j int) bool { return sequences[i] < sequences[j] })
+
+	err := app.DB.Transaction(func(tx *gorm.DB) error {
+		for i, id := range req.IDs {
+			if err := tx.Model(&models.TaskLog{}).Where("id = ?", id).
+				Update("sequence", sequences[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fmt.Sprintf("调整队列顺序失败: %v", err),
+		})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "update", "task_queue", 0, fmt.Sprintf("调整队列顺序：%v", req.IDs))
+
+	return c.JSON(fiber.Map{"message": "队列顺序已调整"})
+}
+
+// cancelQueuedRun 取消排队中的运行
+func cancelQueuedRun(c *fiber.Ctx) error {
+	id, ok := parseLogID(c)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "无效的日志ID",
+		})
+	}
+
+	run, err := loadQueuedRun(c, id)
+	if run == nil {
+		return err
+	}
+
+	reason := "排队中被取消"
+	if user := app.CurrentUser(c); user != nil {
+		reason = fmt.Sprintf("排队中被 %s 取消", user.Username)
+	}
+	if !finishQueuedRun(run.ID, runStatusCancelled, reason) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "任务已开始执行或已结束，不能取消",
+		})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "cancel", "task_queue", run.ID,
+		fmt.Sprintf("取消任务 %s 排队中的运行 #%d", run.Task.Name, run.ID))
+
+	return c.JSON(fiber.Map{"message": "已取消"})
+}
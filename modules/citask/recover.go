@@ -0,0 +1,114 @@
+package citask
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/andycai/unitool/models"
+)
+
+// checkpointInterval 运行中定期把已有输出写入任务日志，进程异常退出时保留部分输出
+const checkpointInterval = 5 * time.Second
+
+// recoverRuns 启动时处理上次进程退出时仍在运行的任务，必须在调度启动前调用。
+// 这些运行已经没有进程在执行，标记为中断并保留已写入的输出，任务开启自动重新排队时重新排队
+func recoverRuns() {
+	var runs []models.TaskLog
+	if err := app.DB.Preload("Task").Where("status = ?", runStatusRunning).Find(&runs).Error; err != nil {
+		fmt.Printf("加载中断的任务失败: %v\n", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range runs {
+		run := &runs[i]
+
+		// 最后一次写入输出的时间最接近进程退出的时间
+		endTime := run.UpdatedAt
+		if endTime.Before(run.StartTime) {
+			endTime = now
+		}
+
+		// 输出文件比最后一次保存的输出更完整
+		if tail, size, err := tailRunLog(runLogDir(run.ID)); err != nil {
+			fmt.Printf("读取中断任务的输出失败 [%d]: %v\n", run.ID, err)
+		} else if size > run.OutputSize {
+			run.Output = tail
+			run.OutputSize = size
+		}
+
+		run.Status = runStatusInterrupted
+		run.Error = "服务异常退出，任务被中断"
+		run.EndTime = endTime
+		run.Duration = int(endTime.Sub(run.StartTime).Seconds())
+		result := app.DB.Model(&models.TaskLog{}).
+			Where("id = ? AND status = ?", run.ID, runStatusRunning).
+			Updates(map[string]interface{}{
+				"status":      run.Status,
+				"output":      run.Output,
+				"output_size": run.OutputSize,
+				"error":       run.Error,
+				"end_time":    run.EndTime,
+				"duration":    run.Duration,
+			})
+		if result.Error != nil {
+			fmt.Printf("标记中断的任务失败 [%d]: %v\n", run.ID, result.Error)
+			continue
+		}
+		fmt.Printf("任务运行 [%d] 在上次退出时被中断\n", run.ID)
+
+		if run.Task.ID != 0 {
+			requeueInterrupted(&run.Task, run)
+		}
+	}
+}
+
+// requeueInterrupted 任务开启了自动重新排队且未超过尝试次数时，重新排队被中断的运行
+func requeueInterrupted(task *models.Task, run *models.TaskLog) {
+	if task.RequeueInterrupted != 1 {
+		return
+	}
+	// secret 参数的值不会保存，服务重启后无法再次使用
+	if usesSecrets(task.Params, run) {
+		fmt.Printf("任务运行 [%d] 使用了 secret 参数，不能重新排队\n", run.ID)
+		return
+	}
+	if max(run.Attempt, 1) >= getConfig().MaxAttempts {
+		fmt.Printf("任务运行 [%d] 已尝试 %d 次，不再重新排队\n", run.ID, max(run.Attempt, 1))
+		return
+	}
+
+	retry, err := requeueRun(task, run)
+	if err != nil {
+		fmt.Printf("重新排队任务运行 [%d] 失败: %v\n", run.ID, err)
+		return
+	}
+	fmt.Printf("任务运行 [%d] 已重新排队为 [%d]\n", run.ID, retry.ID)
+}
+
+// checkpointOutput 把运行中输出的末尾和大小写入任务日志
+func checkpointOutput(id uint, tail string, size int64) {
+	if err := app.DB.Model(&models.TaskLog{}).Where("id = ? AND status = ?", id, runStatusRunning).
+		Updates(map[string]interface{}{"output": tail, "output_size": size}).Error; err != nil {
+		fmt.Printf("保存任务输出失败 [%d]: %v\n", id, err)
+	}
+}
+
+// progressFromLog 根据任务日志构建进度信息，用于进度信息不在内存中的运行
+func progressFromLog(run *models.TaskLog) *TaskProgress {
+	progress := &TaskProgress{
+		ID:        run.ID,
+		TaskID:    run.TaskID,
+		TaskName:  run.Task.Name,
+		Status:    run.Status,
+		Output:    run.Output,
+		Error:     run.Error,
+		StartTime: run.StartTime,
+		EndTime:   run.EndTime,
+		Duration:  run.Duration,
+	}
+	if run.Status != runStatusQueued && run.Status != runStatusRunning {
+		progress.Progress = 100
+	}
+	return progress
+}
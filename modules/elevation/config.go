@@ -0,0 +1,49 @@
+package elevation
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/enum"
+)
+
+// moduleConfig 模块配置 [modules.elevation]
+type moduleConfig struct {
+	MaxDuration       int  `toml:"max_duration"`        // 单次申请的最长有效时长（分钟）
+	PendingExpire     int  `toml:"pending_expire"`      // 待审批的申请超过多少分钟未处理自动作废，0 表示不作废
+	CheckInterval     int  `toml:"check_interval"`      // 检查到期申请的间隔（秒）
+	AllowSelfApproval bool `toml:"allow_self_approval"` // 是否允许审批自己的申请
+}
+
+var conf atomic.Pointer[moduleConfig]
+
+// getConfig 获取当前生效的模块配置
+func getConfig() *moduleConfig {
+	return conf.Load()
+}
+
+// loadConfig 读取模块配置，未配置的字段使用默认值
+func loadConfig() (*moduleConfig, error) {
+	mc := &moduleConfig{
+		MaxDuration:   480,
+		PendingExpire: 1440,
+		CheckInterval: 30,
+	}
+
+	if err := core.DecodeModuleConfig(enum.ModuleElevation, mc); err != nil {
+		return nil, err
+	}
+
+	if mc.MaxDuration <= 0 {
+		return nil, fmt.Errorf("modules.elevation 的 max_duration 必须大于 0")
+	}
+	if mc.PendingExpire < 0 {
+		return nil, fmt.Errorf("modules.elevation 的 pending_expire 不能小于 0")
+	}
+	if mc.CheckInterval <= 0 {
+		return nil, fmt.Errorf("modules.elevation 的 check_interval 必须大于 0")
+	}
+
+	return mc, nil
+}
@@ -0,0 +1,10 @@
+package elevation
+
+import (
+	"github.com/andycai/unitool/models"
+)
+
+// 数据迁移
+func autoMigrate() error {
+	return app.DB.AutoMigrate(&models.Elevation{})
+}
@@ -0,0 +1,328 @@
+package elevation
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/adminlog"
+	"github.com/gofiber/fiber/v2"
+)
+
+type CreateElevationRequest struct {
+	Permissions []string `json:"permissions"` // 申请的权限编码
+	Reason      string   `json:"reason"`      // 申请理由
+	Duration    int      `json:"duration"`    // 有效时长（分钟）
+}
+
+type ReviewElevationRequest struct {
+	Note     string `json:"note"`     // 审批意见
+	Duration int    `json:"duration"` // 批准的时长（分钟），为 0 时使用申请的时长，不能超过申请的时长
+}
+
+// getMyElevationsAction 获取当前用户的申请
+func getMyElevationsAction(c *fiber.Ctx) error {
+	identity := core.CurrentIdentity(c)
+
+	var list []models.Elevation
+	if err := app.DB.Where("user_id = ?", identity.UserID).Order("created_at desc").Limit(100).Find(&list).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取申请列表失败"})
+	}
+	return c.JSON(list)
+}
+
+// getRequestablePermissionsAction 获取当前用户可以申请的权限，已拥有和被角色禁止的权限除外
+func getRequestablePermissionsAction(c *fiber.Ctx) error {
+	owned := app.CurrentPermissions(c)
+	if owned == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "请先登录"})
+	}
+
+	var all []models.Permission
+	if err := app.DB.Where("orphaned = ?", false).Order("code asc").Find(&all).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取权限列表失败"})
+	}
+
+	list := make([]models.Permission, 0, len(all))
+	for _, perm := range all {
+		if owned.Has(perm.Code) || owned.IsDenied(perm.Code) {
+			continue
+		}
+		list = append(list, perm)
+	}
+	return c.JSON(list)
+}
+
+// createElevationAction 申请临时提权
+func createElevationAction(c *fiber.Ctx) error {
+	var req CreateElevationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
+	}
+
+	identity := core.CurrentIdentity(c)
+	if identity.Method == core.AuthMethodAPIKey {
+		return c.Status(403).JSON(fiber.Map{"error": "不能使用访问令牌申请提权"})
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "请填写申请理由"})
+	}
+	if len(req.Reason) > 500 {
+		return c.Status(400).JSON(fiber.Map{"error": "申请理由过长"})
+	}
+	maxDuration := getConfig().MaxDuration
+	if req.Duration <= 0 || req.Duration > maxDuration {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("有效时长必须在 1 到 %d 分钟之间", maxDuration)})
+	}
+	if len(req.Permissions) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "请至少选择一个权限"})
+	}
+
+	currentUser := app.CurrentUser(c)
+	owned := app.CurrentPermissions(c)
+	if currentUser == nil || owned == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "请先登录"})
+	}
+
+	// 只能申请权限表中的具体权限，不能使用通配符
+	codes := make([]string, 0, len(req.Permissions))
+	for _, code := range req.Permissions {
+		if !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	var count int64
+	if err := app.DB.Model(&models.Permission{}).Where("code IN ?", codes).Count(&count).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取权限列表失败"})
+	}
+	if int(count) != len(codes) {
+		return c.Status(400).JSON(fiber.Map{"error": "申请的权限不存在"})
+	}
+	for _, code := range codes {
+		if owned.IsDenied(code) {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("角色禁止该权限，不能申请：%s", code)})
+		}
+		if owned.Has(code) {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("已拥有权限：%s", code)})
+		}
+	}
+
+	now := time.Now()
+	elevation := models.Elevation{
+		UserID:      currentUser.ID,
+		Username:    currentUser.Username,
+		Permissions: codes,
+		Reason:      req.Reason,
+		Duration:    req.Duration,
+		Status:      models.ElevationPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := app.DB.Create(&elevation).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "提交申请失败"})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "elevation_request", "elevation", elevation.ID,
+		fmt.Sprintf("%s，时长：%d 分钟，理由：%s", describe(&elevation), elevation.Duration, elevation.Reason))
+
+	return c.JSON(elevation)
+}
+
+// cancelElevationAction 申请人取消待审批的申请，或提前结束生效中的提权
+func cancelElevationAction(c *fiber.Ctx) error {
+	identity := core.CurrentIdentity(c)
+
+	var elevation models.Elevation
+	if err := app.DB.Where("user_id = ?", identity.UserID).First(&elevation, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "申请不存在"})
+	}
+	if elevation.Status != models.ElevationPending && !elevation.IsActive(time.Now()) {
+		return c.Status(400).JSON(fiber.Map{"error": "该申请已结束"})
+	}
+
+	ok, err := transition(&elevation, elevation.Status, map[string]interface{}{
+		"status":   models.ElevationCancelled,
+		"ended_at": time.Now(),
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "取消申请失败"})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "申请状态已变化，请刷新后重试"})
+	}
+	app.InvalidateUser(elevation.UserID)
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "elevation_cancel", "elevation", elevation.ID, describe(&elevation)+"，申请人取消")
+
+	return c.JSON(fiber.Map{"message": "已取消"})
+}
+
+// getElevationsAction 获取所有用户的申请
+func getElevationsAction(c *fiber.Ctx) error {
+	var total int64
+
+	page := c.QueryInt("page", 1)
+	pageSize := c.QueryInt("pageSize", 20)
+	status := c.Query("status")
+	username := c.Query("username")
+
+	query := app.DB.Model(&models.Elevation{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if username != "" {
+		query = query.Where("username LIKE ?", "%"+username+"%")
+	}
+
+	query.Count(&total)
+
+	var list []models.Elevation
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&list).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取申请列表失败"})
+	}
+
+	return c.JSON(fiber.Map{
+		"total": total,
+		"data":  list,
+	})
+}
+
+// loadForReview 加载要审批的申请，审批人不能审批自己的申请，除非配置允许。
+// 返回的申请为 nil 时已写入错误响应
+func loadForReview(c *fiber.Ctx) (*models.Elevation, *models.User, error) {
+	var elevation models.Elevation
+	if err := app.DB.First(&elevation, c.Params("id")).Error; err != nil {
+		return nil, nil, c.Status(404).JSON(fiber.Map{"error": "申请不存在"})
+	}
+
+	reviewer := app.CurrentUser(c)
+	if reviewer == nil {
+		return nil, nil, c.Status(401).JSON(fiber.Map{"error": "请先登录"})
+	}
+	if reviewer.ID == elevation.UserID && !getConfig().AllowSelfApproval {
+		return nil, nil, c.Status(403).JSON(fiber.Map{"error": "不能审批自己的申请"})
+	}
+	if elevation.Status != models.ElevationPending {
+		return nil, nil, c.Status(400).JSON(fiber.Map{"error": "该申请不是待审批状态"})
+	}
+	return &elevation, reviewer, nil
+}
+
+// approveElevationAction 批准申请，审批人必须拥有申请的全部权限，批准后立即生效
+func approveElevationAction(c *fiber.Ctx) error {
+	var req ReviewElevationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
+	}
+
+	elevation, reviewer, err := loadForReview(c)
+	if elevation == nil {
+		return err
+	}
+	if !app.CurrentPermissions(c).All(elevation.Permissions...) {
+		return c.Status(403).JSON(fiber.Map{"error": "审批人必须拥有申请的全部权限"})
+	}
+
+	duration := elevation.Duration
+	if req.Duration < 0 || req.Duration > duration {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("批准的时长必须在 1 到 %d 分钟之间", duration)})
+	}
+	if req.Duration > 0 {
+		duration = req.Duration
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(duration) * time.Minute)
+	ok, err := transition(elevation, models.ElevationPending, map[string]interface{}{
+		"status":        models.ElevationApproved,
+		"duration":      duration,
+		"approver_id":   reviewer.ID,
+		"approver_name": reviewer.Username,
+		"review_note":   req.Note,
+		"reviewed_at":   now,
+		"expires_at":    expiresAt,
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "审批失败"})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "申请状态已变化，请刷新后重试"})
+	}
+	app.InvalidateUser(elevation.UserID)
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "elevation_approve", "elevation", elevation.ID,
+		fmt.Sprintf("%s，时长：%d 分钟，到期时间：%s", describe(elevation), duration, expiresAt.Format("2006-01-02 15:04:05")))
+
+	return c.JSON(fiber.Map{"message": "已批准", "expires_at": expiresAt})
+}
+
+// rejectElevationAction 拒绝申请
+func rejectElevationAction(c *fiber.Ctx) error {
+	var req ReviewElevationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
+	}
+
+	elevation, reviewer, err := loadForReview(c)
+	if elevation == nil {
+		return err
+	}
+
+	ok, err := transition(elevation, models.ElevationPending, map[string]interface{}{
+		"status":        models.ElevationRejected,
+		"approver_id":   reviewer.ID,
+		"approver_name": reviewer.Username,
+		"review_note":   req.Note,
+		"reviewed_at":   time.Now(),
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "审批失败"})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "申请状态已变化，请刷新后重试"})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "elevation_reject", "elevation", elevation.ID, fmt.Sprintf("%s，意见：%s", describe(elevation), req.Note))
+
+	return c.JSON(fiber.Map{"message": "已拒绝"})
+}
+
+// revokeElevationAction 撤销生效中的提权，立即失效
+func revokeElevationAction(c *fiber.Ctx) error {
+	var elevation models.Elevation
+	if err := app.DB.First(&elevation, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "申请不存在"})
+	}
+	if !elevation.IsActive(time.Now()) {
+		return c.Status(400).JSON(fiber.Map{"error": "该提权未生效"})
+	}
+
+	ok, err := transition(&elevation, models.ElevationApproved, map[string]interface{}{
+		"status":   models.ElevationRevoked,
+		"ended_at": time.Now(),
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "撤销失败"})
+	}
+	if !ok {
+		return c.Status(409).JSON(fiber.Map{"error": "申请状态已变化，请刷新后重试"})
+	}
+	app.InvalidateUser(elevation.UserID)
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "elevation_revoke", "elevation", elevation.ID, describe(&elevation)+"，已撤销")
+
+	return c.JSON(fiber.Map{"message": "已撤销"})
+}
@@ -0,0 +1,103 @@
+package elevation
+
+import (
+	"context"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/enum"
+	"github.com/gofiber/fiber/v2"
+)
+
+var app *core.App
+
+type elevationModule struct {
+	core.BaseModule
+	done chan struct{}
+}
+
+func init() {
+	core.RegisterModule(&elevationModule{}, core.ModuleInfo{
+		Name:    enum.ModuleElevation,
+		Depends: []string{enum.ModuleUser, enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "elevation:list", Name: "提权申请列表", Description: "查看所有用户的临时提权申请"},
+			{Code: "elevation:approve", Name: "审批提权申请", Description: "批准、拒绝或撤销临时提权"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin", Name: "临时提权", Path: "/admin/elevations", Icon: "elevation", Sort: 8},
+		},
+	})
+}
+
+func (m *elevationModule) Awake(a *core.App) error {
+	app = a
+
+	mc, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	conf.Store(mc)
+
+	if err := autoMigrate(); err != nil {
+		return err
+	}
+
+	// 批准且未到期的申请计入用户的有效权限
+	core.RegisterPermissionGrantor(&elevationGrantor{})
+
+	return nil
+}
+
+func (m *elevationModule) Start() error {
+	// 启动时先处理停机期间到期的申请
+	expireElevations()
+
+	m.done = make(chan struct{})
+	go expireLoop(m.done)
+
+	return nil
+}
+
+func (m *elevationModule) Stop(ctx context.Context) error {
+	if m.done != nil {
+		close(m.done)
+		m.done = nil
+	}
+	return nil
+}
+
+func (m *elevationModule) OnConfigChange(old, new *core.Config) error {
+	mc, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	conf.Store(mc)
+
+	return nil
+}
+
+func (m *elevationModule) AddAuthRouters() error {
+	// admin，所有登录用户都可以申请，审批需要权限
+	app.RouterAdmin.Get("/elevations", func(c *fiber.Ctx) error {
+		return c.Render("admin/elevations", fiber.Map{
+			"Title": "临时提权",
+			"Scripts": []string{
+				"/static/js/admin/elevations.js",
+			},
+		}, "admin/layout")
+	})
+
+	// api，当前用户的申请
+	app.RouterApi.Get("/elevations/mine", core.DenyAPIKey, getMyElevationsAction)
+	app.RouterApi.Get("/elevations/permissions", core.DenyAPIKey, getRequestablePermissionsAction)
+	app.RouterApi.Post("/elevations", core.DenyAPIKey, createElevationAction)
+	app.RouterApi.Post("/elevations/:id/cancel", core.DenyAPIKey, cancelElevationAction)
+
+	// api，审批
+	app.RouterApi.Get("/elevations", app.HasPermission("elevation:list"), getElevationsAction)
+	app.RouterApi.Post("/elevations/:id/approve", app.HasPermission("elevation:approve"), approveElevationAction)
+	app.RouterApi.Post("/elevations/:id/reject", app.HasPermission("elevation:approve"), rejectElevationAction)
+	app.RouterApi.Post("/elevations/:id/revoke", app.HasPermission("elevation:approve"), revokeElevationAction)
+
+	return nil
+}
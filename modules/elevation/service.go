@@ -0,0 +1,129 @@
+package elevation
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/adminlog"
+)
+
+// elevationGrantor 将批准且未到期的申请计入用户的有效权限
+type elevationGrantor struct{}
+
+func (g *elevationGrantor) Grants(userID uint) ([]string, time.Time, error) {
+	var list []models.Elevation
+	now := time.Now()
+	if err := app.DB.Where("user_id = ? AND status = ? AND expires_at > ?", userID, models.ElevationApproved, now).
+		Find(&list).Error; err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var codes []string
+	var until time.Time
+	for _, e := range list {
+		codes = append(codes, e.Permissions...)
+		if until.IsZero() || e.ExpiresAt.Before(until) {
+			until = *e.ExpiresAt
+		}
+	}
+	return codes, until, nil
+}
+
+// transition 仅当申请仍处于 from 状态时更新，返回是否更新成功，避免并发审批或到期处理互相覆盖
+func transition(e *models.Elevation, from string, updates map[string]interface{}) (bool, error) {
+	updates["updated_at"] = time.Now()
+	result := app.DB.Model(&models.Elevation{}).
+		Where("id = ? AND status = ?", e.ID, from).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// describe 申请内容的描述，用于操作日志
+func describe(e *models.Elevation) string {
+	return fmt.Sprintf("用户 %s 的临时提权 #%d，权限：%s", e.Username, e.ID, strings.Join(e.Permissions, ", "))
+}
+
+// expireElevations 将到期的申请标记为已到期，超时未审批的申请自动作废
+func expireElevations() {
+	now := time.Now()
+
+	var expired []models.Elevation
+	if err := app.DB.Where("status = ? AND expires_at <= ?", models.ElevationApproved, now).Find(&expired).Error; err != nil {
+		log.Printf("查询到期的临时提权失败: %v", err)
+		return
+	}
+
+	userIDs := make([]uint, 0, len(expired))
+	for i := range expired {
+		e := &expired[i]
+		ok, err := transition(e, models.ElevationApproved, map[string]interface{}{
+			"status":   models.ElevationExpired,
+			"ended_at": now,
+		})
+		if err != nil {
+			log.Printf("更新临时提权 #%d 状态失败: %v", e.ID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		userIDs = append(userIDs, e.UserID)
+		adminlog.CreateSystemAdminLog("elevation_expire", "elevation", e.ID, describe(e)+"，已到期")
+	}
+	// 权限检查本身会过滤到期的申请，这里确保缓存及时刷新
+	app.InvalidateUser(userIDs...)
+
+	pendingExpire := getConfig().PendingExpire
+	if pendingExpire <= 0 {
+		return
+	}
+
+	var stale []models.Elevation
+	deadline := now.Add(-time.Duration(pendingExpire) * time.Minute)
+	if err := app.DB.Where("status = ? AND created_at <= ?", models.ElevationPending, deadline).Find(&stale).Error; err != nil {
+		log.Printf("查询超时的提权申请失败: %v", err)
+		return
+	}
+	for i := range stale {
+		e := &stale[i]
+		ok, err := transition(e, models.ElevationPending, map[string]interface{}{
+			"status":   models.ElevationExpired,
+			"ended_at": now,
+		})
+		if err != nil {
+			log.Printf("更新提权申请 #%d 状态失败: %v", e.ID, err)
+			continue
+		}
+		if ok {
+			adminlog.CreateSystemAdminLog("elevation_expire", "elevation", e.ID, describe(e)+"，超时未审批")
+		}
+	}
+}
+
+// expireLoop 定期处理到期的申请，done 关闭时退出
+func expireLoop(done <-chan struct{}) {
+	interval := time.Duration(getConfig().CheckInterval) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			expireElevations()
+
+			// 配置变更后调整检查间隔
+			if next := time.Duration(getConfig().CheckInterval) * time.Second; next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		case <-done:
+			return
+		}
+	}
+}
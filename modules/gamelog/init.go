@@ -13,7 +13,17 @@ type gamelogModule struct {
 }
 
 func init() {
-	core.RegisterModule(&gamelogModule{}, enum.ModulePriorityGamelog)
+	core.RegisterModule(&gamelogModule{}, core.ModuleInfo{
+		Name:    enum.ModuleGamelog,
+		Depends: []string{enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "gamelog:list", Name: "游戏日志", Description: "查看游戏日志"},
+			{Code: "gamelog:delete", Name: "删除游戏日志", Description: "删除游戏日志"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin/game", Name: "游戏日志", Path: "/admin/gamelog", Icon: "gamelog", Sort: 1, Permission: "gamelog:list"},
+		},
+	})
 }
 
 func (m *gamelogModule) Awake(a *core.App) error {
@@ -2,9 +2,12 @@ package modules
 
 // 新增的模块必须在这里进行导入，不然模块 init 方法不会执行
 import (
+	_ "github.com/andycai/unitool/modules/acl"
 	_ "github.com/andycai/unitool/modules/adminlog"
+	_ "github.com/andycai/unitool/modules/apikey"
 	_ "github.com/andycai/unitool/modules/browse"
 	_ "github.com/andycai/unitool/modules/citask"
+	_ "github.com/andycai/unitool/modules/elevation"
 	_ "github.com/andycai/unitool/modules/gamelog"
 	_ "github.com/andycai/unitool/modules/login"
 	_ "github.com/andycai/unitool/modules/menu"
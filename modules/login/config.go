@@ -0,0 +1,98 @@
+package login
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/enum"
+)
+
+// moduleConfig 模块配置 [modules.login]
+type moduleConfig struct {
+	MaxFailures   int `toml:"max_failures"`    // 同一用户名连续失败多少次后锁定
+	IPMaxFailures int `toml:"ip_max_failures"` // 同一IP连续失败多少次后锁定
+	LockoutBase   int `toml:"lockout_base"`    // 首次锁定时长（秒），之后每次失败翻倍
+	LockoutMax    int `toml:"lockout_max"`     // 最长锁定时长（秒）
+	FailureWindow int `toml:"failure_window"`  // 失败计数的统计窗口（秒），超过后重新计数
+
+	Providers []providerConfig `toml:"providers"` // 外部身份源，[[modules.login.providers]]
+
+	providers map[string]Provider // 根据 Providers 创建的身份源，按名称索引
+}
+
+// providerConfig 外部身份源配置
+type providerConfig struct {
+	Name         string        `toml:"name"`          // 唯一名称，用于登录请求和回调地址
+	Type         string        `toml:"type"`          // oidc 或 ldap
+	DisplayName  string        `toml:"display_name"`  // 登录页显示的名称
+	DefaultRole  string        `toml:"default_role"`  // 没有匹配的映射规则时使用的角色名称，为空时拒绝登录
+	RoleMappings []roleMapping `toml:"role_mappings"` // 用户组到角色的映射规则，用户获得所有匹配规则的角色
+
+	// OIDC 授权码模式
+	Issuer        string   `toml:"issuer"`         // 发行方地址，用于获取 /.well-known/openid-configuration
+	ClientID      string   `toml:"client_id"`      // 客户端ID
+	ClientSecret  string   `toml:"client_secret"`  // 客户端密钥
+	RedirectURL   string   `toml:"redirect_url"`   // 回调地址，例如 https://host/login/oidc/<name>/callback
+	Scopes        []string `toml:"scopes"`         // 请求的 scope，默认 openid profile email
+	UsernameClaim string   `toml:"username_claim"` // 作为用户名的声明，默认 preferred_username
+	GroupsClaim   string   `toml:"groups_claim"`   // 用户组声明，默认 groups
+
+	// LDAP 绑定认证
+	URL                string `toml:"url"`                  // 例如 ldaps://ldap.example.com:636
+	StartTLS           bool   `toml:"start_tls"`            // ldap:// 连接是否升级为 TLS
+	InsecureSkipVerify bool   `toml:"insecure_skip_verify"` // 跳过证书校验，仅用于测试环境
+	BindDN             string `toml:"bind_dn"`              // 查询用户使用的服务账号，为空时匿名查询
+	BindPassword       string `toml:"bind_password"`        // 服务账号密码
+	BaseDN             string `toml:"base_dn"`              // 查询用户的起始节点
+	UserFilter         string `toml:"user_filter"`          // 查询用户的过滤器，%s 替换为转义后的用户名，默认 (uid=%s)
+	UsernameAttribute  string `toml:"username_attribute"`   // 作为用户名的属性，默认 uid
+	NicknameAttribute  string `toml:"nickname_attribute"`   // 作为昵称的属性，默认 cn
+	GroupAttribute     string `toml:"group_attribute"`      // 用户组属性，默认 memberOf
+}
+
+// roleMapping 用户组到角色的映射规则
+type roleMapping struct {
+	Group string `toml:"group"` // 用户组名称或完整 DN，不区分大小写
+	Role  string `toml:"role"`  // 角色名称
+}
+
+var conf atomic.Pointer[moduleConfig]
+
+// getConfig 获取当前生效的模块配置
+func getConfig() *moduleConfig {
+	return conf.Load()
+}
+
+// loadConfig 读取模块配置，未配置的字段使用默认值
+func loadConfig() (*moduleConfig, error) {
+	mc := &moduleConfig{
+		MaxFailures:   5,
+		IPMaxFailures: 20,
+		LockoutBase:   60,
+		LockoutMax:    3600,
+		FailureWindow: 3600,
+	}
+
+	if err := core.DecodeModuleConfig(enum.ModuleLogin, mc); err != nil {
+		return nil, err
+	}
+
+	if mc.MaxFailures <= 0 || mc.IPMaxFailures <= 0 {
+		return nil, fmt.Errorf("modules.login 的 max_failures 和 ip_max_failures 必须大于 0")
+	}
+	if mc.LockoutBase <= 0 || mc.LockoutMax < mc.LockoutBase {
+		return nil, fmt.Errorf("modules.login 的 lockout_base 必须大于 0 且不大于 lockout_max")
+	}
+	if mc.FailureWindow <= 0 {
+		return nil, fmt.Errorf("modules.login 的 failure_window 必须大于 0")
+	}
+
+	providers, err := buildProviders(mc.Providers)
+	if err != nil {
+		return nil, err
+	}
+	mc.providers = providers
+
+	return mc, nil
+}
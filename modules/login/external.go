@@ -0,0 +1,275 @@
+package login
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/adminlog"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcStateCookie      = "oidc_state"     // 保存授权请求参数的 Cookie
+	oidcStatePurpose     = "oidc_state"     // 授权请求参数令牌的用途
+	oidcStateExpire      = 10 * time.Minute // 完成身份源登录的时限
+	externalTokenPurpose = "external"       // 外部登录令牌的用途
+	externalTokenExpire  = time.Minute      // 回调后换取登录结果的时限
+)
+
+type ExternalLoginRequest struct {
+	LoginToken string `json:"login_token"`
+	Remember   bool   `json:"remember"`
+}
+
+// randomToken 生成 URL 安全的随机字符串
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// getProvidersAction 获取可用的外部身份源，登录页据此显示登录方式
+func getProvidersAction(c *fiber.Ctx) error {
+	list := make([]fiber.Map, 0)
+	for _, cfg := range getConfig().Providers {
+		p, ok := getProvider(cfg.Name)
+		if !ok {
+			continue
+		}
+		list = append(list, fiber.Map{
+			"name":         p.Name(),
+			"type":         p.Type(),
+			"display_name": p.DisplayName(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"data": list,
+	})
+}
+
+// externalPasswordLogin 使用外部身份源校验用户名和密码
+func externalPasswordLogin(c *fiber.Ctx, req *LoginRequest) error {
+	provider, ok := getProvider(req.Provider)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "身份源不存在"})
+	}
+	pp, ok := provider.(PasswordProvider)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "该身份源不支持密码登录"})
+	}
+
+	// 锁定计数以身份源和用户名区分，避免与同名的本地账号互相影响
+	lockKey := provider.Name() + ":" + req.Username
+	if locked, err := checkLockout(c, lockKey); locked || err != nil {
+		return err
+	}
+
+	ext, err := pp.Authenticate(c.UserContext(), req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, errInvalidCredentials) {
+			attemptFailed(c, 0, lockKey, "login_failed", "外部身份源认证失败")
+			return c.Status(401).JSON(fiber.Map{"error": "用户名或密码错误"})
+		}
+		log.Printf("身份源 %s 认证失败: %v", provider.Name(), err)
+		return c.Status(502).JSON(fiber.Map{"error": "身份源暂时不可用"})
+	}
+
+	user, err := provisionExternalUser(c, provider, ext)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := clearFailures(lockKey); err != nil {
+		log.Printf("清除用户 %s 的登录失败计数失败: %v", lockKey, err)
+	}
+
+	if totpRequired(user) {
+		return mfaChallenge(c, user, req.Remember)
+	}
+	return completeLogin(c, user, req.Remember, nil)
+}
+
+// provisionExternalUser 查找或创建外部用户，首次登录创建账号时记录操作日志
+func provisionExternalUser(c *fiber.Ctx, provider Provider, ext *ExternalIdentity) (*models.User, error) {
+	user, created, err := provisionUser(provider, ext)
+	if err != nil {
+		adminlog.CreateAdminLogAs(c, 0, ext.Username, "login_failed", "user", 0,
+			fmt.Sprintf("身份源 %s 登录被拒绝：%v", provider.Name(), err))
+		return nil, err
+	}
+
+	if created {
+		names := make([]string, 0, len(user.Roles))
+		for _, role := range user.Roles {
+			names = append(names, role.Name)
+		}
+		adminlog.CreateAdminLogAs(c, user.ID, user.Username, "provision", "user", user.ID,
+			fmt.Sprintf("通过身份源 %s 创建用户，角色：%s", provider.Name(), strings.Join(names, "、")))
+	}
+	return user, nil
+}
+
+// oidcStartAction 跳转到身份源登录，授权请求参数签名后保存在 Cookie 中
+func oidcStartAction(c *fiber.Ctx) error {
+	provider, ok := getProvider(c.Params("provider"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "身份源不存在"})
+	}
+	rp, ok := provider.(RedirectProvider)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "该身份源不支持跳转登录"})
+	}
+
+	values := make([]string, 3)
+	for i := range values {
+		v, err := randomToken()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "生成登录请求失败"})
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := rp.AuthCodeURL(c.UserContext(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("获取身份源 %s 的授权地址失败: %v", provider.Name(), err)
+		return c.Status(502).JSON(fiber.Map{"error": "身份源暂时不可用"})
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose":  oidcStatePurpose,
+		"provider": provider.Name(),
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"remember": c.Query("remember") == "1",
+		"exp":      now.Add(oidcStateExpire).Unix(),
+		"iat":      now.Unix(),
+	})
+	signed, err := token.SignedString([]byte(app.Config().Auth.JWTSecret))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "生成登录请求失败"})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    signed,
+		Path:     "/login/oidc",
+		Expires:  now.Add(oidcStateExpire),
+		HTTPOnly: true,
+		Secure:   c.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteLaxMode, // 身份源回调是跨站的顶层跳转
+	})
+
+	return c.Redirect(authURL)
+}
+
+// oidcCallbackAction 身份源回调，校验 state 后换取用户信息，再跳转回登录页换取登录结果
+func oidcCallbackAction(c *fiber.Ctx) error {
+	fail := func(msg string) error {
+		return c.Redirect("/login#error=" + url.QueryEscape(msg))
+	}
+
+	provider, ok := getProvider(c.Params("provider"))
+	if !ok {
+		return fail("身份源不存在")
+	}
+	rp, ok := provider.(RedirectProvider)
+	if !ok {
+		return fail("该身份源不支持跳转登录")
+	}
+
+	// Cookie 只能使用一次
+	raw := c.Cookies(oidcStateCookie)
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Path:     "/login/oidc",
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+	})
+
+	if msg := c.Query("error"); msg != "" {
+		if desc := c.Query("error_description"); desc != "" {
+			msg += ": " + desc
+		}
+		return fail("身份源登录失败：" + msg)
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(app.Config().Auth.JWTSecret), nil
+	})
+	if err != nil || !token.Valid || claims["purpose"] != oidcStatePurpose || claims["provider"] != provider.Name() {
+		return fail("登录请求已过期，请重新登录")
+	}
+
+	state, _ := claims["state"].(string)
+	if state == "" || c.Query("state") != state {
+		return fail("登录请求无效，请重新登录")
+	}
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+	remember, _ := claims["remember"].(bool)
+
+	ext, err := rp.Exchange(c.UserContext(), c.Query("code"), nonce, verifier)
+	if err != nil {
+		log.Printf("身份源 %s 回调处理失败: %v", provider.Name(), err)
+		return fail("身份源登录失败")
+	}
+
+	user, err := provisionExternalUser(c, provider, ext)
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	loginToken, err := signPendingToken(externalTokenPurpose, user.ID, remember, externalTokenExpire)
+	if err != nil {
+		return fail("生成登录令牌失败")
+	}
+
+	// 令牌放在 URL 片段中，不会发送到服务器或出现在访问日志里
+	return c.Redirect("/login#login_token=" + url.QueryEscape(loginToken))
+}
+
+// externalLoginAction 使用回调返回的外部登录令牌完成登录
+func externalLoginAction(c *fiber.Ctx) error {
+	var req ExternalLoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
+	}
+
+	userID, remember, err := parsePendingToken(externalTokenPurpose, req.LoginToken)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+	remember = remember || req.Remember
+
+	var user models.User
+	if err := app.DB.Preload("Roles").First(&user, userID).Error; err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "用户不存在"})
+	}
+	if user.Status != 1 {
+		return c.Status(403).JSON(fiber.Map{"error": "账号已被禁用"})
+	}
+
+	if totpRequired(&user) {
+		return mfaChallenge(c, &user, remember)
+	}
+	return completeLogin(c, &user, remember, nil)
+}
@@ -0,0 +1,154 @@
+package login
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"gorm.io/gorm"
+)
+
+// 同一进程内串行更新失败计数，避免并发请求漏记
+var guardMutex sync.Mutex
+
+// attemptPruneInterval 清理过期失败计数的间隔
+const attemptPruneInterval = 10 * time.Minute
+
+// normalizeUsername 统一用户名的大小写，避免通过大小写变化绕过计数
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// lockedFor 返回用户名或IP的剩余锁定时长，未锁定时返回 0
+func lockedFor(username, ip string) (time.Duration, error) {
+	var attempts []models.LoginAttempt
+	err := app.DB.Where("(kind = ? AND value = ?) OR (kind = ? AND value = ?)",
+		models.LoginAttemptUsername, normalizeUsername(username), models.LoginAttemptIP, ip).
+		Find(&attempts).Error
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var remaining time.Duration
+	for _, attempt := range attempts {
+		if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+			remaining = max(remaining, attempt.LockedUntil.Sub(now))
+		}
+	}
+	return remaining, nil
+}
+
+// recordFailure 记录一次失败，分别累加用户名和IP的计数，返回连续失败次数和锁定时长。
+// username 为空时只累加IP的计数，返回IP的连续失败次数，用于不存在的用户名，
+// 避免任意用户名不断产生新的计数记录
+func recordFailure(username, ip string) (int, time.Duration, error) {
+	guardMutex.Lock()
+	defer guardMutex.Unlock()
+
+	mc := getConfig()
+	ipFailures, ipLockout, err := incrementAttempt(models.LoginAttemptIP, ip, mc.IPMaxFailures)
+	if err != nil {
+		return 0, 0, err
+	}
+	if username == "" {
+		return ipFailures, ipLockout, nil
+	}
+
+	failures, lockout, err := incrementAttempt(models.LoginAttemptUsername, normalizeUsername(username), mc.MaxFailures)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return failures, max(lockout, ipLockout), nil
+}
+
+// incrementAttempt 累加失败计数，达到阈值后按指数退避计算锁定时长
+func incrementAttempt(kind, value string, threshold int) (int, time.Duration, error) {
+	mc := getConfig()
+	now := time.Now()
+
+	var attempt models.LoginAttempt
+	err := app.DB.Where("kind = ? AND value = ?", kind, value).First(&attempt).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, 0, err
+	}
+	if err != nil {
+		attempt = models.LoginAttempt{Kind: kind, Value: value, CreatedAt: now}
+	}
+
+	// 超过统计窗口且未处于锁定状态时重新计数
+	window := time.Duration(mc.FailureWindow) * time.Second
+	if now.Sub(attempt.LastFailedAt) > window && (attempt.LockedUntil == nil || attempt.LockedUntil.Before(now)) {
+		attempt.Failures = 0
+		attempt.LockedUntil = nil
+	}
+
+	attempt.Failures++
+	attempt.LastFailedAt = now
+	attempt.UpdatedAt = now
+
+	var lockout time.Duration
+	if attempt.Failures >= threshold {
+		lockout = lockoutDuration(attempt.Failures - threshold)
+		lockedUntil := now.Add(lockout)
+		attempt.LockedUntil = &lockedUntil
+	}
+
+	if err := app.DB.Save(&attempt).Error; err != nil {
+		return 0, 0, err
+	}
+	return attempt.Failures, lockout, nil
+}
+
+// lockoutDuration 第 n 次超过阈值时的锁定时长：lockout_base * 2^n，不超过 lockout_max
+func lockoutDuration(n int) time.Duration {
+	mc := getConfig()
+	base := time.Duration(mc.LockoutBase) * time.Second
+	limit := time.Duration(mc.LockoutMax) * time.Second
+
+	lockout := base
+	for i := 0; i < n && lockout < limit; i++ {
+		lockout *= 2
+	}
+	return min(lockout, limit)
+}
+
+// clearFailures 登录成功后清除用户名的失败计数，IP 计数只能等待过期或由管理员清除
+func clearFailures(username string) error {
+	return app.DB.Where("kind = ? AND value = ?", models.LoginAttemptUsername, normalizeUsername(username)).
+		Delete(&models.LoginAttempt{}).Error
+}
+
+// pruneAttempts 删除已超过统计窗口且未处于锁定状态的失败计数，这些计数下次失败时也会重新开始
+func pruneAttempts() {
+	now := time.Now()
+	expired := now.Add(-time.Duration(getConfig().FailureWindow) * time.Second)
+	result := app.DB.Where("last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?)", expired, now).
+		Delete(&models.LoginAttempt{})
+	if result.Error != nil {
+		log.Printf("清理过期的登录失败计数失败: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("已清理 %d 条过期的登录失败计数", result.RowsAffected)
+	}
+}
+
+// pruneLoop 定期清理过期的失败计数，done 关闭时退出
+func pruneLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(attemptPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			pruneAttempts()
+		case <-done:
+			return
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package login
 
 import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/andycai/unitool/core"
 	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/adminlog"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -14,6 +18,7 @@ type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Remember bool   `json:"remember"`
+	Provider string `json:"provider"` // 外部身份源名称，为空时使用本地账号登录
 }
 
 type LoginResponse struct {
@@ -21,6 +26,10 @@ type LoginResponse struct {
 	User  models.User `json:"user"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type ChangePasswordRequest struct {
 	Username    string `json:"username"`
 	OldPassword string `json:"old_password"`
@@ -34,42 +43,56 @@ func loginAction(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
 	}
 
+	if req.Provider != "" {
+		return externalPasswordLogin(c, &req)
+	}
+
+	// 用户名或IP失败次数过多时拒绝登录
+	if locked, err := checkLockout(c, req.Username); locked || err != nil {
+		return err
+	}
+
 	var user models.User
-	if err := app.DB.Preload("Role.Permissions").Where("username = ?", req.Username).First(&user).Error; err != nil {
+	if err := app.DB.Preload("Roles").Where("username = ?", req.Username).First(&user).Error; err != nil {
+		unknownUserFailed(c, req.Username)
 		return c.Status(401).JSON(fiber.Map{"error": "用户名或密码错误"})
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		attemptFailed(c, user.ID, user.Username, "login_failed", "密码错误")
 		return c.Status(401).JSON(fiber.Map{"error": "用户名或密码错误"})
 	}
+	if user.Status != 1 {
+		return c.Status(403).JSON(fiber.Map{"error": "账号已被禁用"})
+	}
+
+	// 启用或被角色要求两步验证时，先返回验证令牌，完成第二步后才创建会话
+	if totpRequired(&user) {
+		return mfaChallenge(c, &user, req.Remember)
+	}
+
+	return completeLogin(c, &user, req.Remember, nil)
+}
+
+// completeLogin 完成登录：签发令牌、创建会话并返回用户信息，extra 中的字段合并到响应数据
+func completeLogin(c *fiber.Ctx, user *models.User, remember bool, extra fiber.Map) error {
+	if err := clearFailures(user.Username); err != nil {
+		log.Printf("清除用户 %s 的登录失败计数失败: %v", user.Username, err)
+	}
 
 	// 根据记住我选项设置不同的过期时间
-	var expireTime time.Time
-	if req.Remember {
-		expireTime = time.Now().Add(time.Hour * 24 * 30) // 30天
-		core.SetSessionExpiration(c, time.Hour*24*30)
-	} else {
-		expireTime = time.Now().Add(time.Duration(app.Config.Auth.TokenExpire) * time.Second)
-	}
-
-	// 生成 JWT token
-	claims := jwt.MapClaims{
-		"sub":      user.ID,
-		"user_id":  user.ID,
-		"username": user.Username,
-		"role_id":  user.RoleID,
-		"exp":      expireTime.Unix(),
-		"iat":      time.Now().Unix(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(app.Config.Auth.JWTSecret))
+	if remember {
+		core.SetSessionExpiration(c, time.Hour*24*30) // 30天
+	}
+
+	// 签发短期访问令牌和刷新令牌
+	tokens, err := app.Tokens.IssueTokens(user, remember)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "生成token失败"})
 	}
 
 	// 更新最后登录时间
-	app.DB.Model(&user).Update("last_login", time.Now())
+	app.DB.Model(user).Update("last_login", time.Now())
 
 	// 存储会话
 	if err := core.StoreSession(c, user.ID); err != nil {
@@ -79,60 +102,128 @@ func loginAction(c *fiber.Ctx) error {
 	// 清除密码字段
 	user.Password = ""
 
+	// 有效权限包括继承的角色和临时授予的权限，通配符按权限表展开，前端据此控制按钮显示
+	roles, err := core.EffectiveRoles(app.DB, user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取用户权限失败"})
+	}
+	temporary, _, err := core.ExtraGrants(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取用户权限失败"})
+	}
+	granted, err := core.GrantedPermissions(app.DB, core.NewRolePermissionSet(roles, temporary...))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取用户权限失败"})
+	}
+	permissions := make([]string, 0, len(granted))
+	for _, perm := range granted {
+		permissions = append(permissions, perm.Code)
+	}
+
 	// 构建响应数据
-	responseData := fiber.Map{
+	data := fiber.Map{
+		"token":              tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_at":         tokens.ExpiresAt,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+		"user": fiber.Map{
+			"id":              user.ID,
+			"username":        user.Username,
+			"nickname":        user.Nickname,
+			"roles":           user.Roles,
+			"permissions":     permissions,
+			"status":          user.Status,
+			"last_login":      user.LastLogin,
+			"has_changed_pwd": user.HasChangedPwd,
+			"totp_enabled":    user.TOTPEnabled,
+			"created_at":      user.CreatedAt,
+			"updated_at":      user.UpdatedAt,
+		},
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+
+	return c.JSON(fiber.Map{
 		"code":    0,
 		"message": "登录成功",
-		"data": fiber.Map{
-			"token": tokenString,
-			"user": fiber.Map{
-				"id":              user.ID,
-				"username":        user.Username,
-				"nickname":        user.Nickname,
-				"role_id":         user.RoleID,
-				"role":            user.Role,
-				"status":          user.Status,
-				"last_login":      user.LastLogin,
-				"has_changed_pwd": user.HasChangedPwd,
-				"created_at":      user.CreatedAt,
-				"updated_at":      user.UpdatedAt,
-			},
-		},
+		"data":    data,
+	})
+}
+
+// refreshAction 使用刷新令牌换取新的令牌对
+func refreshAction(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
 	}
 
-	return c.JSON(responseData)
+	tokens, err := app.Tokens.RefreshTokens(req.RefreshToken)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    0,
+		"message": "刷新成功",
+		"data":    tokens,
+	})
 }
 
-// logoutAction 处理退出登录请求
+// logoutAction 处理退出登录请求，同时撤销该用户的所有令牌
 func logoutAction(c *fiber.Ctx) error {
-	isAuthenticated, _ := core.GetSession(c)
-	if !isAuthenticated {
+	identity := core.CurrentIdentity(c)
+	if identity == nil {
 		return c.Redirect("/login")
 	}
 
-	core.DestroySession(c)
+	if err := app.Tokens.RevokeUserTokens(identity.UserID); err != nil {
+		log.Printf("撤销用户 %d 的令牌失败: %v", identity.UserID, err)
+	}
+
+	if identity.Method == core.AuthMethodSession {
+		core.DestroySession(c)
+	}
 
 	return c.Redirect("/login")
 }
 
-// changePasswordAction 修改密码
+// changePasswordAction 修改当前登录用户的密码
 func changePasswordAction(c *fiber.Ctx) error {
 	var req ChangePasswordRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
 	}
 
+	// 只能修改当前登录用户的密码
+	identity := core.CurrentIdentity(c)
+	if identity == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "请先登录"})
+	}
+
 	// 获取用户信息
 	var user models.User
-	if err := app.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
+	if err := app.DB.First(&user, identity.UserID).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "用户不存在"})
 	}
+	if req.Username != "" && req.Username != user.Username {
+		return c.Status(403).JSON(fiber.Map{"error": "只能修改当前登录用户的密码"})
+	}
+
+	if locked, err := checkLockout(c, user.Username); locked || err != nil {
+		return err
+	}
 
 	// 验证旧密码
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.OldPassword)); err != nil {
+		attemptFailed(c, user.ID, user.Username, "change_password_failed", "当前密码错误")
 		return c.Status(400).JSON(fiber.Map{"error": "当前密码错误"})
 	}
 
+	if len(req.NewPassword) < 6 {
+		return c.Status(400).JSON(fiber.Map{"error": "新密码长度不能小于6位"})
+	}
+
 	// 生成新密码的哈希值
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -150,37 +241,68 @@ func changePasswordAction(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "更新密码失败"})
 	}
 
+	// 修改密码后，之前签发的令牌全部失效
+	if err := app.Tokens.RevokeUserTokens(user.ID); err != nil {
+		log.Printf("撤销用户 %d 的令牌失败: %v", user.ID, err)
+	}
+
 	return c.JSON(fiber.Map{
 		"code":    0,
 		"message": "密码修改成功",
 	})
 }
 
-// 生成 JWT token
-func generateToken(user models.User) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"role_id":  user.RoleID,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(), // 24小时过期
+// checkLockout 检查用户名和IP是否处于锁定状态，锁定时写入 429 响应并返回 true
+func checkLockout(c *fiber.Ctx, username string) (bool, error) {
+	remaining, err := lockedFor(username, c.IP())
+	if err != nil {
+		return true, c.Status(500).JSON(fiber.Map{"error": "检查登录状态失败"})
+	}
+	if remaining <= 0 {
+		return false, nil
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(app.Config.Auth.JWTSecret))
+	seconds := int(math.Ceil(remaining.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return true, c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":       fmt.Sprintf("失败次数过多，请在 %d 秒后重试", seconds),
+		"retry_after": seconds,
+	})
 }
 
-// Current 获取当前用户
-func CurrentUser(c *fiber.Ctx) *models.User {
-	isAuthenticated, userID := core.GetSession(c)
+// attemptFailed 累加失败计数，并将失败记录写入操作日志
+func attemptFailed(c *fiber.Ctx, userID uint, username, action, reason string) {
+	failures, lockout, err := recordFailure(username, c.IP())
+	if err != nil {
+		log.Printf("记录登录失败次数失败: %v", err)
+	}
+
+	details := fmt.Sprintf("%s，连续失败 %d 次", reason, failures)
+	if lockout > 0 {
+		details += fmt.Sprintf("，锁定 %s", lockout)
+	}
+	if err := adminlog.CreateAdminLogAs(c, userID, username, action, "user", userID, details); err != nil {
+		log.Printf("记录登录失败日志失败: %v", err)
+	}
+}
 
-	if !isAuthenticated {
-		return nil
+// unknownUserFailed 用户名不存在时只累加IP的失败计数，并将失败记录写入操作日志
+func unknownUserFailed(c *fiber.Ctx, username string) {
+	failures, lockout, err := recordFailure("", c.IP())
+	if err != nil {
+		log.Printf("记录登录失败次数失败: %v", err)
 	}
 
-	var vo models.User
-	app.DB.Model(&vo).
-		Where("id", userID).
-		First(&vo)
+	details := fmt.Sprintf("用户不存在，该IP连续失败 %d 次", failures)
+	if lockout > 0 {
+		details += fmt.Sprintf("，锁定 %s", lockout)
+	}
+	if err := adminlog.CreateAdminLogAs(c, 0, username, "login_failed", "user", 0, details); err != nil {
+		log.Printf("记录登录失败日志失败: %v", err)
+	}
+}
 
-	return &vo
+// CurrentUser 获取当前用户
+func CurrentUser(c *fiber.Ctx) *models.User {
+	return app.CurrentUser(c)
 }
@@ -0,0 +1,84 @@
+package login
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/andycai/unitool/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// createLocalUser 创建本地账号，status 为 0 时创建后禁用
+func createLocalUser(t *testing.T, username, password string, status int) *models.User {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Username: username, Nickname: username, Password: string(hash), HasChangedPwd: true}
+	if err := app.DB.Create(&user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	// status 的默认值为 1，创建时的零值会被忽略
+	if err := app.DB.Model(&user).Update("status", status).Error; err != nil {
+		t.Fatal(err)
+	}
+	user.Status = status
+	return &user
+}
+
+// sessionCount 用户的会话数量
+func sessionCount(t *testing.T, userID uint) int64 {
+	t.Helper()
+
+	var count int64
+	if err := app.DB.Model(&models.UserSession{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestLoginRejectsDisabledUser(t *testing.T) {
+	user := createLocalUser(t, "ivan", "ivan-secret", 0)
+
+	status, result := postJSON(t, "/login", LoginRequest{Username: "ivan", Password: "ivan-secret"})
+	if status != http.StatusForbidden || result["error"] != "账号已被禁用" {
+		t.Errorf("状态码 = %d, 响应 %v, 期望 403 账号已被禁用", status, result)
+	}
+
+	// 密码错误时不透露账号已被禁用
+	if status, _ := postJSON(t, "/login", LoginRequest{Username: "ivan", Password: "wrong"}); status != http.StatusUnauthorized {
+		t.Errorf("密码错误的状态码 = %d, 期望 401", status)
+	}
+
+	if n := sessionCount(t, user.ID); n != 0 {
+		t.Errorf("被禁用的用户创建了 %d 个会话", n)
+	}
+
+	// 启用后可以正常登录
+	app.DB.Model(user).Update("status", 1)
+	if status, result := postJSON(t, "/login", LoginRequest{Username: "ivan", Password: "ivan-secret"}); status != http.StatusOK {
+		t.Errorf("状态码 = %d, 响应 %v, 期望 200", status, result)
+	}
+}
+
+func TestMFARejectsDisabledUser(t *testing.T) {
+	// 通过第一步验证后账号被禁用，第二步不能完成登录
+	user := createLocalUser(t, "judy", "judy-secret", 0)
+	mfaToken, err := signPendingToken(mfaTokenPurpose, user.ID, false, mfaTokenExpire)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/login/mfa", "/login/mfa/enroll"} {
+		status, result := postJSON(t, path, MFARequest{MFAToken: mfaToken, Code: "000000"})
+		if status != http.StatusForbidden || result["error"] != "账号已被禁用" {
+			t.Errorf("%s 的状态码 = %d, 响应 %v, 期望 403 账号已被禁用", path, status, result)
+		}
+	}
+
+	if n := sessionCount(t, user.ID); n != 0 {
+		t.Errorf("被禁用的用户创建了 %d 个会话", n)
+	}
+}
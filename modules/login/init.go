@@ -1,6 +1,8 @@
 package login
 
 import (
+	"context"
+
 	"github.com/andycai/unitool/core"
 	"github.com/andycai/unitool/enum"
 	"github.com/gofiber/fiber/v2"
@@ -10,14 +12,63 @@ var app *core.App
 
 type loginModule struct {
 	core.BaseModule
+	done chan struct{}
 }
 
 func init() {
-	core.RegisterModule(&loginModule{}, enum.ModulePriorityLogin)
+	core.RegisterModule(&loginModule{}, core.ModuleInfo{
+		Name:    enum.ModuleLogin,
+		Depends: []string{enum.ModuleUser, enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "login:lockout:list", Name: "登录锁定列表", Description: "查看登录失败计数和锁定状态"},
+			{Code: "login:lockout:clear", Name: "解除登录锁定", Description: "清除登录失败计数并解除锁定"},
+			{Code: "session:list", Name: "在线会话列表", Description: "查看所有用户的登录会话"},
+			{Code: "session:revoke", Name: "强制下线", Description: "撤销用户的登录会话"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin", Name: "账户安全", Path: "/admin/security", Icon: "security", Sort: 7},
+			{Parent: "/admin", Name: "在线会话", Path: "/admin/sessions", Icon: "session", Sort: 10, Permission: "session:list"},
+		},
+	})
 }
 
 func (m *loginModule) Awake(a *core.App) error {
 	app = a
+
+	mc, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	conf.Store(mc)
+
+	return autoMigrate()
+}
+
+func (m *loginModule) Start() error {
+	// 启动时先清理停机期间过期的失败计数
+	pruneAttempts()
+
+	m.done = make(chan struct{})
+	go pruneLoop(m.done)
+
+	return nil
+}
+
+func (m *loginModule) Stop(ctx context.Context) error {
+	if m.done != nil {
+		close(m.done)
+		m.done = nil
+	}
+	return nil
+}
+
+func (m *loginModule) OnConfigChange(old, new *core.Config) error {
+	mc, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	conf.Store(mc)
+
 	return nil
 }
 
@@ -40,6 +91,19 @@ func (m *loginModule) AddPublicRouters() error {
 		return logoutAction(c)
 	})
 
+	// 两步验证 API 路由（不需要认证，使用登录返回的验证令牌）
+	app.RouterPublic.Post("/login/mfa", mfaVerifyAction)
+	app.RouterPublic.Post("/login/mfa/enroll", mfaEnrollAction)
+
+	// 外部身份源登录路由（不需要认证）
+	app.RouterPublic.Get("/login/providers", getProvidersAction)
+	app.RouterPublic.Get("/login/oidc/:provider", oidcStartAction)
+	app.RouterPublic.Get("/login/oidc/:provider/callback", oidcCallbackAction)
+	app.RouterPublic.Post("/login/external", externalLoginAction)
+
+	// 刷新令牌 API 路由（不需要认证，使用刷新令牌换取新的访问令牌）
+	app.RouterPublicApi.Post("/auth/refresh", refreshAction)
+
 	// 修改密码路由（不需要认证）
 	app.RouterPublic.Post("/change-password", func(c *fiber.Ctx) error {
 		return changePasswordAction(c)
@@ -56,7 +120,47 @@ func (m *loginModule) AddAuthRouters() error {
 		}, "admin/layout")
 	})
 
+	app.RouterAdmin.Get("/security", func(c *fiber.Ctx) error {
+		return c.Render("admin/security", fiber.Map{
+			"Title": "账户安全",
+			"Scripts": []string{
+				"/static/js/admin/security.js",
+			},
+		}, "admin/layout")
+	})
+
+	app.RouterAdmin.Get("/sessions", app.HasPermission("session:list"), func(c *fiber.Ctx) error {
+		return c.Render("admin/sessions", fiber.Map{
+			"Title": "在线会话",
+			"Scripts": []string{
+				"/static/js/admin/sessions.js",
+			},
+		}, "admin/layout")
+	})
+
+	// api，当前用户的两步验证设置
+	app.RouterApi.Get("/totp", core.DenyAPIKey, getTOTPStatusAction)
+	app.RouterApi.Post("/totp/enroll", core.DenyAPIKey, enrollTOTPAction)
+	app.RouterApi.Post("/totp/enable", core.DenyAPIKey, enableTOTPAction)
+	app.RouterApi.Post("/totp/disable", core.DenyAPIKey, disableTOTPAction)
+	app.RouterApi.Post("/totp/recovery-codes", core.DenyAPIKey, regenerateRecoveryCodesAction)
+
+	// api，管理员重置用户的两步验证
+	app.RouterApi.Post("/users/:id/totp/reset", app.HasPermission("user:update"), resetUserTOTPAction)
+
+	// api，当前用户的登录会话
+	app.RouterApi.Get("/sessions/mine", core.DenyAPIKey, getMySessionsAction)
+	app.RouterApi.Delete("/sessions/mine/:id", core.DenyAPIKey, revokeMySessionAction)
+	app.RouterApi.Post("/sessions/mine/revoke-others", core.DenyAPIKey, revokeMyOtherSessionsAction)
+
+	// api，管理员查看和撤销所有用户的会话
+	app.RouterApi.Get("/sessions", app.HasPermission("session:list"), getSessionsAction)
+	app.RouterApi.Delete("/sessions/:id", app.HasPermission("session:revoke"), revokeSessionAction)
+	app.RouterApi.Post("/users/:id/sessions/revoke", app.HasPermission("session:revoke"), revokeUserSessionsAction)
+
 	// api
+	app.RouterApi.Get("/login/lockouts", app.HasPermission("login:lockout:list"), getLockoutsAction)
+	app.RouterApi.Delete("/login/lockouts/:id", app.HasPermission("login:lockout:clear"), clearLockoutAction)
 
 	return nil
 }
@@ -0,0 +1,135 @@
+package login
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapTimeout 连接和请求 LDAP 服务器的超时时间
+const ldapTimeout = 10 * time.Second
+
+// ldapProvider LDAP 绑定认证身份源：先用服务账号查询用户 DN，再以用户 DN 和密码绑定
+type ldapProvider struct {
+	baseProvider
+	tlsConfig *tls.Config
+}
+
+func newLDAPProvider(cfg providerConfig) (Provider, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, fmt.Errorf("必须配置 url 和 base_dn")
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") {
+		return nil, fmt.Errorf("url 必须以 ldap:// 或 ldaps:// 开头")
+	}
+
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if strings.Count(cfg.UserFilter, "%s") != 1 {
+		return nil, fmt.Errorf("user_filter 必须包含一个 %%s")
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = "uid"
+	}
+	if cfg.NicknameAttribute == "" {
+		cfg.NicknameAttribute = "cn"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+
+	return &ldapProvider{
+		baseProvider: baseProvider{cfg: cfg},
+		tlsConfig: &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+		},
+	}, nil
+}
+
+// dial 连接 LDAP 服务器，按配置升级为 TLS
+func (p *ldapProvider) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(p.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(p.tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if p.cfg.StartTLS {
+		if err := conn.StartTLS(p.tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Authenticate 校验用户名和密码，返回用户信息
+func (p *ldapProvider) Authenticate(ctx context.Context, username, password string) (*ExternalIdentity, error) {
+	// 空密码会被服务器当作匿名绑定并返回成功，必须在这里拒绝
+	if username == "" || password == "" {
+		return nil, errInvalidCredentials
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return nil, fmt.Errorf("连接 LDAP 服务器失败: %w", err)
+	}
+	defer conn.Close()
+
+	if p.cfg.BindDN != "" {
+		if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP 服务账号绑定失败: %w", err)
+		}
+	}
+
+	attributes := []string{p.cfg.UsernameAttribute, p.cfg.NicknameAttribute, p.cfg.GroupAttribute, "mail"}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(ldapTimeout.Seconds()), false,
+		fmt.Sprintf(p.cfg.UserFilter, ldap.EscapeFilter(username)),
+		attributes,
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("查询 LDAP 用户失败: %w", err)
+	}
+	// 用户不存在或过滤器匹配到多个用户时都视为认证失败
+	if result == nil || len(result.Entries) != 1 {
+		return nil, errInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, errInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP 用户绑定失败: %w", err)
+	}
+
+	name := entry.GetAttributeValue(p.cfg.UsernameAttribute)
+	if name == "" {
+		name = username
+	}
+
+	return &ExternalIdentity{
+		Provider: p.cfg.Name,
+		Subject:  entry.DN,
+		Username: name,
+		Nickname: entry.GetAttributeValue(p.cfg.NicknameAttribute),
+		Email:    entry.GetAttributeValue("mail"),
+		Groups:   entry.GetAttributeValues(p.cfg.GroupAttribute),
+	}, nil
+}
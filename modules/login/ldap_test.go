@@ -0,0 +1,324 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/andycai/unitool/models"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapEntry 模拟目录中的条目
+type ldapEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// fakeLDAP 模拟 LDAP 服务器，只支持简单绑定和按 uid 查询
+type fakeLDAP struct {
+	ln      net.Listener
+	entries []ldapEntry
+	wg      sync.WaitGroup
+
+	mu    sync.Mutex
+	binds []string // 收到的绑定请求的 DN
+}
+
+func newFakeLDAP() (*fakeLDAP, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fakeLDAP{
+		ln: ln,
+		entries: []ldapEntry{
+			{dn: "cn=service,dc=example,dc=com", password: "service-secret"},
+			{
+				dn:       "uid=grace,ou=people,dc=example,dc=com",
+				password: "grace-secret",
+				attrs: map[string][]string{
+					"uid":      {"grace"},
+					"cn":       {"Grace Hopper"},
+					"mail":     {"grace@example.com"},
+					"memberOf": {"cn=ops,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"},
+				},
+			},
+			{
+				dn:       "uid=heidi,ou=people,dc=example,dc=com",
+				password: "heidi-secret",
+				attrs: map[string][]string{
+					"uid": {"heidi"},
+					"cn":  {"Heidi"},
+				},
+			},
+		},
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+func (s *fakeLDAP) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeLDAP) Close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+// bindCount 收到的绑定请求数量
+func (s *fakeLDAP) bindCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.binds)
+}
+
+func (s *fakeLDAP) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle 处理一个连接上的请求，直到客户端解除绑定或断开
+func (s *fakeLDAP) handle(conn net.Conn) {
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+
+			s.mu.Lock()
+			s.binds = append(s.binds, dn)
+			s.mu.Unlock()
+
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if e := s.find(dn); e != nil && password != "" && password == e.password {
+				code = ldap.LDAPResultSuccess
+			}
+			s.write(conn, ldapResult(id, ldap.ApplicationBindResponse, code))
+
+		case ldap.ApplicationSearchRequest:
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				s.write(conn, ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError))
+				continue
+			}
+			for i := range s.entries {
+				e := &s.entries[i]
+				if uid := e.attrs["uid"]; len(uid) > 0 && filter == "(uid="+ldap.EscapeFilter(uid[0])+")" {
+					s.write(conn, ldapSearchEntry(id, e))
+				}
+			}
+			s.write(conn, ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+
+		case ldap.ApplicationUnbindRequest:
+			return
+
+		default:
+			s.write(conn, ldapResult(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform))
+		}
+	}
+}
+
+func (s *fakeLDAP) find(dn string) *ldapEntry {
+	for i := range s.entries {
+		if s.entries[i].dn == dn {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+func (s *fakeLDAP) write(conn net.Conn, packet *ber.Packet) {
+	conn.Write(packet.Bytes())
+}
+
+// ldapMessage LDAP 消息的外层结构
+func ldapMessage(id int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+// ldapResult 只包含结果码的响应
+func ldapResult(id int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return ldapMessage(id, op)
+}
+
+// ldapSearchEntry 查询结果中的一个条目
+func ldapSearchEntry(id int64, e *ldapEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "Object Name"))
+
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range e.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return ldapMessage(id, op)
+}
+
+// ldapLogin 使用 LDAP 身份源登录，返回状态码和响应内容
+func ldapLogin(t *testing.T, provider, username, password string) (int, map[string]interface{}) {
+	t.Helper()
+	return postJSON(t, "/login", LoginRequest{Username: username, Password: password, Provider: provider})
+}
+
+func ldapTestProvider(t *testing.T, name string) PasswordProvider {
+	t.Helper()
+
+	p, ok := getProvider(name)
+	if !ok {
+		t.Fatalf("身份源 %s 不存在", name)
+	}
+	return p.(PasswordProvider)
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	p := ldapTestProvider(t, "ldap")
+
+	ext, err := p.Authenticate(context.Background(), "grace", "grace-secret")
+	if err != nil {
+		t.Fatalf("认证失败: %v", err)
+	}
+	if ext.Subject != "uid=grace,ou=people,dc=example,dc=com" {
+		t.Errorf("Subject = %s", ext.Subject)
+	}
+	if ext.Username != "grace" || ext.Nickname != "Grace Hopper" || ext.Email != "grace@example.com" {
+		t.Errorf("用户信息 = %+v", ext)
+	}
+	if !slices.Equal(ext.Groups, []string{"cn=ops,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"}) {
+		t.Errorf("用户组 = %v", ext.Groups)
+	}
+}
+
+func TestLDAPBindFailure(t *testing.T) {
+	p := ldapTestProvider(t, "ldap")
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{"密码错误", "grace", "wrong"},
+		{"用户不存在", "mallory", "grace-secret"},
+		{"过滤器注入", "*", "grace-secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.Authenticate(ctx, tt.username, tt.password); !errors.Is(err, errInvalidCredentials) {
+				t.Errorf("错误 = %v, 期望 errInvalidCredentials", err)
+			}
+		})
+	}
+
+	// 空密码不能发送到服务器，否则会被当作匿名绑定
+	before := testLDAP.bindCount()
+	if _, err := p.Authenticate(ctx, "grace", ""); !errors.Is(err, errInvalidCredentials) {
+		t.Errorf("错误 = %v, 期望 errInvalidCredentials", err)
+	}
+	if n := testLDAP.bindCount() - before; n != 0 {
+		t.Errorf("空密码发送了 %d 个绑定请求", n)
+	}
+
+	// 服务账号绑定失败是配置问题，不是用户的密码错误
+	_, err := ldapTestProvider(t, "ldap-badsvc").Authenticate(ctx, "grace", "grace-secret")
+	if err == nil || errors.Is(err, errInvalidCredentials) {
+		t.Errorf("错误 = %v, 期望服务账号绑定失败", err)
+	}
+}
+
+func TestLDAPLogin(t *testing.T) {
+	status, result := ldapLogin(t, "ldap", "grace", "grace-secret")
+	if status != http.StatusOK {
+		t.Fatalf("登录的状态码 = %d, 响应 %v", status, result)
+	}
+
+	user := findUser(t, "ldap", "uid=grace,ou=people,dc=example,dc=com")
+	if user == nil {
+		t.Fatal("首次登录没有创建用户")
+	}
+	if user.Username != "grace" || user.Nickname != "Grace Hopper" {
+		t.Errorf("用户名和昵称 = %s/%s", user.Username, user.Nickname)
+	}
+	if got := roleNames(t, user.ID); !slices.Equal(got, []string{"operator"}) {
+		t.Errorf("角色 = %v, 期望 [operator]", got)
+	}
+
+	// 没有匹配的映射规则时使用默认角色
+	if status, result := ldapLogin(t, "ldap", "heidi", "heidi-secret"); status != http.StatusOK {
+		t.Fatalf("登录的状态码 = %d, 响应 %v", status, result)
+	}
+	user = findUser(t, "ldap", "uid=heidi,ou=people,dc=example,dc=com")
+	if user == nil {
+		t.Fatal("首次登录没有创建用户")
+	}
+	if got := roleNames(t, user.ID); !slices.Equal(got, []string{"developer"}) {
+		t.Errorf("角色 = %v, 期望 [developer]", got)
+	}
+}
+
+func TestLDAPLoginBindFailure(t *testing.T) {
+	status, result := ldapLogin(t, "ldap", "heidi", "wrong")
+	if status != http.StatusUnauthorized {
+		t.Fatalf("状态码 = %d, 期望 401, 响应 %v", status, result)
+	}
+
+	// 失败次数按身份源和用户名计数
+	var attempt models.LoginAttempt
+	if err := app.DB.Where("kind = ? AND value = ?", models.LoginAttemptUsername, normalizeUsername("ldap:heidi")).First(&attempt).Error; err != nil {
+		t.Fatalf("没有记录登录失败: %v", err)
+	}
+	if attempt.Failures < 1 {
+		t.Errorf("失败次数 = %d", attempt.Failures)
+	}
+
+	status, result = ldapLogin(t, "ldap-badsvc", "heidi", "heidi-secret")
+	if status != http.StatusBadGateway {
+		t.Errorf("服务账号绑定失败的状态码 = %d, 期望 502, 响应 %v", status, result)
+	}
+
+	if status, _ := ldapLogin(t, "missing", "heidi", "heidi-secret"); status != http.StatusBadRequest {
+		t.Errorf("身份源不存在的状态码 = %d, 期望 400", status)
+	}
+}
@@ -0,0 +1,44 @@
+package login
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/adminlog"
+	"github.com/gofiber/fiber/v2"
+)
+
+// getLockoutsAction 获取登录失败计数，locked=1 时只返回锁定中的记录
+func getLockoutsAction(c *fiber.Ctx) error {
+	query := app.DB.Model(&models.LoginAttempt{})
+	if c.Query("locked") == "1" {
+		query = query.Where("locked_until > ?", time.Now())
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var attempts []models.LoginAttempt
+	if err := query.Order("last_failed_at desc").Find(&attempts).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取登录锁定列表失败"})
+	}
+	return c.JSON(attempts)
+}
+
+// clearLockoutAction 清除失败计数并解除锁定
+func clearLockoutAction(c *fiber.Ctx) error {
+	var attempt models.LoginAttempt
+	if err := app.DB.First(&attempt, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "记录不存在"})
+	}
+
+	if err := app.DB.Delete(&attempt).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "解除锁定失败"})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "unlock", "login", attempt.ID, fmt.Sprintf("解除登录锁定：%s %s", attempt.Kind, attempt.Value))
+
+	return c.JSON(fiber.Map{"message": "解除成功"})
+}
@@ -0,0 +1,197 @@
+package login
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/models"
+	_ "github.com/andycai/unitool/modules/user"
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 测试使用内存数据库，外部身份源由进程内的 OIDC 发行方和 LDAP 服务器模拟
+var (
+	testApp    *fiber.App
+	testIssuer *fakeIssuer
+	testLDAP   *fakeLDAP
+)
+
+// testConfig 测试使用的配置，身份源地址和数据库文件在启动模拟服务器后填入
+const testConfig = `
+[app]
+is_dev = true
+
+[server]
+port = 3000
+
+[database]
+driver = "sqlite"
+dsn = "%[3]s"
+
+[auth]
+jwt_secret = "login-test-secret"
+
+[[modules.login.providers]]
+name = "corp"
+type = "oidc"
+issuer = "%[1]s"
+client_id = "unitool"
+client_secret = "client-secret"
+redirect_url = "http://localhost:3000/login/oidc/corp/callback"
+role_mappings = [
+  { group = "developers", role = "developer" },
+  { group = "cn=ops,ou=groups,dc=example,dc=com", role = "operator" },
+]
+
+[[modules.login.providers]]
+name = "ldap"
+type = "ldap"
+url = "ldap://%[2]s"
+base_dn = "dc=example,dc=com"
+bind_dn = "cn=service,dc=example,dc=com"
+bind_password = "service-secret"
+default_role = "developer"
+role_mappings = [
+  { group = "ops", role = "operator" },
+]
+
+[[modules.login.providers]]
+name = "ldap-badsvc"
+type = "ldap"
+url = "ldap://%[2]s"
+base_dn = "dc=example,dc=com"
+bind_dn = "cn=service,dc=example,dc=com"
+bind_password = "wrong-secret"
+default_role = "developer"
+`
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	var err error
+	testIssuer, err = newFakeIssuer()
+	if err != nil {
+		log.Printf("启动 OIDC 发行方失败: %v", err)
+		return 1
+	}
+	defer testIssuer.Close()
+
+	testLDAP, err = newFakeLDAP()
+	if err != nil {
+		log.Printf("启动 LDAP 服务器失败: %v", err)
+		return 1
+	}
+	defer testLDAP.Close()
+
+	dir, err := os.MkdirTemp("", "unitool-login-test")
+	if err != nil {
+		log.Printf("创建临时目录失败: %v", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "conf.toml")
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(testConfig, testIssuer.URL, testLDAP.Addr(), filepath.Join(dir, "unitool.db"))), 0o600); err != nil {
+		log.Printf("写入配置文件失败: %v", err)
+		return 1
+	}
+	os.Args = append(os.Args, "-config", path)
+	if err := core.LoadConfig(); err != nil {
+		log.Printf("加载配置文件失败: %v", err)
+		return 1
+	}
+
+	db, err := gorm.Open(sqlite.Open("file:login_test?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		log.Printf("打开数据库失败: %v", err)
+		return 1
+	}
+	// 内存数据库只使用一个连接，避免共享缓存的表锁冲突
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Printf("打开数据库失败: %v", err)
+		return 1
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	testApp = fiber.New()
+	a := core.NewApp()
+	if err := a.Start([]*gorm.DB{db}, testApp); err != nil {
+		log.Printf("应用启动失败: %v", err)
+		return 1
+	}
+
+	// 映射规则引用的角色
+	for _, name := range []string{"developer", "operator"} {
+		if err := db.Where(models.Role{Name: name}).FirstOrCreate(&models.Role{}).Error; err != nil {
+			log.Printf("创建角色 %s 失败: %v", name, err)
+			return 1
+		}
+	}
+
+	return m.Run()
+}
+
+// roleNames 用户的角色名称，按名称排序
+func roleNames(t *testing.T, userID uint) []string {
+	t.Helper()
+
+	var names []string
+	if err := app.DB.Model(&models.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Pluck("roles.name", &names).Error; err != nil {
+		t.Fatalf("查询用户角色失败: %v", err)
+	}
+	return names
+}
+
+// findUser 按身份源和外部标识查找用户，不存在时返回 nil
+func findUser(t *testing.T, provider, subject string) *models.User {
+	t.Helper()
+
+	var users []models.User
+	if err := app.DB.Where("provider = ? AND external_id = ?", provider, subject).Find(&users).Error; err != nil {
+		t.Fatalf("查询用户失败: %v", err)
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	return &users[0]
+}
+
+// postJSON 以 JSON 格式请求接口，返回状态码和响应内容
+func postJSON(t *testing.T, path string, v interface{}) (int, map[string]interface{}) {
+	t.Helper()
+
+	body, _ := json.Marshal(v)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := testApp.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return resp.StatusCode, result
+}
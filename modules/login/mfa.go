@@ -0,0 +1,308 @@
+package login
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/adminlog"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type MFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"` // 一次性密码或恢复码
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// mfaChallenge 密码验证通过后返回两步验证令牌，用户需要调用 /login/mfa 完成登录
+func mfaChallenge(c *fiber.Ctx, user *models.User, remember bool) error {
+	mfaToken, err := signPendingToken(mfaTokenPurpose, user.ID, remember, mfaTokenExpire)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "生成验证令牌失败"})
+	}
+
+	return c.JSON(fiber.Map{
+		"code":    0,
+		"message": "请输入两步验证码",
+		"data": fiber.Map{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			// 角色要求两步验证但用户尚未绑定时，需要先调用 /login/mfa/enroll 绑定
+			"enroll_required": !user.TOTPEnabled,
+		},
+	})
+}
+
+// mfaUser 根据两步验证令牌加载用户
+func mfaUser(mfaToken string) (*models.User, bool, error) {
+	userID, remember, err := parsePendingToken(mfaTokenPurpose, mfaToken)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var user models.User
+	if err := app.DB.Preload("Roles").First(&user, userID).Error; err != nil {
+		return nil, false, fmt.Errorf("用户不存在")
+	}
+	return &user, remember, nil
+}
+
+// mfaEnrollAction 登录过程中为尚未绑定的用户生成两步验证密钥
+func mfaEnrollAction(c *fiber.Ctx) error {
+	var req MFARequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
+	}
+
+	user, _, err := mfaUser(req.MFAToken)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+	if user.Status != 1 {
+		return c.Status(403).JSON(fiber.Map{"error": "账号已被禁用"})
+	}
+	if user.TOTPEnabled {
+		return c.Status(400).JSON(fiber.Map{"error": "已启用两步验证"})
+	}
+
+	secret, uri, err := enrollTOTP(user)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "生成两步验证密钥失败"})
+	}
+
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"data": fiber.Map{
+			"secret": secret,
+			"uri":    uri,
+		},
+	})
+}
+
+// mfaVerifyAction 完成两步验证并登录，尚未绑定的用户在此确认绑定并获得恢复码
+func mfaVerifyAction(c *fiber.Ctx) error {
+	var req MFARequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
+	}
+
+	user, remember, err := mfaUser(req.MFAToken)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+	// 通过第一步验证后账号可能已被禁用
+	if user.Status != 1 {
+		return c.Status(403).JSON(fiber.Map{"error": "账号已被禁用"})
+	}
+
+	if locked, err := checkLockout(c, user.Username); locked || err != nil {
+		return err
+	}
+
+	// 首次绑定：校验验证码后启用两步验证并返回恢复码
+	if !user.TOTPEnabled {
+		codes, err := activateTOTP(user, req.Code)
+		if err != nil {
+			attemptFailed(c, user.ID, user.Username, "mfa_failed", "绑定两步验证失败")
+			return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		adminlog.CreateAdminLogAs(c, user.ID, user.Username, "totp_enable", "user", user.ID, "登录时绑定两步验证")
+		return completeLogin(c, user, remember, fiber.Map{"recovery_codes": codes})
+	}
+
+	method, ok := verifySecondFactor(user, req.Code)
+	if !ok {
+		attemptFailed(c, user.ID, user.Username, "mfa_failed", "两步验证码错误")
+		return c.Status(401).JSON(fiber.Map{"error": "验证码错误"})
+	}
+
+	if method == "recovery_code" {
+		adminlog.CreateAdminLogAs(c, user.ID, user.Username, "recovery_code", "user", user.ID, "使用恢复码登录")
+	}
+
+	return completeLogin(c, user, remember, nil)
+}
+
+// totpUser 获取当前登录用户，访问令牌不能修改两步验证设置
+func totpUser(c *fiber.Ctx) (*models.User, error) {
+	identity := core.CurrentIdentity(c)
+	if identity == nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "请先登录")
+	}
+	if identity.Method == core.AuthMethodAPIKey {
+		return nil, fiber.NewError(fiber.StatusForbidden, "不能使用访问令牌修改两步验证设置")
+	}
+
+	var user models.User
+	if err := app.DB.Preload("Roles").First(&user, identity.UserID).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "用户不存在")
+	}
+	return &user, nil
+}
+
+// getTOTPStatusAction 获取当前用户的两步验证状态
+func getTOTPStatusAction(c *fiber.Ctx) error {
+	user, err := totpUser(c)
+	if err != nil {
+		return err
+	}
+
+	var remaining int64
+	app.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+
+	return c.JSON(fiber.Map{
+		"enabled":             user.TOTPEnabled,
+		"required":            roleRequiresTOTP(user.ID),
+		"recovery_codes_left": remaining,
+	})
+}
+
+// enrollTOTPAction 为当前用户生成待确认的两步验证密钥
+func enrollTOTPAction(c *fiber.Ctx) error {
+	user, err := totpUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabled {
+		return c.Status(400).JSON(fiber.Map{"error": "已启用两步验证"})
+	}
+
+	secret, uri, err := enrollTOTP(user)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "生成两步验证密钥失败"})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret": secret,
+		"uri":    uri,
+	})
+}
+
+// enableTOTPAction 确认绑定并启用两步验证，返回恢复码
+func enableTOTPAction(c *fiber.Ctx) error {
+	var req TOTPCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
+	}
+
+	user, err := totpUser(c)
+	if err != nil {
+		return err
+	}
+
+	codes, err := activateTOTP(user, req.Code)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "totp_enable", "user", user.ID, "启用两步验证")
+
+	return c.JSON(fiber.Map{
+		"message":        "两步验证已启用，请妥善保存恢复码",
+		"recovery_codes": codes,
+	})
+}
+
+// disableTOTPAction 关闭两步验证，需要校验密码和验证码，角色要求时不能关闭
+func disableTOTPAction(c *fiber.Ctx) error {
+	var req DisableTOTPRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
+	}
+
+	user, err := totpUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return c.Status(400).JSON(fiber.Map{"error": "未启用两步验证"})
+	}
+	if roleRequiresTOTP(user.ID) {
+		return c.Status(403).JSON(fiber.Map{"error": "当前角色要求必须启用两步验证"})
+	}
+
+	if locked, err := checkLockout(c, user.Username); locked || err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		attemptFailed(c, user.ID, user.Username, "totp_disable_failed", "密码错误")
+		return c.Status(400).JSON(fiber.Map{"error": "密码错误"})
+	}
+	if _, ok := verifySecondFactor(user, req.Code); !ok {
+		attemptFailed(c, user.ID, user.Username, "totp_disable_failed", "两步验证码错误")
+		return c.Status(400).JSON(fiber.Map{"error": "验证码错误"})
+	}
+
+	if err := resetTOTP(user.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "关闭两步验证失败"})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "totp_disable", "user", user.ID, "关闭两步验证")
+
+	return c.JSON(fiber.Map{"message": "两步验证已关闭"})
+}
+
+// regenerateRecoveryCodesAction 重新生成恢复码，旧的恢复码全部失效
+func regenerateRecoveryCodesAction(c *fiber.Ctx) error {
+	var req TOTPCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
+	}
+
+	user, err := totpUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return c.Status(400).JSON(fiber.Map{"error": "未启用两步验证"})
+	}
+	if !verifyTOTP(user, req.Code) {
+		return c.Status(400).JSON(fiber.Map{"error": "验证码错误"})
+	}
+
+	codes, err := generateRecoveryCodes(app.DB, user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "生成恢复码失败"})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "recovery_codes", "user", user.ID, "重新生成恢复码")
+
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// resetUserTOTPAction 管理员重置用户的两步验证，用于用户丢失设备且没有恢复码的情况
+func resetUserTOTPAction(c *fiber.Ctx) error {
+	var user models.User
+	if err := app.DB.First(&user, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "用户不存在"})
+	}
+
+	if err := resetTOTP(user.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "重置两步验证失败"})
+	}
+
+	// 重置后之前签发的令牌全部失效
+	if err := app.Tokens.RevokeUserTokens(user.ID); err != nil {
+		log.Printf("撤销用户 %d 的令牌失败: %v", user.ID, err)
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "totp_reset", "user", user.ID, fmt.Sprintf("重置用户两步验证：%s", user.Username))
+
+	return c.JSON(fiber.Map{"message": "重置成功"})
+}
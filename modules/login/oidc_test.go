@@ -0,0 +1,502 @@
+package login
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "unitool"
+	testClientSecret = "client-secret"
+	testKeyID        = "test-key"
+)
+
+// authRequest 发行方签发授权码时记录的授权请求
+type authRequest struct {
+	redirectURI string
+	nonce       string
+	challenge   string
+	claims      jwt.MapClaims
+}
+
+// fakeIssuer 模拟 OIDC 发行方，提供发现文档、JWKS 和令牌端点。
+// 授权端点由测试直接调用 authorize 代替浏览器登录
+type fakeIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]*authRequest
+}
+
+func newFakeIssuer() (*fakeIssuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fakeIssuer{key: key, codes: make(map[string]*authRequest)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	return s, nil
+}
+
+func (s *fakeIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *fakeIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testKeyID,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// token 令牌端点，校验客户端凭据、授权码和 PKCE，授权码只能使用一次
+func (s *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(code, desc string) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": desc})
+	}
+
+	if r.Method != http.MethodPost {
+		fail("invalid_request", "method")
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != testClientID || secret != testClientSecret {
+		fail("invalid_client", "client authentication failed")
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		fail("unsupported_grant_type", r.PostFormValue("grant_type"))
+		return
+	}
+
+	s.mu.Lock()
+	req, ok := s.codes[r.PostFormValue("code")]
+	delete(s.codes, r.PostFormValue("code"))
+	s.mu.Unlock()
+	if !ok {
+		fail("invalid_grant", "unknown code")
+		return
+	}
+	if r.PostFormValue("redirect_uri") != req.redirectURI {
+		fail("invalid_grant", "redirect_uri mismatch")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		fail("invalid_grant", "code_verifier mismatch")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   s.URL,
+		"aud":   testClientID,
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"iat":   now.Unix(),
+		"nonce": req.nonce,
+	}
+	for k, v := range req.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		fail("server_error", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"id_token":     signed,
+	})
+}
+
+// authorize 代替授权端点处理跳转地址中的授权请求，用户登录后签发授权码，返回授权码和 state。
+// claims 为 ID 令牌中的用户声明，其中的 nonce 会覆盖授权请求中的 nonce
+func (s *fakeIssuer) authorize(t *testing.T, location string, claims jwt.MapClaims) (string, string) {
+	t.Helper()
+
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatalf("解析授权地址失败: %v", err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != s.URL+"/authorize" {
+		t.Fatalf("授权地址 = %s, 期望 %s/authorize", got, s.URL)
+	}
+
+	q := u.Query()
+	for key, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"code_challenge_method": "S256",
+	} {
+		if q.Get(key) != want {
+			t.Fatalf("授权请求的 %s = %q, 期望 %q", key, q.Get(key), want)
+		}
+	}
+	for _, key := range []string{"state", "nonce", "code_challenge", "redirect_uri"} {
+		if q.Get(key) == "" {
+			t.Fatalf("授权请求缺少 %s", key)
+		}
+	}
+	if !slices.Contains(strings.Fields(q.Get("scope")), "openid") {
+		t.Fatalf("授权请求的 scope 缺少 openid: %q", q.Get("scope"))
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &authRequest{
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		claims:      claims,
+	}
+
+	s.mu.Lock()
+	s.codes[code] = req
+	s.mu.Unlock()
+
+	return code, q.Get("state")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// startOIDCLogin 请求登录跳转，返回授权地址和保存授权请求参数的 Cookie
+func startOIDCLogin(t *testing.T) (string, *http.Cookie) {
+	t.Helper()
+
+	resp, err := testApp.Test(httptest.NewRequest(http.MethodGet, "/login/oidc/corp", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("登录跳转的状态码 = %d, 期望 302", resp.StatusCode)
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == oidcStateCookie && cookie.Value != "" {
+			if !cookie.HttpOnly {
+				t.Fatalf("%s Cookie 必须是 HttpOnly", oidcStateCookie)
+			}
+			return resp.Header.Get("Location"), cookie
+		}
+	}
+	t.Fatalf("登录跳转没有设置 %s Cookie", oidcStateCookie)
+	return "", nil
+}
+
+// oidcCallback 请求回调地址，返回跳转地址
+func oidcCallback(t *testing.T, cookie *http.Cookie, query url.Values) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/login/oidc/corp/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	resp, err := testApp.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("回调的状态码 = %d, 期望 302", resp.StatusCode)
+	}
+	return resp.Header.Get("Location")
+}
+
+// oidcLogin 完成一次身份源登录，返回回调后的跳转地址
+func oidcLogin(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	location, cookie := startOIDCLogin(t)
+	code, state := testIssuer.authorize(t, location, claims)
+	return oidcCallback(t, cookie, url.Values{"code": {code}, "state": {state}})
+}
+
+// loginUserID 从登录成功的跳转地址中取出外部登录令牌，返回令牌对应的用户
+func loginUserID(t *testing.T, location string) uint {
+	t.Helper()
+
+	const prefix = "/login#login_token="
+	if !strings.HasPrefix(location, prefix) {
+		t.Fatalf("登录失败，跳转到 %s", location)
+	}
+	token, err := url.QueryUnescape(strings.TrimPrefix(location, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, _, err := parsePendingToken(externalTokenPurpose, token)
+	if err != nil {
+		t.Fatalf("外部登录令牌无效: %v", err)
+	}
+	return userID
+}
+
+// loginError 从登录失败的跳转地址中取出错误信息
+func loginError(t *testing.T, location string) string {
+	t.Helper()
+
+	const prefix = "/login#error="
+	if !strings.HasPrefix(location, prefix) {
+		t.Fatalf("期望登录失败，实际跳转到 %s", location)
+	}
+	msg, err := url.QueryUnescape(strings.TrimPrefix(location, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestOIDCCallbackProvisionsUser(t *testing.T) {
+	location := oidcLogin(t, jwt.MapClaims{
+		"sub":                "oidc-alice",
+		"preferred_username": "alice",
+		"name":               "Alice",
+		"groups":             []string{"developers"},
+	})
+	userID := loginUserID(t, location)
+
+	var user models.User
+	if err := app.DB.First(&user, userID).Error; err != nil {
+		t.Fatalf("首次登录没有创建用户: %v", err)
+	}
+	if user.Username != "alice" || user.Nickname != "Alice" {
+		t.Errorf("用户名和昵称 = %s/%s, 期望 alice/Alice", user.Username, user.Nickname)
+	}
+	if user.Provider != "corp" || user.ExternalID != "oidc-alice" {
+		t.Errorf("外部身份 = %s/%s, 期望 corp/oidc-alice", user.Provider, user.ExternalID)
+	}
+	if user.Status != 1 || !user.HasChangedPwd {
+		t.Errorf("新用户必须是启用状态且不需要修改密码")
+	}
+	if got := roleNames(t, userID); !slices.Equal(got, []string{"developer"}) {
+		t.Errorf("角色 = %v, 期望 [developer]", got)
+	}
+
+	var count int64
+	app.DB.Model(&models.AdminLog{}).Where("action = ? AND resource_id = ?", "provision", userID).Count(&count)
+	if count != 1 {
+		t.Errorf("创建用户的操作日志数量 = %d, 期望 1", count)
+	}
+
+	// 再次登录使用同一个账号，并同步昵称
+	location = oidcLogin(t, jwt.MapClaims{
+		"sub":                "oidc-alice",
+		"preferred_username": "alice",
+		"name":               "Alice Liddell",
+		"groups":             []string{"developers"},
+	})
+	if got := loginUserID(t, location); got != userID {
+		t.Fatalf("再次登录的用户 = %d, 期望 %d", got, userID)
+	}
+	if err := app.DB.First(&user, userID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Nickname != "Alice Liddell" {
+		t.Errorf("昵称 = %s, 期望 Alice Liddell", user.Nickname)
+	}
+	app.DB.Model(&models.AdminLog{}).Where("action = ? AND resource_id = ?", "provision", userID).Count(&count)
+	if count != 1 {
+		t.Errorf("再次登录不应记录创建用户，操作日志数量 = %d", count)
+	}
+}
+
+func TestOIDCGroupsMapToRoles(t *testing.T) {
+	location := oidcLogin(t, jwt.MapClaims{
+		"sub":                "oidc-bob",
+		"preferred_username": "bob",
+		"groups":             []string{"Developers", "cn=ops,ou=groups,dc=example,dc=com", "others"},
+	})
+	userID := loginUserID(t, location)
+	if got := roleNames(t, userID); !slices.Equal(got, []string{"developer", "operator"}) {
+		t.Errorf("角色 = %v, 期望 [developer operator]", got)
+	}
+
+	// 每次登录用映射的角色替换原有角色
+	location = oidcLogin(t, jwt.MapClaims{
+		"sub":                "oidc-bob",
+		"preferred_username": "bob",
+		"groups":             "cn=ops,ou=groups,dc=example,dc=com",
+	})
+	if got := loginUserID(t, location); got != userID {
+		t.Fatalf("再次登录的用户 = %d, 期望 %d", got, userID)
+	}
+	if got := roleNames(t, userID); !slices.Equal(got, []string{"operator"}) {
+		t.Errorf("角色 = %v, 期望 [operator]", got)
+	}
+
+	// 没有匹配任何角色时保留原有角色
+	location = oidcLogin(t, jwt.MapClaims{
+		"sub":                "oidc-bob",
+		"preferred_username": "bob",
+	})
+	loginUserID(t, location)
+	if got := roleNames(t, userID); !slices.Equal(got, []string{"operator"}) {
+		t.Errorf("角色 = %v, 期望 [operator]", got)
+	}
+}
+
+func TestOIDCRejectsUserWithoutRole(t *testing.T) {
+	location := oidcLogin(t, jwt.MapClaims{
+		"sub":                "oidc-carol",
+		"preferred_username": "carol",
+		"groups":             []string{"others"},
+	})
+	if msg := loginError(t, location); !strings.Contains(msg, "没有匹配的角色") {
+		t.Errorf("错误信息 = %s", msg)
+	}
+	if findUser(t, "corp", "oidc-carol") != nil {
+		t.Errorf("没有匹配角色时不应创建用户")
+	}
+}
+
+func TestOIDCStateMismatch(t *testing.T) {
+	claims := jwt.MapClaims{
+		"sub":                "oidc-dave",
+		"preferred_username": "dave",
+		"groups":             []string{"developers"},
+	}
+
+	location, cookie := startOIDCLogin(t)
+	code, _ := testIssuer.authorize(t, location, claims)
+	location = oidcCallback(t, cookie, url.Values{"code": {code}, "state": {"forged"}})
+	if msg := loginError(t, location); !strings.Contains(msg, "登录请求无效") {
+		t.Errorf("错误信息 = %s", msg)
+	}
+
+	// 没有 Cookie 时无法确认是本站发起的登录
+	location, _ = startOIDCLogin(t)
+	code, state := testIssuer.authorize(t, location, claims)
+	location = oidcCallback(t, nil, url.Values{"code": {code}, "state": {state}})
+	if msg := loginError(t, location); !strings.Contains(msg, "登录请求已过期") {
+		t.Errorf("错误信息 = %s", msg)
+	}
+
+	if findUser(t, "corp", "oidc-dave") != nil {
+		t.Errorf("state 校验失败时不应创建用户")
+	}
+}
+
+func TestOIDCNonceMismatch(t *testing.T) {
+	location := oidcLogin(t, jwt.MapClaims{
+		"sub":                "oidc-erin",
+		"preferred_username": "erin",
+		"groups":             []string{"developers"},
+		"nonce":              "replayed-nonce",
+	})
+	if msg := loginError(t, location); msg != "身份源登录失败" {
+		t.Errorf("错误信息 = %s", msg)
+	}
+	if findUser(t, "corp", "oidc-erin") != nil {
+		t.Errorf("nonce 校验失败时不应创建用户")
+	}
+}
+
+func TestOIDCExchangeRequiresVerifier(t *testing.T) {
+	p, ok := getProvider("corp")
+	if !ok {
+		t.Fatal("身份源 corp 不存在")
+	}
+	rp := p.(RedirectProvider)
+	ctx := context.Background()
+	claims := jwt.MapClaims{"sub": "oidc-frank", "preferred_username": "frank"}
+
+	location, err := rp.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := testIssuer.authorize(t, location, claims)
+	if _, err := rp.Exchange(ctx, code, "nonce", "another-verifier"); err == nil {
+		t.Fatal("code_verifier 不匹配时换取令牌应该失败")
+	}
+
+	code, _ = testIssuer.authorize(t, location, claims)
+	ext, err := rp.Exchange(ctx, code, "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("换取令牌失败: %v", err)
+	}
+	if ext.Subject != "oidc-frank" || ext.Username != "frank" || ext.Provider != "corp" {
+		t.Errorf("用户信息 = %+v", ext)
+	}
+
+	// 授权码只能使用一次
+	if _, err := rp.Exchange(ctx, code, "nonce", "verifier"); err == nil {
+		t.Error("重复使用授权码应该失败")
+	}
+}
+
+func TestMapRoles(t *testing.T) {
+	cfg := &providerConfig{
+		RoleMappings: []roleMapping{
+			{Group: "developers", Role: "developer"},
+			{Group: "cn=ops,ou=groups,dc=example,dc=com", Role: "operator"},
+			{Group: "admins", Role: "operator"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		defaultRole string
+		groups      []string
+		want        []string
+	}{
+		{"名称匹配", "", []string{"developers"}, []string{"developer"}},
+		{"不区分大小写", "", []string{"DEVELOPERS"}, []string{"developer"}},
+		{"完整DN匹配", "", []string{"CN=ops,OU=groups,DC=example,DC=com"}, []string{"operator"}},
+		{"DN的第一个RDN匹配名称", "", []string{"cn=developers,ou=groups,dc=example,dc=com"}, []string{"developer"}},
+		{"角色去重", "", []string{"cn=ops,ou=groups,dc=example,dc=com", "admins"}, []string{"operator"}},
+		{"多个角色按规则顺序", "", []string{"admins", "developers"}, []string{"developer", "operator"}},
+		{"没有匹配", "", []string{"others"}, nil},
+		{"没有匹配时使用默认角色", "guest", []string{"others"}, []string{"guest"}},
+		{"有匹配时不使用默认角色", "guest", []string{"developers"}, []string{"developer"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := *cfg
+			c.DefaultRole = tt.defaultRole
+			if got := mapRoles(&c, tt.groups); !slices.Equal(got, tt.want) {
+				t.Errorf("mapRoles(%v) = %v, 期望 %v", tt.groups, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package login
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signPendingToken 签发登录过程中使用的短期令牌，例如两步验证令牌和外部登录令牌。
+// 令牌带有 purpose 且没有 jti，JWT 认证器不接受，只能用于完成对应的登录步骤
+func signPendingToken(purpose string, userID uint, remember bool, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"purpose":         purpose,
+		"pending_user_id": userID,
+		"remember":        remember,
+		"exp":             now.Add(ttl).Unix(),
+		"iat":             now.Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(app.Config().Auth.JWTSecret))
+}
+
+// parsePendingToken 解析登录过程中使用的短期令牌，返回用户ID和记住我选项
+func parsePendingToken(purpose, tokenString string) (uint, bool, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(app.Config().Auth.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, false, fmt.Errorf("验证已过期，请重新登录")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != purpose {
+		return 0, false, fmt.Errorf("无效的验证令牌")
+	}
+
+	userID, ok := claims["pending_user_id"].(float64)
+	if !ok || userID <= 0 {
+		return 0, false, fmt.Errorf("无效的验证令牌")
+	}
+	remember, _ := claims["remember"].(bool)
+
+	return uint(userID), remember, nil
+}
@@ -0,0 +1,245 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/andycai/unitool/models"
+	"gorm.io/gorm"
+)
+
+const (
+	providerTypeOIDC = "oidc"
+	providerTypeLDAP = "ldap"
+)
+
+// errInvalidCredentials 外部身份源拒绝了用户名或密码，计入登录失败次数
+var errInvalidCredentials = errors.New("用户名或密码错误")
+
+// providerNamePattern 身份源名称会出现在回调地址中，只允许字母、数字、下划线和短横线
+var providerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ExternalIdentity 外部身份源返回的用户信息
+type ExternalIdentity struct {
+	Provider string   // 身份源名称
+	Subject  string   // 身份源中的唯一标识，OIDC 为 sub，LDAP 为 DN
+	Username string   // 用户名
+	Nickname string   // 昵称
+	Email    string   // 邮箱
+	Groups   []string // 用户组，用于映射角色
+}
+
+// Provider 外部身份源
+type Provider interface {
+	Name() string
+	Type() string
+	DisplayName() string
+	Config() *providerConfig
+}
+
+// PasswordProvider 使用用户名和密码认证的身份源，例如 LDAP
+type PasswordProvider interface {
+	Provider
+	Authenticate(ctx context.Context, username, password string) (*ExternalIdentity, error)
+}
+
+// RedirectProvider 通过浏览器跳转认证的身份源，例如 OIDC 授权码模式
+type RedirectProvider interface {
+	Provider
+	// AuthCodeURL 返回跳转到身份源的授权地址
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	// Exchange 使用回调中的授权码换取用户信息
+	Exchange(ctx context.Context, code, nonce, verifier string) (*ExternalIdentity, error)
+}
+
+// providerFactories 按类型创建身份源
+var providerFactories = map[string]func(cfg providerConfig) (Provider, error){
+	providerTypeOIDC: newOIDCProvider,
+	providerTypeLDAP: newLDAPProvider,
+}
+
+// baseProvider 身份源的公共实现
+type baseProvider struct {
+	cfg providerConfig
+}
+
+func (p *baseProvider) Name() string            { return p.cfg.Name }
+func (p *baseProvider) Type() string            { return p.cfg.Type }
+func (p *baseProvider) Config() *providerConfig { return &p.cfg }
+
+func (p *baseProvider) DisplayName() string {
+	if p.cfg.DisplayName != "" {
+		return p.cfg.DisplayName
+	}
+	return p.cfg.Name
+}
+
+// buildProviders 根据配置创建身份源
+func buildProviders(configs []providerConfig) (map[string]Provider, error) {
+	providers := make(map[string]Provider, len(configs))
+	for _, cfg := range configs {
+		if !providerNamePattern.MatchString(cfg.Name) {
+			return nil, fmt.Errorf("modules.login.providers 的 name 只能包含字母、数字、下划线和短横线: %q", cfg.Name)
+		}
+		if _, ok := providers[cfg.Name]; ok {
+			return nil, fmt.Errorf("modules.login.providers 的 name 重复: %s", cfg.Name)
+		}
+
+		factory, ok := providerFactories[cfg.Type]
+		if !ok {
+			return nil, fmt.Errorf("身份源 %s 的 type 无效: %q", cfg.Name, cfg.Type)
+		}
+		for _, m := range cfg.RoleMappings {
+			if m.Group == "" || m.Role == "" {
+				return nil, fmt.Errorf("身份源 %s 的 role_mappings 必须同时配置 group 和 role", cfg.Name)
+			}
+		}
+
+		provider, err := factory(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("身份源 %s 配置无效: %w", cfg.Name, err)
+		}
+		providers[cfg.Name] = provider
+	}
+	return providers, nil
+}
+
+// getProvider 按名称获取身份源
+func getProvider(name string) (Provider, bool) {
+	p, ok := getConfig().providers[name]
+	return p, ok
+}
+
+// mapRoles 返回所有匹配的映射规则对应的角色名称，按规则顺序去重，没有匹配时返回默认角色
+func mapRoles(cfg *providerConfig, groups []string) []string {
+	var names []string
+	for _, m := range cfg.RoleMappings {
+		if slices.Contains(names, m.Role) {
+			continue
+		}
+		for _, group := range groups {
+			if groupMatches(m.Group, group) {
+				names = append(names, m.Role)
+				break
+			}
+		}
+	}
+	if len(names) == 0 && cfg.DefaultRole != "" {
+		names = append(names, cfg.DefaultRole)
+	}
+	return names
+}
+
+// groupMatches 用户组可以是名称或 DN，规则可以写完整 DN 或第一个 RDN 的值，例如 cn=dev,ou=groups 匹配 dev
+func groupMatches(rule, group string) bool {
+	rule = strings.TrimSpace(rule)
+	group = strings.TrimSpace(group)
+	if strings.EqualFold(rule, group) {
+		return true
+	}
+
+	rdn, _, _ := strings.Cut(group, ",")
+	if _, value, ok := strings.Cut(rdn, "="); ok {
+		return strings.EqualFold(rule, strings.TrimSpace(value))
+	}
+	return false
+}
+
+// provisionUser 根据外部身份查找或创建本地用户，每次登录同步昵称，并用映射的角色替换用户的角色
+func provisionUser(provider Provider, ext *ExternalIdentity) (*models.User, bool, error) {
+	if ext.Subject == "" {
+		return nil, false, fmt.Errorf("身份源没有返回用户标识")
+	}
+	if ext.Username == "" {
+		ext.Username = ext.Subject
+	}
+	if len(ext.Username) > 50 {
+		return nil, false, fmt.Errorf("用户名过长: %s", ext.Username)
+	}
+	if ext.Nickname == "" {
+		ext.Nickname = ext.Username
+	}
+
+	// 角色映射到不存在的角色视为配置错误
+	roleNames := mapRoles(provider.Config(), ext.Groups)
+	roles := make([]models.Role, 0, len(roleNames))
+	for _, name := range roleNames {
+		var role models.Role
+		if err := app.DB.Where("name = ?", name).First(&role).Error; err != nil {
+			return nil, false, fmt.Errorf("角色不存在: %s", name)
+		}
+		roles = append(roles, role)
+	}
+
+	var user models.User
+	created := false
+	err := app.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("provider = ? AND external_id = ?", provider.Name(), ext.Subject).First(&user).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if len(roles) == 0 {
+				return fmt.Errorf("没有匹配的角色，请联系管理员")
+			}
+
+			// 不接管同名的本地账号或其它身份源的账号
+			var count int64
+			if err := tx.Model(&models.User{}).Where("username = ?", ext.Username).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("用户名 %s 已被其它账号使用", ext.Username)
+			}
+
+			now := time.Now()
+			user = models.User{
+				Username:      ext.Username,
+				Nickname:      ext.Nickname,
+				Roles:         roles,
+				Status:        1,
+				HasChangedPwd: true, // 外部账号没有本地密码，不需要首次修改密码
+				Provider:      provider.Name(),
+				ExternalID:    ext.Subject,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			}
+			created = true
+			return tx.Create(&user).Error
+		}
+
+		if user.Status != 1 {
+			return fmt.Errorf("账号已被禁用")
+		}
+
+		if user.Nickname != ext.Nickname {
+			if err := tx.Model(&user).Updates(map[string]interface{}{
+				"nickname":   ext.Nickname,
+				"updated_at": time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		// 没有匹配任何角色时保留原有角色
+		if len(roles) == 0 {
+			return nil
+		}
+		return tx.Model(&user).Association("Roles").Replace(roles)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	app.InvalidateUser(user.ID)
+
+	if err := app.DB.Preload("Roles").First(&user, user.ID).Error; err != nil {
+		return nil, false, err
+	}
+	return &user, created, nil
+}
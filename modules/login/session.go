@@ -0,0 +1,153 @@
+package login
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/models"
+	"github.com/andycai/unitool/modules/adminlog"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SessionVO 登录会话，current 表示当前请求使用的会话
+type SessionVO struct {
+	models.UserSession
+	Current bool `json:"current"`
+}
+
+func toSessionVOs(list []models.UserSession, currentID string) []SessionVO {
+	result := make([]SessionVO, 0, len(list))
+	for _, session := range list {
+		result = append(result, SessionVO{
+			UserSession: session,
+			Current:     currentID != "" && session.SessionID == currentID,
+		})
+	}
+	return result
+}
+
+// getMySessionsAction 获取当前用户的登录会话
+func getMySessionsAction(c *fiber.Ctx) error {
+	identity := core.CurrentIdentity(c)
+
+	list, err := app.Sessions.UserSessions(identity.UserID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取会话列表失败"})
+	}
+	return c.JSON(toSessionVOs(list, core.CurrentSessionID(c)))
+}
+
+// revokeMySessionAction 撤销当前用户的某个会话
+func revokeMySessionAction(c *fiber.Ctx) error {
+	identity := core.CurrentIdentity(c)
+
+	var session models.UserSession
+	if err := app.DB.Where("id = ? AND user_id = ?", c.Params("id"), identity.UserID).First(&session).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "会话不存在"})
+	}
+	if session.SessionID == core.CurrentSessionID(c) {
+		return c.Status(400).JSON(fiber.Map{"error": "不能撤销当前会话，请使用退出登录"})
+	}
+
+	if _, err := app.Sessions.Revoke(session.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "撤销会话失败"})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "revoke", "session", session.ID, fmt.Sprintf("撤销会话：%s", describeSession(&session)))
+
+	return c.JSON(fiber.Map{"message": "会话已撤销"})
+}
+
+// revokeMyOtherSessionsAction 撤销当前用户除当前会话外的所有会话
+func revokeMyOtherSessionsAction(c *fiber.Ctx) error {
+	identity := core.CurrentIdentity(c)
+
+	count, err := app.Sessions.RevokeUserSessions(identity.UserID, core.CurrentSessionID(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "撤销会话失败"})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "revoke", "session", 0, fmt.Sprintf("撤销其它会话：%d 个", count))
+
+	return c.JSON(fiber.Map{"message": "会话已撤销", "count": count})
+}
+
+// getSessionsAction 获取所有用户的登录会话
+func getSessionsAction(c *fiber.Ctx) error {
+	var total int64
+
+	page := c.QueryInt("page", 1)
+	pageSize := c.QueryInt("pageSize", 20)
+	username := c.Query("username")
+
+	query := app.DB.Model(&models.UserSession{}).Where("expires_at > ?", time.Now())
+	if userID := c.QueryInt("user_id"); userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if username != "" {
+		query = query.Where("username LIKE ?", "%"+username+"%")
+	}
+
+	query.Count(&total)
+
+	var list []models.UserSession
+	if err := query.Order("last_seen_at desc").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&list).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取会话列表失败"})
+	}
+
+	return c.JSON(fiber.Map{
+		"total": total,
+		"data":  toSessionVOs(list, core.CurrentSessionID(c)),
+	})
+}
+
+// revokeSessionAction 强制下线某个会话
+func revokeSessionAction(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "无效的会话ID"})
+	}
+
+	session, err := app.Sessions.Revoke(uint(id))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "会话不存在"})
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "revoke", "session", session.ID, fmt.Sprintf("强制下线会话：%s", describeSession(session)))
+
+	return c.JSON(fiber.Map{"message": "会话已撤销"})
+}
+
+// revokeUserSessionsAction 强制下线用户的所有会话，同时撤销该用户的所有令牌
+func revokeUserSessionsAction(c *fiber.Ctx) error {
+	var user models.User
+	if err := app.DB.First(&user, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "用户不存在"})
+	}
+
+	count, err := app.Sessions.RevokeUserSessions(user.ID, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "撤销会话失败"})
+	}
+	if err := app.Tokens.RevokeUserTokens(user.ID); err != nil {
+		log.Printf("撤销用户 %d 的令牌失败: %v", user.ID, err)
+	}
+
+	// 记录操作日志
+	adminlog.CreateAdminLog(c, "revoke", "session", 0, fmt.Sprintf("强制下线用户 %s 的所有会话：%d 个", user.Username, count))
+
+	return c.JSON(fiber.Map{"message": "会话已撤销", "count": count})
+}
+
+// describeSession 会话的描述，用于操作日志
+func describeSession(session *models.UserSession) string {
+	return fmt.Sprintf("用户 %s，IP %s，登录于 %s", session.Username, session.IP, session.CreatedAt.Format("2006-01-02 15:04:05"))
+}
@@ -0,0 +1,186 @@
+package login
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/lib/totp"
+	"github.com/andycai/unitool/models"
+	"gorm.io/gorm"
+)
+
+const (
+	totpIssuer        = "UniTool"       // 身份验证器中显示的发行方
+	mfaTokenPurpose   = "mfa"           // 两步验证令牌的用途
+	mfaTokenExpire    = 5 * time.Minute // 完成第二步验证的时限
+	recoveryCodeCount = 10              // 每次生成的恢复码数量
+)
+
+// totpRequired 用户登录时是否需要两步验证
+func totpRequired(user *models.User) bool {
+	return user.TOTPEnabled || roleRequiresTOTP(user.ID)
+}
+
+// roleRequiresTOTP 用户直接分配或继承的任意角色是否要求两步验证，查询失败时按要求处理
+func roleRequiresTOTP(userID uint) bool {
+	roles, err := core.EffectiveRoles(app.DB, userID)
+	if err != nil {
+		log.Printf("获取用户 %d 的角色失败: %v", userID, err)
+		return true
+	}
+	for _, role := range roles {
+		if role.RequireTOTP {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyTOTP 校验一次性密码，同一步数的密码只能使用一次
+func verifyTOTP(user *models.User, code string) bool {
+	if user.TOTPSecret == "" {
+		return false
+	}
+
+	counter, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok || counter <= user.TOTPCounter {
+		return false
+	}
+
+	// 条件更新，并发请求中只有一个能使用该密码
+	result := app.DB.Model(&models.User{}).
+		Where("id = ? AND totp_counter < ?", user.ID, counter).
+		Update("totp_counter", counter)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+
+	user.TOTPCounter = counter
+	return true
+}
+
+// useRecoveryCode 使用恢复码，每个恢复码只能使用一次
+func useRecoveryCode(userID uint, code string) bool {
+	result := app.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// verifySecondFactor 校验一次性密码或恢复码，返回使用的验证方式
+func verifySecondFactor(user *models.User, code string) (string, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return "totp", verifyTOTP(user, code)
+	}
+	return "recovery_code", useRecoveryCode(user.ID, code)
+}
+
+// generateRecoveryCodes 重新生成恢复码，旧的恢复码全部失效，明文只返回一次
+func generateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(buf)
+		code = code[:5] + "-" + code[5:]
+
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{
+			UserID:    userID,
+			CodeHash:  hashRecoveryCode(code),
+			CreatedAt: time.Now(),
+		})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode 计算恢复码的哈希值，忽略大小写和分隔符
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// enrollTOTP 生成待确认的密钥，确认前不会启用两步验证
+func enrollTOTP(user *models.User) (string, string, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := app.DB.Model(user).Updates(map[string]interface{}{
+		"totp_secret":  secret,
+		"totp_counter": 0,
+	}).Error; err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.ProvisioningURI(totpIssuer, user.Username, secret), nil
+}
+
+// activateTOTP 校验待确认密钥生成的密码，成功后启用两步验证并生成恢复码
+func activateTOTP(user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("已启用两步验证")
+	}
+	if user.TOTPSecret == "" {
+		return nil, fmt.Errorf("请先获取两步验证密钥")
+	}
+	if !verifyTOTP(user, code) {
+		return nil, fmt.Errorf("验证码错误")
+	}
+
+	var codes []string
+	err := app.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPEnabled = true
+	app.InvalidateUser(user.ID)
+	return codes, nil
+}
+
+// resetTOTP 关闭两步验证并删除密钥和恢复码
+func resetTOTP(userID uint) error {
+	defer app.InvalidateUser(userID)
+
+	return app.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_enabled": false,
+			"totp_secret":  "",
+			"totp_counter": 0,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
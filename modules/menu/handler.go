@@ -31,6 +31,24 @@ func getMenuTree(c *fiber.Ctx) error {
 	return c.JSON(tree)
 }
 
+// getMyMenuTree 获取当前用户有权限访问的菜单树，没有可见子菜单的分组不返回
+func getMyMenuTree(c *fiber.Ctx) error {
+	menus, err := menuDao.GetMenusByPermissions(app.CurrentPermissions(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "获取菜单列表失败",
+		})
+	}
+
+	tree := make([]*models.MenuTree, 0)
+	for _, node := range menuDao.BuildMenuTree(menus, 0) {
+		if len(node.Children) > 0 || node.Menu.Permission != "" {
+			tree = append(tree, node)
+		}
+	}
+	return c.JSON(tree)
+}
+
 // createMenu 创建菜单
 func createMenu(c *fiber.Ctx) error {
 	menu := new(models.Menu)
@@ -14,7 +14,22 @@ type menuModule struct {
 }
 
 func init() {
-	core.RegisterModule(&menuModule{}, enum.ModulePriorityMenu)
+	core.RegisterModule(&menuModule{}, core.ModuleInfo{
+		Name:    enum.ModuleMenu,
+		Depends: []string{enum.ModuleUser, enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "menu:list", Name: "菜单列表", Description: "查看菜单列表"},
+			{Code: "menu:create", Name: "创建菜单", Description: "创建新菜单"},
+			{Code: "menu:update", Name: "更新菜单", Description: "更新菜单信息"},
+			{Code: "menu:delete", Name: "删除菜单", Description: "删除菜单"},
+		},
+		Menus: []core.MenuDecl{
+			{Name: "系统管理", Path: "/admin", Icon: "system", Sort: 1},
+			{Name: "游戏管理", Path: "/admin/game", Icon: "game", Sort: 2},
+			{Name: "系统工具", Path: "/admin/tools", Icon: "tools", Sort: 3},
+			{Parent: "/admin", Name: "菜单管理", Path: "/admin/menus", Icon: "menu", Sort: 4, Permission: "menu:list"},
+		},
+	})
 }
 
 func (m *menuModule) Awake(a *core.App) error {
@@ -24,7 +39,7 @@ func (m *menuModule) Awake(a *core.App) error {
 	}
 	menuDao = NewMenuDao()
 
-	return initData()
+	return nil
 }
 
 func (m *menuModule) AddPublicRouters() error {
@@ -49,6 +64,7 @@ func (m *menuModule) AddAuthRouters() error {
 	// api
 	app.RouterApi.Get("/menus", app.HasPermission("menu:list"), listMenus)
 	app.RouterApi.Get("/menus/tree", app.HasPermission("menu:list"), getMenuTree)
+	app.RouterApi.Get("/menus/my/tree", core.DenyAPIKey, getMyMenuTree)
 	app.RouterApi.Post("/menus", app.HasPermission("menu:create"), createMenu)
 	app.RouterApi.Put("/menus/:id", app.HasPermission("menu:update"), updateMenu)
 	app.RouterApi.Delete("/menus/:id", app.HasPermission("menu:delete"), deleteMenu)
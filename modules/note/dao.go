@@ -29,70 +29,6 @@ func initData() error {
 
 	// 开始事务
 	return app.DB.Transaction(func(tx *gorm.DB) error {
-		// 创建笔记相关权限
-		permissions := []models.Permission{
-			{
-				Name:        "笔记列表",
-				Code:        "note:list",
-				Description: "查看笔记列表",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "创建笔记",
-				Code:        "note:create",
-				Description: "创建新笔记",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "更新笔记",
-				Code:        "note:update",
-				Description: "更新笔记信息",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "删除笔记",
-				Code:        "note:delete",
-				Description: "删除笔记",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "分类列表",
-				Code:        "note:category:list",
-				Description: "查看笔记分类列表",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "创建分类",
-				Code:        "note:category:create",
-				Description: "创建笔记分类",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "更新分类",
-				Code:        "note:category:update",
-				Description: "更新笔记分类",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "删除分类",
-				Code:        "note:category:delete",
-				Description: "删除笔记分类",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-		}
-
-		if err := tx.Create(&permissions).Error; err != nil {
-			return err
-		}
-
 		// 初始化笔记类型
 		noteCategories := []models.NoteCategory{
 			{
@@ -12,7 +12,20 @@ type noteModule struct {
 }
 
 func init() {
-	core.RegisterModule(&noteModule{}, enum.ModulePriorityNote)
+	core.RegisterModule(&noteModule{}, core.ModuleInfo{
+		Name:    enum.ModuleNote,
+		Depends: []string{enum.ModuleUser, enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "note:list", Name: "笔记列表", Description: "查看笔记列表"},
+			{Code: "note:create", Name: "创建笔记", Description: "创建新笔记"},
+			{Code: "note:update", Name: "更新笔记", Description: "更新笔记信息"},
+			{Code: "note:delete", Name: "删除笔记", Description: "删除笔记"},
+			{Code: "note:category:list", Name: "分类列表", Description: "查看笔记分类列表"},
+			{Code: "note:category:create", Name: "创建分类", Description: "创建笔记分类"},
+			{Code: "note:category:update", Name: "更新分类", Description: "更新笔记分类"},
+			{Code: "note:category:delete", Name: "删除分类", Description: "删除笔记分类"},
+		},
+	})
 }
 
 func (m *noteModule) Awake(a *core.App) error {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/andycai/unitool/core"
 	"github.com/andycai/unitool/models"
 	"github.com/andycai/unitool/modules/adminlog"
 	"github.com/gofiber/fiber/v2"
@@ -37,6 +38,10 @@ func createPermission(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
 	}
 
+	if err := core.ValidatePermissionPattern(req.Code); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	// 检查权限编码是否已存在
 	var count int64
 	app.DB.Model(&models.Permission{}).Where("code = ?", req.Code).Count(&count)
@@ -83,6 +88,10 @@ func updatePermission(c *fiber.Ctx) error {
 		updates["name"] = req.Name
 	}
 	if req.Code != "" {
+		if err := core.ValidatePermissionPattern(req.Code); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
 		// 检查新的权限编码是否已存在
 		var count int64
 		app.DB.Model(&models.Permission{}).Where("code = ? AND id != ?", req.Code, id).Count(&count)
@@ -98,6 +107,7 @@ func updatePermission(c *fiber.Ctx) error {
 	if err := app.DB.Model(&permission).Updates(updates).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "更新权限失败"})
 	}
+	app.InvalidateAllUsers()
 
 	// 记录操作日志
 	adminlog.CreateAdminLog(c, "update", "permission", permission.ID, fmt.Sprintf("更新权限：%s", permission.Name))
@@ -127,6 +137,7 @@ func deletePermission(c *fiber.Ctx) error {
 	if err := app.DB.Delete(&permission).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "删除权限失败"})
 	}
+	app.InvalidateAllUsers()
 
 	// 记录操作日志
 	adminlog.CreateAdminLog(c, "delete", "permission", permission.ID, fmt.Sprintf("删除权限：%s", permission.Name))
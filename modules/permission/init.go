@@ -13,7 +13,19 @@ type permissionModule struct {
 }
 
 func init() {
-	core.RegisterModule(&permissionModule{}, enum.ModulePriorityPermission)
+	core.RegisterModule(&permissionModule{}, core.ModuleInfo{
+		Name:    enum.ModulePermission,
+		Depends: []string{enum.ModuleUser, enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "permission:list", Name: "权限列表", Description: "查看权限列表"},
+			{Code: "permission:create", Name: "创建权限", Description: "创建新权限"},
+			{Code: "permission:update", Name: "更新权限", Description: "更新权限信息"},
+			{Code: "permission:delete", Name: "删除权限", Description: "删除权限"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin", Name: "权限管理", Path: "/admin/permissions", Icon: "permission", Sort: 3, Permission: "permission:list"},
+		},
+	})
 }
 
 func (m *permissionModule) Awake(a *core.App) error {
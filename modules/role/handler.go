@@ -2,8 +2,10 @@ package role
 
 import (
 	"fmt"
+	"slices"
 	"time"
 
+	"github.com/andycai/unitool/core"
 	"github.com/andycai/unitool/models"
 	"github.com/andycai/unitool/modules/adminlog"
 	"github.com/gofiber/fiber/v2"
@@ -12,19 +14,41 @@ import (
 type CreateRoleRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
-	Permissions []uint `json:"permissions"` // 权限ID列表
+	Permissions []uint `json:"permissions"`  // 权限ID列表
+	RequireTOTP bool   `json:"require_totp"` // 是否强制启用两步验证
+	// 禁止的权限编码，支持通配符
+	DeniedPermissions []string `json:"denied_permissions"`
+	ParentIDs         []uint   `json:"parent_ids"` // 继承的角色ID列表
 }
 
 type UpdateRoleRequest struct {
 	Name        string `json:"name,omitempty"`
 	Description string `json:"description,omitempty"`
 	Permissions []uint `json:"permissions,omitempty"`
+	RequireTOTP *bool  `json:"require_totp,omitempty"`
+	// 为 nil 时不修改，空列表表示清空
+	DeniedPermissions *[]string `json:"denied_permissions,omitempty"`
+	ParentIDs         *[]uint   `json:"parent_ids,omitempty"`
+}
+
+// validateDenied 校验禁止的权限编码并去重
+func validateDenied(codes []string) ([]string, error) {
+	denied := make([]string, 0, len(codes))
+	for _, code := range codes {
+		if err := core.ValidatePermissionPattern(code); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(denied, code) {
+			denied = append(denied, code)
+		}
+	}
+	return denied, nil
 }
 
 // getRoles 获取角色列表
 func getRoles(c *fiber.Ctx) error {
 	var roles []models.Role
-	if err := app.DB.Preload("Permissions").Find(&roles).Error; err != nil {
+	if err := app.DB.Preload("Permissions").Preload("Parents").Find(&roles).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "获取角色列表失败"})
 	}
 	return c.JSON(roles)
@@ -37,6 +61,11 @@ func createRole(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
 	}
 
+	denied, err := validateDenied(req.DeniedPermissions)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	// 检查角色名是否已存在
 	var count int64
 	app.DB.Model(&models.Role{}).Where("name = ?", req.Name).Count(&count)
@@ -44,14 +73,21 @@ func createRole(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "角色名已存在"})
 	}
 
+	// 新角色不会被其它角色继承，只需校验父角色存在
+	if err := core.CheckRoleParents(app.DB, 0, req.ParentIDs); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	// 开始事务
 	tx := app.DB.Begin()
 
 	role := models.Role{
-		Name:        req.Name,
-		Description: req.Description,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		Name:              req.Name,
+		Description:       req.Description,
+		RequireTOTP:       req.RequireTOTP,
+		DeniedPermissions: denied,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
 	}
 
 	if err := tx.Create(&role).Error; err != nil {
@@ -73,6 +109,20 @@ func createRole(c *fiber.Ctx) error {
 		}
 	}
 
+	// 添加继承关联
+	if len(req.ParentIDs) > 0 {
+		var parents []models.Role
+		if err := tx.Find(&parents, req.ParentIDs).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "获取父角色失败"})
+		}
+
+		if err := tx.Model(&role).Association("Parents").Replace(parents); err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "设置父角色失败"})
+		}
+	}
+
 	tx.Commit()
 
 	// 记录操作日志
@@ -94,6 +144,12 @@ func updateRole(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "角色不存在"})
 	}
 
+	if req.ParentIDs != nil {
+		if err := core.CheckRoleParents(app.DB, role.ID, *req.ParentIDs); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
 	// 开始事务
 	tx := app.DB.Begin()
 
@@ -107,6 +163,21 @@ func updateRole(c *fiber.Ctx) error {
 	if req.Description != "" {
 		updates["description"] = req.Description
 	}
+	if req.RequireTOTP != nil {
+		updates["require_totp"] = *req.RequireTOTP
+	}
+	if req.DeniedPermissions != nil {
+		denied, err := validateDenied(*req.DeniedPermissions)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		// 序列化字段需要通过结构体更新
+		if err := tx.Model(&role).Select("DeniedPermissions").Updates(&models.Role{DeniedPermissions: denied}).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "更新角色失败"})
+		}
+	}
 
 	if err := tx.Model(&role).Updates(updates).Error; err != nil {
 		tx.Rollback()
@@ -127,7 +198,24 @@ func updateRole(c *fiber.Ctx) error {
 		}
 	}
 
+	// 更新继承关联
+	if req.ParentIDs != nil {
+		var parents []models.Role
+		if len(*req.ParentIDs) > 0 {
+			if err := tx.Find(&parents, *req.ParentIDs).Error; err != nil {
+				tx.Rollback()
+				return c.Status(500).JSON(fiber.Map{"error": "获取父角色失败"})
+			}
+		}
+
+		if err := tx.Model(&role).Association("Parents").Replace(parents); err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "更新父角色失败"})
+		}
+	}
+
 	tx.Commit()
+	app.InvalidateAllUsers()
 
 	// 记录操作日志
 	adminlog.CreateAdminLog(c, "update", "role", role.ID, fmt.Sprintf("更新角色：%s", role.Name))
@@ -141,7 +229,7 @@ func deleteRole(c *fiber.Ctx) error {
 
 	// 检查是否有用户使用此角色
 	var count int64
-	if err := app.DB.Model(&models.User{}).Where("role_id = ?", id).Count(&count).Error; err != nil {
+	if err := app.DB.Model(&models.UserRole{}).Where("role_id = ?", id).Count(&count).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "检查角色使用状态失败"})
 	}
 
@@ -149,6 +237,15 @@ func deleteRole(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "该角色正在使用中，无法删除"})
 	}
 
+	// 检查是否有其它角色继承此角色
+	if err := app.DB.Model(&models.RoleParent{}).Where("parent_id = ?", id).Count(&count).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "检查角色使用状态失败"})
+	}
+
+	if count > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "该角色被其它角色继承，无法删除"})
+	}
+
 	var role models.Role
 	if err := app.DB.First(&role, id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "角色不存在"})
@@ -163,6 +260,18 @@ func deleteRole(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "清除权限关联失败"})
 	}
 
+	// 清除继承关联
+	if err := tx.Model(&role).Association("Parents").Clear(); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": "清除继承关联失败"})
+	}
+
+	// 删除授权给该角色的资源授权
+	if err := tx.Where("subject_type = ? AND subject_id = ?", models.ACLSubjectRole, role.ID).Delete(&models.ResourceACL{}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": "清除资源授权失败"})
+	}
+
 	// 删除角色
 	if err := tx.Delete(&role).Error; err != nil {
 		tx.Rollback()
@@ -170,6 +279,7 @@ func deleteRole(c *fiber.Ctx) error {
 	}
 
 	tx.Commit()
+	app.InvalidateAllUsers()
 
 	// 记录操作日志
 	adminlog.CreateAdminLog(c, "delete", "role", role.ID, fmt.Sprintf("删除角色：%s", role.Name))
@@ -13,7 +13,19 @@ type roleModule struct {
 }
 
 func init() {
-	core.RegisterModule(&roleModule{}, enum.ModulePriorityRole)
+	core.RegisterModule(&roleModule{}, core.ModuleInfo{
+		Name:    enum.ModuleRole,
+		Depends: []string{enum.ModuleUser, enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "role:list", Name: "角色列表", Description: "查看角色列表"},
+			{Code: "role:create", Name: "创建角色", Description: "创建新角色"},
+			{Code: "role:update", Name: "更新角色", Description: "更新角色信息"},
+			{Code: "role:delete", Name: "删除角色", Description: "删除角色"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin", Name: "角色管理", Path: "/admin/roles", Icon: "role", Sort: 2, Permission: "role:list"},
+		},
+	})
 }
 
 func (m *roleModule) Awake(a *core.App) error {
@@ -0,0 +1,57 @@
+package serverconf
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/enum"
+)
+
+// moduleConfig 模块配置 [modules.serverconf]
+type moduleConfig struct {
+	ServerList string `toml:"server_list"`
+	LastServer string `toml:"last_server"`
+	ServerInfo string `toml:"server_info"`
+	NoticeList string `toml:"notice_list"`
+	NoticeNum  string `toml:"notice_num"`
+}
+
+var conf atomic.Pointer[moduleConfig]
+
+// getConfig 获取当前生效的模块配置
+func getConfig() *moduleConfig {
+	return conf.Load()
+}
+
+// loadConfig 读取模块配置，未配置的字段沿用旧的 [json_paths] 配置
+func loadConfig(cfg *core.Config) (*moduleConfig, error) {
+	mc := &moduleConfig{
+		ServerList: cfg.JSONPaths.ServerList,
+		LastServer: cfg.JSONPaths.LastServer,
+		ServerInfo: cfg.JSONPaths.ServerInfo,
+		NoticeList: cfg.JSONPaths.NoticeList,
+		NoticeNum:  cfg.JSONPaths.NoticeNum,
+	}
+
+	if err := core.DecodeModuleConfig(enum.ModuleServerconf, mc); err != nil {
+		return nil, err
+	}
+
+	return mc, nil
+}
+
+// checkConfig 检查 JSON 文件路径是否存在
+func checkConfig(mc *moduleConfig) error {
+	paths := []string{mc.ServerList, mc.LastServer, mc.ServerInfo, mc.NoticeList, mc.NoticeNum}
+	for _, path := range paths {
+		if path == "" {
+			return fmt.Errorf("配置文件路径不能为空")
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("配置文件不可用: %v", err)
+		}
+	}
+	return nil
+}
@@ -172,7 +172,7 @@ func writeJSONFile(path string, v interface{}) error {
 // 获取服务器列表
 func getServerList(c *fiber.Ctx) error {
 	var serverList ServerList
-	if err := readJSONFile(app.Config.JSONPaths.ServerList, &serverList); err != nil {
+	if err := readJSONFile(getConfig().ServerList, &serverList); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(serverList)
@@ -185,7 +185,7 @@ func updateServerList(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
 	}
 
-	if err := writeJSONFile(app.Config.JSONPaths.ServerList, serverList); err != nil {
+	if err := writeJSONFile(getConfig().ServerList, serverList); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -198,7 +198,7 @@ func updateServerList(c *fiber.Ctx) error {
 // 获取最后登录服务器
 func getLastServer(c *fiber.Ctx) error {
 	var lastServer LastServer
-	if err := readJSONFile(app.Config.JSONPaths.LastServer, &lastServer); err != nil {
+	if err := readJSONFile(getConfig().LastServer, &lastServer); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(lastServer)
@@ -211,7 +211,7 @@ func updateLastServer(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
 	}
 
-	if err := writeJSONFile(app.Config.JSONPaths.LastServer, lastServer); err != nil {
+	if err := writeJSONFile(getConfig().LastServer, lastServer); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -224,7 +224,7 @@ func updateLastServer(c *fiber.Ctx) error {
 // 获取服务器信息
 func getServerInfo(c *fiber.Ctx) error {
 	var data map[string]interface{}
-	if err := readJSONFile(app.Config.JSONPaths.ServerInfo, &data); err != nil {
+	if err := readJSONFile(getConfig().ServerInfo, &data); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -262,7 +262,7 @@ func updateServerInfo(c *fiber.Ctx) error {
 	}
 
 	// 保存时只保存实际的字段值，不保存 fields 数组
-	if err := writeJSONFile(app.Config.JSONPaths.ServerInfo, config.ToMap()); err != nil {
+	if err := writeJSONFile(getConfig().ServerInfo, config.ToMap()); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -275,7 +275,7 @@ func updateServerInfo(c *fiber.Ctx) error {
 // 获取公告列表
 func getNoticeList(c *fiber.Ctx) error {
 	var noticeList NoticeList
-	if err := readJSONFile(app.Config.JSONPaths.NoticeList, &noticeList); err != nil {
+	if err := readJSONFile(getConfig().NoticeList, &noticeList); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(noticeList)
@@ -288,7 +288,7 @@ func updateNoticeList(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "无效的请求数据"})
 	}
 
-	if err := writeJSONFile(app.Config.JSONPaths.NoticeList, noticeList); err != nil {
+	if err := writeJSONFile(getConfig().NoticeList, noticeList); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -301,7 +301,7 @@ func updateNoticeList(c *fiber.Ctx) error {
 // 获取公告数量
 func getNoticeNum(c *fiber.Ctx) error {
 	var noticeNum NoticeNum
-	if err := readJSONFile(app.Config.JSONPaths.NoticeNum, &noticeNum); err != nil {
+	if err := readJSONFile(getConfig().NoticeNum, &noticeNum); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(noticeNum)
@@ -319,7 +319,7 @@ func updateNoticeNum(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "eject 必须是非负整数"})
 	}
 
-	if err := writeJSONFile(app.Config.JSONPaths.NoticeNum, noticeNum); err != nil {
+	if err := writeJSONFile(getConfig().NoticeNum, noticeNum); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -1,6 +1,8 @@
 package serverconf
 
 import (
+	"log"
+
 	"github.com/andycai/unitool/core"
 	"github.com/andycai/unitool/enum"
 	"github.com/gofiber/fiber/v2"
@@ -13,11 +15,48 @@ type serverconfModule struct {
 }
 
 func init() {
-	core.RegisterModule(&serverconfModule{}, enum.ModulePriorityServerconf)
+	core.RegisterModule(&serverconfModule{}, core.ModuleInfo{
+		Name:    enum.ModuleServerconf,
+		Depends: []string{enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "serverconf:list", Name: "服务器配置", Description: "查看服务器配置"},
+			{Code: "serverconf:update", Name: "服务器配置更新", Description: "更新服务器配置"},
+			{Code: "serverconf:delete", Name: "服务器配置删除", Description: "删除服务器配置"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin/tools", Name: "服务器配置", Path: "/admin/serverconf", Icon: "serverconf", Sort: 3, Permission: "serverconf:list"},
+		},
+	})
 }
 
 func (m *serverconfModule) Awake(a *core.App) error {
 	app = a
+
+	mc, err := loadConfig(a.Config())
+	if err != nil {
+		return err
+	}
+	conf.Store(mc)
+
+	return nil
+}
+
+func (m *serverconfModule) OnConfigChange(old, new *core.Config) error {
+	mc, err := loadConfig(new)
+	if err != nil {
+		return err
+	}
+	if *mc == *getConfig() {
+		return nil
+	}
+
+	// 检查新的 JSON 文件路径是否存在，不可用时保留原配置
+	if err := checkConfig(mc); err != nil {
+		return err
+	}
+	conf.Store(mc)
+
+	log.Printf("服务器配置文件路径已更新")
 	return nil
 }
 
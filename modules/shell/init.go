@@ -13,7 +13,9 @@ type shellModule struct {
 }
 
 func init() {
-	core.RegisterModule(&shellModule{}, enum.ModulePriorityShell)
+	core.RegisterModule(&shellModule{}, core.ModuleInfo{
+		Name: enum.ModuleShell,
+	})
 }
 
 func (m *shellModule) Awake(a *core.App) error {
@@ -24,7 +26,7 @@ func (m *shellModule) Awake(a *core.App) error {
 func (m *shellModule) AddPublicRouters() error {
 	// public
 	app.RouterPublicApi.Post("/shell", func(c *fiber.Ctx) error {
-		return execShell(c, app.Config.Server.ScriptPath)
+		return execShell(c, app.Config().Server.ScriptPath)
 	})
 
 	return nil
@@ -14,7 +14,17 @@ type statsModule struct {
 }
 
 func init() {
-	core.RegisterModule(&statsModule{}, enum.ModulePriorityStats)
+	core.RegisterModule(&statsModule{}, core.ModuleInfo{
+		Name:    enum.ModuleStats,
+		Depends: []string{enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "stats:list", Name: "游戏统计", Description: "查看游戏统计"},
+			{Code: "stats:delete", Name: "删除游戏统计", Description: "删除游戏统计"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin/game", Name: "性能统计", Path: "/admin/stats", Icon: "stats", Sort: 2, Permission: "stats:list"},
+		},
+	})
 }
 
 func (m *statsModule) Awake(a *core.App) error {
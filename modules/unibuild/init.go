@@ -12,7 +12,9 @@ type uniBuildModule struct {
 }
 
 func init() {
-	core.RegisterModule(&uniBuildModule{}, enum.ModulePriorityUnibuild)
+	core.RegisterModule(&uniBuildModule{}, core.ModuleInfo{
+		Name: enum.ModuleUnibuild,
+	})
 }
 
 func (m *uniBuildModule) Awake(a *core.App) error {
@@ -7,6 +7,7 @@ import (
 	"github.com/andycai/unitool/models"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserDao struct {
@@ -18,7 +19,34 @@ func NewUserDao() *UserDao {
 
 // 数据迁移
 func autoMigrate() error {
-	return app.DB.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.RolePermission{}, &models.ModuleInit{})
+	return app.DB.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.RolePermission{},
+		&models.UserRole{}, &models.RoleParent{}, &models.ModuleInit{})
+}
+
+// migrateUserRoles 将旧版本 users.role_id 的单角色迁移到 user_roles 表，迁移后清零，可以重复执行
+func migrateUserRoles() error {
+	var users []models.User
+	if err := app.DB.Select("id", "role_id").Where("role_id <> 0").Find(&users).Error; err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	return app.DB.Transaction(func(tx *gorm.DB) error {
+		rows := make([]models.UserRole, 0, len(users))
+		for _, u := range users {
+			rows = append(rows, models.UserRole{UserID: u.ID, RoleID: u.RoleID})
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("role_id <> 0").Update("role_id", 0).Error; err != nil {
+			return err
+		}
+		log.Printf("已将 %d 个用户的角色迁移到 user_roles", len(users))
+		return nil
+	})
 }
 
 // 初始化数据
@@ -31,260 +59,10 @@ func initData() error {
 
 	// 开始事务
 	return app.DB.Transaction(func(tx *gorm.DB) error {
-		// 1. 创建基础权限
-		permissions := []models.Permission{
-			// 用户
-			{
-				Name:        "用户列表",
-				Code:        "user:list",
-				Description: "查看用户列表",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "创建用户",
-				Code:        "user:create",
-				Description: "创建新用户",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "更新用户",
-				Code:        "user:update",
-				Description: "更新用户信息",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "删除用户",
-				Code:        "user:delete",
-				Description: "删除用户",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			// 角色
-			{
-				Name:        "角色列表",
-				Code:        "role:list",
-				Description: "查看角色列表",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "创建角色",
-				Code:        "role:create",
-				Description: "创建新角色",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "更新角色",
-				Code:        "role:update",
-				Description: "更新角色信息",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "删除角色",
-				Code:        "role:delete",
-				Description: "删除角色",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			// 权限
-			{
-				Name:        "权限列表",
-				Code:        "permission:list",
-				Description: "查看权限列表",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "创建权限",
-				Code:        "permission:create",
-				Description: "创建新权限",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "更新权限",
-				Code:        "permission:update",
-				Description: "更新权限信息",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "删除权限",
-				Code:        "permission:delete",
-				Description: "删除权限",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			// 菜单
-			{
-				Name:        "菜单列表",
-				Code:        "menu:list",
-				Description: "查看菜单列表",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "创建菜单",
-				Code:        "menu:create",
-				Description: "创建新菜单",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "更新菜单",
-				Code:        "menu:update",
-				Description: "更新菜单信息",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "删除菜单",
-				Code:        "menu:delete",
-				Description: "删除菜单",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			// 系统日志
-			{
-				Name:        "日志列表",
-				Code:        "adminlog:list",
-				Description: "查看操作日志",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "删除日志",
-				Code:        "adminlog:delete",
-				Description: "删除操作日志",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			// 游戏日志
-			{
-				Name:        "游戏日志",
-				Code:        "gamelog:list",
-				Description: "查看游戏日志",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "删除游戏日志",
-				Code:        "gamelog:delete",
-				Description: "删除游戏日志",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			// 游戏统计
-			{
-				Name:        "游戏统计",
-				Code:        "stats:list",
-				Description: "查看游戏统计",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "删除游戏统计",
-				Code:        "stats:delete",
-				Description: "删除游戏统计",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			// 文件浏览
-			{
-				Name:        "文件浏览",
-				Code:        "browse:list",
-				Description: "查看文件浏览",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "文件FTP上传",
-				Code:        "browse:ftp",
-				Description: "FTP上传文件",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "文件删除",
-				Code:        "browse:delete",
-				Description: "删除文件",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			// 服务器配置
-			{
-				Name:        "服务器配置",
-				Code:        "serverconf:list",
-				Description: "查看服务器配置",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "服务器配置更新",
-				Code:        "serverconf:update",
-				Description: "更新服务器配置",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "服务器配置删除",
-				Code:        "serverconf:delete",
-				Description: "删除服务器配置",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			// 任务管理
-			{
-				Name:        "构建任务查看",
-				Code:        "citask:list",
-				Description: "查看构建任务",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "构建任务创建",
-				Code:        "citask:create",
-				Description: "创建构建任务",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "构建任务更新",
-				Code:        "citask:update",
-				Description: "更新构建任务",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "构建任务删除",
-				Code:        "citask:delete",
-				Description: "删除构建任务",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-			{
-				Name:        "构建任务执行",
-				Code:        "citask:run",
-				Description: "执行构建任务",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			},
-		}
-
-		if err := tx.Create(&permissions).Error; err != nil {
-			return err
-		}
-
-		// 2. 创建管理员角色
+		// 1. 创建管理员角色，权限由各模块声明，启动同步时授予 auth.admin_role 配置的角色
 		adminRole := models.Role{
 			Name:        "超级管理员",
 			Description: "系统超级管理员",
-			Permissions: permissions, // 赋予所有权限
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
 		}
@@ -293,7 +71,7 @@ func initData() error {
 			return err
 		}
 
-		// 3. 创建管理员用户
+		// 2. 创建管理员用户
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte("admin123"), bcrypt.DefaultCost)
 		if err != nil {
 			return err
@@ -303,7 +81,7 @@ func initData() error {
 			Username:  "admin",
 			Password:  string(hashedPassword),
 			Nickname:  "系统管理员",
-			RoleID:    adminRole.ID,
+			Roles:     []models.Role{adminRole},
 			Status:    1,
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
@@ -313,7 +91,7 @@ func initData() error {
 			return err
 		}
 
-		// 4. 标记模块已初始化
+		// 3. 标记模块已初始化
 		if err := tx.Create(&models.ModuleInit{
 			Module:      "user",
 			Initialized: 1,
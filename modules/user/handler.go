@@ -2,32 +2,63 @@ package user
 
 import (
 	"fmt"
+	"log"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/andycai/unitool/core"
+	"github.com/andycai/unitool/enum"
 	"github.com/andycai/unitool/models"
 	"github.com/andycai/unitool/modules/adminlog"
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type CreateUserRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Nickname string `json:"nickname"`
-	RoleID   uint   `json:"role_id"`
+	RoleIDs  []uint `json:"role_ids"`
+	RoleID   uint   `json:"role_id,omitempty"` // 兼容旧接口，role_ids 为空时使用
 }
 
 type UpdateUserRequest struct {
 	Password string `json:"password,omitempty"`
 	Nickname string `json:"nickname,omitempty"`
-	RoleID   uint   `json:"role_id,omitempty"`
-	Status   *int   `json:"status,omitempty"`
+	// 为 nil 时不修改，空列表表示移除所有角色
+	RoleIDs *[]uint `json:"role_ids,omitempty"`
+	RoleID  uint    `json:"role_id,omitempty"` // 兼容旧接口，role_ids 为 nil 时使用
+	Status  *int    `json:"status,omitempty"`
+}
+
+// findRoles 按ID查找角色，有不存在的角色时返回错误
+func findRoles(ids []uint) ([]models.Role, error) {
+	roles := make([]models.Role, 0, len(ids))
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	if err := app.DB.Where("id IN ?", ids).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[uint]bool, len(roles))
+	for _, role := range roles {
+		found[role.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return nil, fmt.Errorf("角色不存在: %d", id)
+		}
+	}
+	return roles, nil
 }
 
 // getUsersAction 获取用户列表
 func getUsersAction(c *fiber.Ctx) error {
 	var users []models.User
-	if err := app.DB.Preload("Role").Find(&users).Error; err != nil {
+	if err := app.DB.Preload("Roles").Find(&users).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "获取用户列表失败"})
 	}
 	return c.JSON(users)
@@ -47,6 +78,14 @@ func createUserAction(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "用户名已存在"})
 	}
 
+	if len(req.RoleIDs) == 0 && req.RoleID != 0 {
+		req.RoleIDs = []uint{req.RoleID}
+	}
+	roles, err := findRoles(req.RoleIDs)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	// 加密密码
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -57,7 +96,7 @@ func createUserAction(c *fiber.Ctx) error {
 		Username:  req.Username,
 		Password:  string(hashedPassword),
 		Nickname:  req.Nickname,
-		RoleID:    req.RoleID,
+		Roles:     roles,
 		Status:    1,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -88,9 +127,6 @@ func updateUserAction(c *fiber.Ctx) error {
 	if req.Nickname != "" {
 		updates["nickname"] = req.Nickname
 	}
-	if req.RoleID != 0 {
-		updates["role_id"] = req.RoleID
-	}
 	if req.Status != nil {
 		updates["status"] = *req.Status
 	}
@@ -102,14 +138,44 @@ func updateUserAction(c *fiber.Ctx) error {
 		updates["password"] = string(hashedPassword)
 	}
 
+	if req.RoleIDs == nil && req.RoleID != 0 {
+		req.RoleIDs = &[]uint{req.RoleID}
+	}
+	var roles []models.Role
+	if req.RoleIDs != nil {
+		var err error
+		if roles, err = findRoles(*req.RoleIDs); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
 	var user models.User
 	if err := app.DB.First(&user, id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "用户不存在"})
 	}
 
-	if err := app.DB.Model(&user).Updates(updates).Error; err != nil {
+	err := app.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if req.RoleIDs != nil {
+			return tx.Model(&user).Association("Roles").Replace(roles)
+		}
+		return nil
+	})
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "更新用户失败"})
 	}
+	app.InvalidateUser(user.ID)
+
+	// 禁用用户后，立即撤销其所有会话和令牌；重置密码后，之前签发的令牌全部失效
+	if req.Status != nil && *req.Status == 0 {
+		revokeUserAccess(user.ID)
+	} else if req.Password != "" {
+		if err := app.Tokens.RevokeUserTokens(user.ID); err != nil {
+			log.Printf("撤销用户 %d 的令牌失败: %v", user.ID, err)
+		}
+	}
 
 	// 记录操作日志
 	adminlog.CreateAdminLog(c, "update", "user", user.ID, fmt.Sprintf("更新用户：%s", user.Username))
@@ -128,11 +194,25 @@ func deleteUserAction(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := app.DB.Delete(&user).Error; err != nil {
+	err := app.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Association("Roles").Clear(); err != nil {
+			return err
+		}
+		// 删除授权给该用户的资源授权，避免新用户复用ID后获得授权
+		if err := tx.Where("subject_type = ? AND subject_id = ?", models.ACLSubjectUser, user.ID).Delete(&models.ResourceACL{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "删除用户失败",
 		})
 	}
+	app.InvalidateUser(user.ID)
+
+	// 撤销该用户的所有会话和令牌
+	revokeUserAccess(user.ID)
 
 	// 记录操作日志
 	adminlog.CreateAdminLog(c, "delete", "user", user.ID, fmt.Sprintf("删除用户：%s", user.Username))
@@ -141,3 +221,92 @@ func deleteUserAction(c *fiber.Ctx) error {
 		"message": "删除成功",
 	})
 }
+
+// revokeUserAccess 撤销用户的所有登录会话、令牌和访问令牌，用户被禁用或删除时调用
+func revokeUserAccess(userID uint) {
+	if _, err := app.Sessions.RevokeUserSessions(userID, ""); err != nil {
+		log.Printf("撤销用户 %d 的会话失败: %v", userID, err)
+	}
+	if err := app.Tokens.RevokeUserTokens(userID); err != nil {
+		log.Printf("撤销用户 %d 的令牌失败: %v", userID, err)
+	}
+	// 访问令牌模块未启用时没有访问令牌表
+	if !core.IsModuleEnabled(enum.ModuleAPIKey) {
+		return
+	}
+	if err := app.DB.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		log.Printf("撤销用户 %d 的访问令牌失败: %v", userID, err)
+	}
+}
+
+// getUserPermissionsAction 预览用户的有效权限，包括继承的角色。
+// 传入 role_ids 参数（逗号分隔）时按这些角色计算，用于保存前预览
+func getUserPermissionsAction(c *fiber.Ctx) error {
+	var user models.User
+	if err := app.DB.First(&user, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "用户不存在"})
+	}
+
+	var roleIDs []uint
+	if raw, ok := c.Queries()["role_ids"]; ok {
+		for _, part := range strings.Split(raw, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			id, err := strconv.ParseUint(part, 10, 64)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "无效的角色ID"})
+			}
+			roleIDs = append(roleIDs, uint(id))
+		}
+		if _, err := findRoles(roleIDs); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	} else {
+		ids, err := core.UserRoleIDs(app.DB, user.ID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "获取用户角色失败"})
+		}
+		roleIDs = ids
+	}
+
+	roles, err := core.ExpandRoles(app.DB, roleIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取用户角色失败"})
+	}
+	// 临时授予的权限与角色无关，预览时同样计入
+	extra, _, err := core.ExtraGrants(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取临时权限失败"})
+	}
+	set := core.NewRolePermissionSet(roles, extra...)
+	permissions, err := core.GrantedPermissions(app.DB, set)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "获取权限列表失败"})
+	}
+
+	direct := make(map[uint]bool, len(roleIDs))
+	for _, id := range roleIDs {
+		direct[id] = true
+	}
+	roleList := make([]fiber.Map, 0, len(roles))
+	for _, role := range roles {
+		roleList = append(roleList, fiber.Map{
+			"id":        role.ID,
+			"name":      role.Name,
+			"inherited": !direct[role.ID],
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"code": 0,
+		"data": fiber.Map{
+			"roles":       roleList,
+			"permissions": permissions,
+			"granted":     set.Codes(),
+			"denied":      set.Denied(),
+			"temporary":   extra,
+		},
+	})
+}
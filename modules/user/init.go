@@ -13,7 +13,19 @@ type userModule struct {
 }
 
 func init() {
-	core.RegisterModule(&userModule{}, enum.ModulePriorityUser)
+	core.RegisterModule(&userModule{}, core.ModuleInfo{
+		Name:    enum.ModuleUser,
+		Depends: []string{enum.ModuleAdminlog},
+		Permissions: []core.PermissionDecl{
+			{Code: "user:list", Name: "用户列表", Description: "查看用户列表"},
+			{Code: "user:create", Name: "创建用户", Description: "创建新用户"},
+			{Code: "user:update", Name: "更新用户", Description: "更新用户信息"},
+			{Code: "user:delete", Name: "删除用户", Description: "删除用户"},
+		},
+		Menus: []core.MenuDecl{
+			{Parent: "/admin", Name: "用户管理", Path: "/admin/users", Icon: "user", Sort: 1, Permission: "user:list"},
+		},
+	})
 }
 
 func (m *userModule) Awake(a *core.App) error {
@@ -22,6 +34,9 @@ func (m *userModule) Awake(a *core.App) error {
 	if err := autoMigrate(); err != nil {
 		return err
 	}
+	if err := migrateUserRoles(); err != nil {
+		return err
+	}
 
 	return initData()
 }
@@ -39,6 +54,7 @@ func (m *userModule) AddAuthRouters() error {
 
 	// api
 	app.RouterApi.Get("/users", app.HasPermission("user:list"), getUsersAction)
+	app.RouterApi.Get("/users/:id/permissions", app.HasPermission("user:list"), getUserPermissionsAction)
 	app.RouterApi.Post("/users", app.HasPermission("user:create"), createUserAction)
 	app.RouterApi.Put("/users/:id", app.HasPermission("user:update"), updateUserAction)
 	app.RouterApi.Delete("/users/:id", app.HasPermission("user:delete"), deleteUserAction)
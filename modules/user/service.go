@@ -17,11 +17,10 @@ func GetByID(id uint) *models.User {
 }
 
 func Current(c *fiber.Ctx) *models.User {
-	isAuthenticated, userID := core.GetSession(c)
-
-	if !isAuthenticated {
+	identity := core.CurrentIdentity(c)
+	if identity == nil {
 		return nil
 	}
 
-	return GetByID(userID)
+	return GetByID(identity.UserID)
 }
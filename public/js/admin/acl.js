@@ -0,0 +1,138 @@
+// Resource ACL management functionality
+function aclManagement() {
+    return {
+        acls: [],
+        total: 0,
+        page: 1,
+        pageSize: 20,
+        filter: {
+            resource_type: '',
+            resource: ''
+        },
+        options: {
+            tasks: [],
+            roles: [],
+            users: []
+        },
+        showModal: false,
+        form: {
+            resource_type: 'citask_task',
+            resource: '',
+            subject_type: 'role',
+            subject_id: ''
+        },
+        loading: false,
+        resourceTypes: {
+            citask_task: '构建任务',
+            browse_path: '文件路径'
+        },
+        subjectTypes: {
+            role: '角色',
+            user: '用户'
+        },
+        init() {
+            this.fetchACLs();
+        },
+        async fetchACLs() {
+            try {
+                const params = new URLSearchParams({ page: this.page, pageSize: this.pageSize });
+                if (this.filter.resource_type) params.set('resource_type', this.filter.resource_type);
+                if (this.filter.resource) params.set('resource', this.filter.resource);
+                const response = await fetch(`/api/acl?${params}`);
+                if (!response.ok) throw new Error('获取授权列表失败');
+                const result = await response.json();
+                this.acls = result.data;
+                this.total = result.total;
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async fetchOptions() {
+            try {
+                const response = await fetch('/api/acl/options');
+                if (!response.ok) throw new Error('获取选项失败');
+                this.options = await response.json();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        createACL() {
+            this.form = {
+                resource_type: 'citask_task',
+                resource: '',
+                subject_type: 'role',
+                subject_id: ''
+            };
+            this.fetchOptions();
+            this.showModal = true;
+        },
+        closeModal() {
+            this.showModal = false;
+        },
+        async submitForm() {
+            if (this.loading) return;
+            if (!this.form.subject_id) {
+                Alpine.store('notification').show('请选择授权对象', 'error');
+                return;
+            }
+            this.loading = true;
+
+            try {
+                const response = await fetch('/api/acl', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify({
+                        ...this.form,
+                        subject_id: parseInt(this.form.subject_id)
+                    })
+                });
+
+                const result = await response.json();
+                if (!response.ok) {
+                    throw new Error(result.error || '保存失败');
+                }
+
+                Alpine.store('notification').show('授权已添加', 'success');
+                this.closeModal();
+                this.fetchACLs();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            } finally {
+                this.loading = false;
+            }
+        },
+        async deleteACL(item) {
+            if (!confirm('确定要删除这条授权吗？')) return;
+
+            try {
+                const response = await fetch(`/api/acl/${item.id}`, {
+                    method: 'DELETE'
+                });
+
+                const result = await response.json();
+                if (!response.ok) {
+                    throw new Error(result.error || '删除失败');
+                }
+
+                Alpine.store('notification').show('删除成功', 'success');
+                this.fetchACLs();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        formatDate(date) {
+            if (!date) return '';
+            return new Date(date).toLocaleString('zh-CN', {
+                year: 'numeric',
+                month: '2-digit',
+                day: '2-digit',
+                hour: '2-digit',
+                minute: '2-digit',
+                second: '2-digit',
+                hour12: false
+            });
+        }
+    }
+}
@@ -0,0 +1,164 @@
+// Personal access token management functionality
+function apiKeyManagement() {
+    return {
+        tab: 'mine',
+        apiKeys: [],
+        allAPIKeys: [],
+        scopes: [],
+        canManageAll: false,
+        showCreateModal: false,
+        createdKey: '',
+        form: {
+            name: '',
+            scopes: [],
+            expires_days: 90
+        },
+        loading: false,
+        init() {
+            this.fetchAPIKeys();
+            this.fetchScopes();
+            this.checkManageAll();
+        },
+        async fetchAPIKeys() {
+            try {
+                const response = await fetch('/api/apikeys');
+                if (!response.ok) throw new Error('获取令牌列表失败');
+                this.apiKeys = await response.json();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async fetchAllAPIKeys() {
+            try {
+                const response = await fetch('/api/apikeys/all');
+                if (!response.ok) throw new Error('获取令牌列表失败');
+                this.allAPIKeys = await response.json();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async fetchScopes() {
+            try {
+                const response = await fetch('/api/apikeys/scopes');
+                if (!response.ok) throw new Error('获取权限列表失败');
+                this.scopes = await response.json();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async checkManageAll() {
+            const response = await fetch('/api/apikeys/all');
+            this.canManageAll = response.ok;
+        },
+        createAPIKey() {
+            this.createdKey = '';
+            this.form = {
+                name: '',
+                scopes: [],
+                expires_days: 90
+            };
+            this.showCreateModal = true;
+        },
+        closeModal() {
+            this.showCreateModal = false;
+            this.createdKey = '';
+        },
+        async submitForm() {
+            if (this.loading) return;
+            this.loading = true;
+
+            try {
+                const response = await fetch('/api/apikeys', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify(this.form)
+                });
+
+                const result = await response.json();
+                if (!response.ok) {
+                    throw new Error(result.error || '创建失败');
+                }
+
+                this.createdKey = result.data.key;
+                Alpine.store('notification').show('令牌创建成功', 'success');
+                this.fetchAPIKeys();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            } finally {
+                this.loading = false;
+            }
+        },
+        async copyKey() {
+            try {
+                await navigator.clipboard.writeText(this.createdKey);
+                Alpine.store('notification').show('已复制到剪贴板', 'success');
+            } catch (error) {
+                Alpine.store('notification').show('复制失败，请手动复制', 'error');
+            }
+        },
+        async revokeAPIKey(key) {
+            if (!confirm(`确定要撤销令牌「${key.name}」吗？撤销后立即失效。`)) return;
+
+            const url = this.tab === 'all' ? `/api/apikeys/all/${key.id}/revoke` : `/api/apikeys/${key.id}/revoke`;
+            try {
+                const response = await fetch(url, {
+                    method: 'POST'
+                });
+
+                if (!response.ok) {
+                    const error = await response.json();
+                    throw new Error(error.error || '撤销失败');
+                }
+
+                Alpine.store('notification').show('令牌已撤销', 'success');
+                this.fetchAPIKeys();
+                if (this.tab === 'all') this.fetchAllAPIKeys();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async deleteAPIKey(id) {
+            if (!confirm('确定要删除这个令牌吗？')) return;
+
+            try {
+                const response = await fetch(`/api/apikeys/${id}`, {
+                    method: 'DELETE'
+                });
+
+                if (!response.ok) {
+                    const error = await response.json();
+                    throw new Error(error.error || '删除失败');
+                }
+
+                Alpine.store('notification').show('令牌删除成功', 'success');
+                this.fetchAPIKeys();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        statusText(key) {
+            if (key.revoked_at) return '已撤销';
+            if (key.expires_at && new Date(key.expires_at) <= new Date()) return '已过期';
+            return '有效';
+        },
+        statusClass(key) {
+            if (key.revoked_at) return 'bg-red-100 text-red-800 dark:bg-red-900 dark:text-red-200';
+            if (key.expires_at && new Date(key.expires_at) <= new Date()) return 'bg-gray-100 text-gray-800 dark:bg-gray-700 dark:text-gray-200';
+            return 'bg-green-100 text-green-800 dark:bg-green-900 dark:text-green-200';
+        },
+        formatDate(date) {
+            if (!date) return '';
+            return new Date(date).toLocaleString('zh-CN', {
+                year: 'numeric',
+                month: '2-digit',
+                day: '2-digit',
+                hour: '2-digit',
+                minute: '2-digit',
+                second: '2-digit',
+                hour12: false
+            });
+        }
+    }
+}
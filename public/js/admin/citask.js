@@ -9,10 +9,15 @@ function taskManagement() {
         showLogDetailModal: false,
         showProgressModal: false,
         showRunningTasksModal: false,
+        showQueueModal: false,
+        showRunModal: false,
+        runForm: { task: null, values: {} },
+        queue: { queued: [], running: [], max_concurrent: 0 },
         editMode: false,
-        progressInterval: null,
+        progressSource: null,
+        outputTailSize: 65536,
         runningTasks: [],
-        runningTasksInterval: null,
+        eventSource: null,
         currentPage: 1,
         pageSize: 10,
         totalPages: 1,
@@ -34,7 +39,11 @@ function taskManagement() {
             timeout: 300,
             status: 'active',
             enable_cron: 0,
-            cron_expr: ''
+            cron_expr: '',
+            max_concurrent: 0,
+            priority: 0,
+            requeue_interrupted: 0,
+            params: []
         },
         userScrolled: false,
         autoScroll: true,
@@ -43,7 +52,7 @@ function taskManagement() {
             this.userScrolled = false;
             this.autoScroll = true;
             this.fetchTasks();
-            this.startRunningTasksPolling();
+            this.startRunStateStream();
         },
         async fetchTasks() {
             try {
@@ -69,7 +78,11 @@ function taskManagement() {
                 timeout: 300,
                 status: 'active',
                 enable_cron: 0,
-                cron_expr: ''
+                cron_expr: '',
+                max_concurrent: 0,
+                priority: 0,
+                requeue_interrupted: 0,
+                params: []
             };
             this.showTaskModal = true;
         },
@@ -77,7 +90,9 @@ function taskManagement() {
             this.editMode = true;
             this.form = {
                 ...task,
-                enable_cron: parseInt(task.enable_cron) || 0
+                enable_cron: parseInt(task.enable_cron) || 0,
+                requeue_interrupted: parseInt(task.requeue_interrupted) || 0,
+                params: (task.params || []).map(param => ({ ...param }))
             };
             this.showTaskModal = true;
         },
@@ -87,7 +102,7 @@ function taskManagement() {
                 const method = this.editMode ? 'PUT' : 'POST';
                 
                 // Create a copy of the form data and remove id field for new tasks
-                const formData = { ...this.form };
+                const formData = { ...this.form, params: this.normalizeParams(this.form.params) };
                 if (!this.editMode) {
                     delete formData.id;
                 }
@@ -110,9 +125,40 @@ function taskManagement() {
                 Alpine.store('notification').show(this.editMode ? '任务更新成功' : '任务创建成功', 'success');
             } catch (error) {
                 console.error('保存任务失败:', error);
-                Alpine.store('notification').show('保存任务失败', 'error');
+                Alpine.store('notification').show(`保存任务失败: ${error.message}`, 'error');
             }
         },
+        paramHint() {
+            if (this.form.type === 'script') {
+                return '脚本中通过环境变量使用参数，如参数 platform 对应 $PARAM_PLATFORM';
+            }
+            return 'URL、请求头和请求体中通过模板使用参数，如 {{.platform}}，URL 中可用 {{urlquery .platform}}，JSON 中可用 {{json .platform}}';
+        },
+        addParam() {
+            this.form.params = [...(this.form.params || []), { name: '', label: '', type: 'string', default: '', required: false }];
+        },
+        removeParam(index) {
+            this.form.params.splice(index, 1);
+        },
+        // 去掉与参数类型无关的设置，空的最小值和最大值表示不限制
+        normalizeParams(params) {
+            return (params || []).map(param => {
+                const result = {
+                    name: param.name.trim(),
+                    label: param.label,
+                    type: param.type,
+                    default: param.type === 'secret' ? '' : String(param.default ?? ''),
+                    required: !!param.required
+                };
+                if (param.type === 'enum') result.options = param.options || [];
+                if (param.type === 'string' || param.type === 'secret') result.pattern = param.pattern || '';
+                if (param.type === 'number') {
+                    if (param.min !== '' && param.min != null) result.min = Number(param.min);
+                    if (param.max !== '' && param.max != null) result.max = Number(param.max);
+                }
+                return result;
+            });
+        },
         async deleteTask(id) {
             if (!confirm('确定要删除这个任务吗？')) return;
 
@@ -130,12 +176,44 @@ function taskManagement() {
                 Alpine.store('notification').show('删除任务失败', 'error');
             }
         },
-        async runTask(task) {
+        // 任务定义了参数时先填写参数，否则直接执行
+        runTask(task) {
+            if (!task.params?.length) {
+                this.startRun(task, {});
+                return;
+            }
+
+            const values = {};
+            task.params.forEach(param => {
+                values[param.name] = param.type === 'bool' ? param.default === 'true' : (param.default ?? '');
+            });
+            this.runForm = { task, values };
+            this.showRunModal = true;
+        },
+        async submitRun() {
+            const { task, values } = this.runForm;
+            const params = {};
+            task.params.forEach(param => {
+                const value = values[param.name];
+                params[param.name] = param.type === 'bool' ? !!value : String(value ?? '');
+            });
+            if (await this.startRun(task, params)) {
+                this.showRunModal = false;
+            }
+        },
+        async startRun(task, params) {
             try {
                 const response = await fetch(`/api/citask/run/${task.id}`, {
-                    method: 'POST'
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify({ params })
                 });
-                if (!response.ok) throw new Error('启动任务失败');
+                if (!response.ok) {
+                    const error = await response.json().catch(() => ({}));
+                    throw new Error(error.error || '启动任务失败');
+                }
                 const taskLog = await response.json();
                 
                 // 显示进度模态框
@@ -143,19 +221,26 @@ function taskManagement() {
                 this.currentTaskLog = taskLog;
                 this.showProgressModal = true;
                 
-                // 开始轮询进度
-                this.startProgressPolling(taskLog.id);
+                // 订阅运行输出和状态
+                this.startProgressStream(taskLog.id);
                 
                 // 自动滚动到底部
                 this.$nextTick(() => {
                     this.scrollOutputToBottom();
                 });
 
-                Alpine.store('notification').show('任务已开始执行', 'success');
+                Alpine.store('notification').show('任务已加入队列', 'success');
+                return true;
             } catch (error) {
                 Alpine.store('notification').show(error.message, 'error');
+                return false;
             }
         },
+        // 运行使用的参数值，secret 参数已由服务端隐藏
+        formatParams(params) {
+            if (!params) return '';
+            return Object.keys(params).sort().map(name => `${name}=${params[name]}`).join(', ');
+        },
         async stopTask() {
             if (!this.currentTaskLog) return;
             
@@ -165,9 +250,8 @@ function taskManagement() {
                 });
                 if (!response.ok) throw new Error('停止任务失败');
                 
-                // 停止进度轮询
-                this.stopProgressPolling();
-                
+                // 事件流会推送最终状态并在结束后自动关闭
+
                 Alpine.store('notification').show('任务已停止', 'success');
             } catch (error) {
                 Alpine.store('notification').show(error.message, 'error');
@@ -185,49 +269,76 @@ function taskManagement() {
                 Alpine.store('notification').show(error.message, 'error');
             }
         },
+        async deleteLog(log) {
+            if (!confirm('确定要删除这条运行记录吗？输出文件会一并删除')) return;
+
+            try {
+                const response = await fetch(`/api/citask/logs/${log.id}`, {
+                    method: 'DELETE',
+                });
+                if (!response.ok) {
+                    const data = await response.json().catch(() => ({}));
+                    throw new Error(data.error || '删除运行记录失败');
+                }
+
+                this.taskLogs = this.taskLogs.filter(item => item.id !== log.id);
+                this.updatePaginatedLogs();
+                this.currentPage = Math.min(this.currentPage, Math.max(this.totalPages, 1));
+                Alpine.store('notification').show('运行记录删除成功', 'success');
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
         viewLogDetail(log) {
             this.currentTaskLog = log;
             this.showLogDetailModal = true;
         },
-        startProgressPolling(logId) {
-            // 清除现有的轮询
-            this.stopProgressPolling();
-            
-            // 开始新的轮询
-            this.progressInterval = setInterval(async () => {
-                try {
-                    const response = await fetch(`/api/citask/progress/${logId}`);
-                    if (!response.ok) throw new Error('获取进度失败');
-                    const progress = await response.json();
-                    
-                    // 更新进度信息
-                    this.currentTaskLog = progress;
-                    
-                    // 根据自动滚动标志决定是否滚动到底部
-                    this.$nextTick(() => {
-                        if (this.autoScroll) {
-                            this.scrollToBottom(false);
-                        }
-                    });
-                    
-                    // 如果任务已结束，停止轮询
-                    if (progress.status !== 'running') {
-                        this.stopProgressPolling();
-                    }
-                } catch (error) {
-                    console.error('Progress polling error:', error);
-                    this.stopProgressPolling();
+        // 通过事件流接收运行的输出和状态，断线后浏览器自动重连并从最后收到的偏移量继续
+        startProgressStream(logId) {
+            this.stopProgressStream();
+
+            const source = new EventSource(`/api/citask/logs/${logId}/stream?tail=${this.outputTailSize}`);
+            this.progressSource = source;
+            this.currentTaskLog = { ...(this.currentTaskLog || {}), id: logId, output: '', output_size: 0 };
+
+            source.addEventListener('status', (event) => {
+                const status = JSON.parse(event.data);
+                this.currentTaskLog = {
+                    ...this.currentTaskLog,
+                    status: status.status,
+                    progress: status.progress,
+                    error: status.error,
+                    start_time: status.start_time,
+                    end_time: status.status === 'queued' || status.status === 'running' ? null : status.end_time
+                };
+            });
+            source.addEventListener('output', (event) => {
+                const chunk = JSON.parse(event.data);
+                let output = (this.currentTaskLog.output || '') + chunk.data;
+                // 只保留末尾部分，完整输出通过下载查看
+                if (output.length > this.outputTailSize * 4) {
+                    output = output.slice(output.length - this.outputTailSize * 4);
                 }
-            }, 1000); // 每秒轮询一次
+                this.currentTaskLog = { ...this.currentTaskLog, output, output_size: chunk.next_offset };
+
+                this.$nextTick(() => {
+                    if (this.autoScroll) {
+                        this.scrollToBottom(false);
+                    }
+                });
+            });
+            source.addEventListener('end', () => {
+                this.stopProgressStream();
+            });
         },
-        stopProgressPolling() {
-            if (this.progressInterval) {
-                clearInterval(this.progressInterval);
-                this.progressInterval = null;
+        stopProgressStream() {
+            if (this.progressSource) {
+                this.progressSource.close();
+                this.progressSource = null;
             }
         },
         closeProgress() {
-            this.stopProgressPolling();
+            this.stopProgressStream();
             this.showProgressModal = false;
             this.currentTask = null;
             this.currentTaskLog = null;
@@ -244,7 +355,10 @@ function taskManagement() {
             if (!this.currentTaskLog) return '准备中...';
             if (this.currentTaskLog.status === 'success') return '完成';
             if (this.currentTaskLog.status === 'failed') return '失败';
+            if (this.currentTaskLog.status === 'cancelled') return '已取消';
+            if (this.currentTaskLog.status === 'interrupted') return '已中断';
             if (this.currentTaskLog.status === 'running') return '执行中...';
+            if (this.currentTaskLog.status === 'queued') return '排队中...';
             return '准备中...';
         },
         getRunningTime(task) {
@@ -275,6 +389,16 @@ function taskManagement() {
                 outputLog.scrollTop = outputLog.scrollHeight;
             }
         },
+        formatSize(bytes) {
+            if (!bytes) return '0 B';
+            const units = ['B', 'KB', 'MB', 'GB'];
+            let i = 0;
+            while (bytes >= 1024 && i < units.length - 1) {
+                bytes /= 1024;
+                i++;
+            }
+            return bytes.toFixed(i === 0 ? 0 : 1) + ' ' + units[i];
+        },
         formatDate(date) {
             if (!date) return '';
             return new Date(date).toLocaleString('zh-CN', {
@@ -324,48 +448,122 @@ function taskManagement() {
             const endIndex = startIndex + this.pageSize;
             return this.taskLogs.slice(startIndex, endIndex);
         },
-        // 开始轮询正在执行的任务
-        startRunningTasksPolling() {
-            this.fetchRunningTasks();
-            // this.runningTasksInterval = setInterval(() => {
-            //     this.fetchRunningTasks();
-            // }, 5000); // 每5秒更新一次
-        },
-        // 停止轮询
-        stopRunningTasksPolling() {
-            if (this.runningTasksInterval) {
-                clearInterval(this.runningTasksInterval);
-                this.runningTasksInterval = null;
-            }
+        // 订阅所有运行的状态变化，维护正在执行的任务列表，任务队列打开时同步刷新
+        startRunStateStream() {
+            this.stopRunStateStream();
+
+            const source = new EventSource('/api/citask/events');
+            this.eventSource = source;
+
+            source.addEventListener('snapshot', (event) => {
+                const runs = JSON.parse(event.data) || [];
+                this.runningTasks = runs.filter(run => run.status === 'running').map(run => this.toRunningTask(run));
+                if (this.showQueueModal) this.fetchQueue();
+            });
+            source.addEventListener('run', (event) => {
+                const run = JSON.parse(event.data);
+                const tasks = this.runningTasks.filter(task => task.id !== run.log_id);
+                if (run.status === 'running') {
+                    tasks.push(this.toRunningTask(run));
+                }
+                this.runningTasks = tasks;
+                if (this.showQueueModal) this.fetchQueue();
+            });
         },
-        // 获取正在执行的任务
-        async fetchRunningTasks() {
-            try {
-                const response = await fetch('/api/citask/running');
-                if (!response.ok) throw new Error('获取正在执行的任务失败');
-                const tasks = await response.json();
-                const data = tasks.data == null ? [] : tasks.data;
-                this.runningTasks = data;
-            } catch (error) {
-                console.error('获取正在执行的任务失败:', error);
+        stopRunStateStream() {
+            if (this.eventSource) {
+                this.eventSource.close();
+                this.eventSource = null;
             }
         },
+        toRunningTask(run) {
+            return {
+                id: run.log_id,
+                name: run.task_name,
+                status: run.status,
+                progress: run.progress,
+                start_time: Math.floor(new Date(run.start_time).getTime() / 1000)
+            };
+        },
         // 显示正在执行的任务列表
         showRunningTasks() {
             this.showRunningTasksModal = true;
-            this.fetchRunningTasks();
+        },
+        // 显示任务队列
+        showQueue() {
+            this.showQueueModal = true;
+            this.fetchQueue();
+        },
+        async fetchQueue() {
+            try {
+                const response = await fetch('/api/citask/queue');
+                if (!response.ok) throw new Error('获取任务队列失败');
+                this.queue = await response.json();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async queueRequest(url, method, body, success) {
+            try {
+                const response = await fetch(url, {
+                    method,
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify(body || {})
+                });
+                const result = await response.json();
+                if (!response.ok) {
+                    throw new Error(result.error || '操作失败');
+                }
+                Alpine.store('notification').show(success, 'success');
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+            this.fetchQueue();
+        },
+        sourceText(item) {
+            if (item.source === 'cron') return '定时';
+            if (item.source === 'requeue') return '中断后重新排队';
+            return item.operator || '手动';
+        },
+        // 与相邻的同优先级运行交换顺序，offset 为 -1 上移，1 下移
+        canMoveQueued(index, offset) {
+            const other = this.queue.queued[index + offset];
+            return other && other.priority === this.queue.queued[index].priority;
+        },
+        moveQueued(index, offset) {
+            if (!this.canMoveQueued(index, offset)) return;
+            const item = this.queue.queued[index];
+            const other = this.queue.queued[index + offset];
+            const ids = offset < 0 ? [item.id, other.id] : [other.id, item.id];
+            this.queueRequest('/api/citask/queue/reorder', 'POST', { ids }, '队列顺序已调整');
+        },
+        changeQueuedPriority(item) {
+            const value = prompt(`调整「${item.task_name}」的优先级，数值越大越先执行：`, item.priority);
+            if (value === null) return;
+            const priority = parseInt(value);
+            if (isNaN(priority)) {
+                Alpine.store('notification').show('优先级必须是整数', 'error');
+                return;
+            }
+            this.queueRequest(`/api/citask/queue/${item.id}/priority`, 'PUT', { priority }, '优先级已调整');
+        },
+        cancelQueued(item) {
+            if (!confirm(`确定要取消「${item.task_name}」排队中的运行吗？`)) return;
+            this.queueRequest(`/api/citask/queue/${item.id}/cancel`, 'POST', null, '已取消');
         },
         // 查看任务进度
         viewTaskProgress(task) {
             this.currentTask = task;
             this.showRunningTasksModal = false;
             this.showProgressModal = true;
-            this.startProgressPolling(task.id);
+            this.startProgressStream(task.id);
         },
         // 在组件销毁时清理
         destroy() {
-            this.stopRunningTasksPolling();
-            this.stopProgressPolling();
+            this.stopRunStateStream();
+            this.stopProgressStream();
         },
         // 查看日志详情
         async viewLog(log) {
@@ -375,12 +573,12 @@ function taskManagement() {
                 if (response.ok) {
                     const progress = await response.json();
 
-                    // 如果任务正在执行中，显示进度界面
-                    if (progress.status === 'running') {
+                    // 如果任务正在排队或执行中，显示进度界面
+                    if (progress.status === 'running' || progress.status === 'queued') {
                         this.currentTask = { id: logId };
                         this.currentTaskLog = progress;
                         this.showProgressModal = true;
-                        this.startProgressPolling(logId);
+                        this.startProgressStream(logId);
                         return;
                     }
                 }
@@ -396,6 +594,9 @@ function taskManagement() {
                 'success': 'bg-green-100 text-green-800 dark:bg-green-900 dark:text-green-200',
                 'failed': 'bg-red-100 text-red-800 dark:bg-red-900 dark:text-red-200',
                 'running': 'bg-yellow-100 text-yellow-800 dark:bg-yellow-900 dark:text-yellow-200',
+                'queued': 'bg-blue-100 text-blue-800 dark:bg-blue-900 dark:text-blue-200',
+                'cancelled': 'bg-gray-100 text-gray-800 dark:bg-gray-900 dark:text-gray-200',
+                'interrupted': 'bg-orange-100 text-orange-800 dark:bg-orange-900 dark:text-orange-200',
                 'pending': 'bg-gray-100 text-gray-800 dark:bg-gray-900 dark:text-gray-200'
             };
             
@@ -403,6 +604,9 @@ function taskManagement() {
                 'success': '成功',
                 'failed': '失败',
                 'running': '执行中',
+                'queued': '排队中',
+                'cancelled': '已取消',
+                'interrupted': '已中断',
                 'pending': '等待中'
             };
 
@@ -450,7 +654,9 @@ function taskManagement() {
                 ...task,
                 id: '',
                 name: task.name + ' - copy',
-                enable_cron: parseInt(task.enable_cron) || 0
+                enable_cron: parseInt(task.enable_cron) || 0,
+                requeue_interrupted: parseInt(task.requeue_interrupted) || 0,
+                params: (task.params || []).map(param => ({ ...param }))
             };
             this.showSearchDropdown = false;
             this.searchKeyword = '';
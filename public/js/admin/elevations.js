@@ -0,0 +1,174 @@
+// Privilege elevation request and approval functionality
+function elevationManagement() {
+    return {
+        tab: 'mine',
+        elevations: [],
+        allElevations: [],
+        total: 0,
+        statusFilter: 'pending',
+        requestable: [],
+        canReview: false,
+        showCreateModal: false,
+        form: {
+            permissions: [],
+            reason: '',
+            duration: 60
+        },
+        loading: false,
+        statusNames: {
+            pending: '待审批',
+            approved: '已批准',
+            rejected: '已拒绝',
+            expired: '已到期',
+            revoked: '已撤销',
+            cancelled: '已取消'
+        },
+        init() {
+            this.fetchElevations();
+            this.checkReview();
+        },
+        async fetchElevations() {
+            try {
+                const response = await fetch('/api/elevations/mine');
+                if (!response.ok) throw new Error('获取申请列表失败');
+                this.elevations = await response.json();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async fetchAllElevations() {
+            try {
+                const params = new URLSearchParams({ pageSize: 100 });
+                if (this.statusFilter) params.set('status', this.statusFilter);
+                const response = await fetch(`/api/elevations?${params}`);
+                if (!response.ok) throw new Error('获取申请列表失败');
+                const result = await response.json();
+                this.allElevations = result.data;
+                this.total = result.total;
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async fetchRequestable() {
+            try {
+                const response = await fetch('/api/elevations/permissions');
+                if (!response.ok) throw new Error('获取权限列表失败');
+                this.requestable = await response.json();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async checkReview() {
+            const response = await fetch('/api/elevations?pageSize=1');
+            this.canReview = response.ok;
+        },
+        createElevation() {
+            this.form = {
+                permissions: [],
+                reason: '',
+                duration: 60
+            };
+            this.fetchRequestable();
+            this.showCreateModal = true;
+        },
+        closeModal() {
+            this.showCreateModal = false;
+        },
+        async submitForm() {
+            if (this.loading) return;
+            this.loading = true;
+
+            try {
+                const response = await fetch('/api/elevations', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify(this.form)
+                });
+
+                const result = await response.json();
+                if (!response.ok) {
+                    throw new Error(result.error || '提交失败');
+                }
+
+                Alpine.store('notification').show('申请已提交，等待审批', 'success');
+                this.closeModal();
+                this.fetchElevations();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            } finally {
+                this.loading = false;
+            }
+        },
+        async post(url, body, success) {
+            try {
+                const response = await fetch(url, {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify(body || {})
+                });
+
+                const result = await response.json();
+                if (!response.ok) {
+                    throw new Error(result.error || '操作失败');
+                }
+
+                Alpine.store('notification').show(success, 'success');
+                this.fetchElevations();
+                if (this.tab === 'all') this.fetchAllElevations();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        cancelElevation(item) {
+            const message = item.status === 'pending' ? '确定要取消这个申请吗？' : '确定要提前结束提权吗？结束后立即失效。';
+            if (!confirm(message)) return;
+            this.post(`/api/elevations/${item.id}/cancel`, null, '已取消');
+        },
+        approveElevation(item) {
+            const note = prompt(`批准用户「${item.username}」的申请，时长 ${item.duration} 分钟。审批意见（可选）：`, '');
+            if (note === null) return;
+            this.post(`/api/elevations/${item.id}/approve`, { note }, '已批准');
+        },
+        rejectElevation(item) {
+            const note = prompt(`拒绝用户「${item.username}」的申请，请填写原因：`, '');
+            if (note === null) return;
+            this.post(`/api/elevations/${item.id}/reject`, { note }, '已拒绝');
+        },
+        revokeElevation(item) {
+            if (!confirm(`确定要撤销用户「${item.username}」的提权吗？撤销后立即失效。`)) return;
+            this.post(`/api/elevations/${item.id}/revoke`, null, '已撤销');
+        },
+        isActive(item) {
+            return item.status === 'approved' && item.expires_at && new Date(item.expires_at) > new Date();
+        },
+        statusClass(item) {
+            switch (item.status) {
+                case 'pending':
+                    return 'bg-yellow-100 text-yellow-800 dark:bg-yellow-900 dark:text-yellow-200';
+                case 'approved':
+                    return 'bg-green-100 text-green-800 dark:bg-green-900 dark:text-green-200';
+                case 'rejected':
+                case 'revoked':
+                    return 'bg-red-100 text-red-800 dark:bg-red-900 dark:text-red-200';
+                default:
+                    return 'bg-gray-100 text-gray-800 dark:bg-gray-700 dark:text-gray-200';
+            }
+        },
+        formatDate(date) {
+            if (!date) return '';
+            return new Date(date).toLocaleString('zh-CN', {
+                year: 'numeric',
+                month: '2-digit',
+                day: '2-digit',
+                hour: '2-digit',
+                minute: '2-digit',
+                second: '2-digit',
+                hour12: false
+            });
+        }
+    }
+}
@@ -10,6 +10,8 @@ function roleManagement() {
         form: {
             name: '',
             description: '',
+            require_totp: false,
+            denied_permissions: '',
             permissions: []
         },
         loading: false,
@@ -41,7 +43,10 @@ function roleManagement() {
             this.form = {
                 name: '',
                 description: '',
-                permissions: []
+                require_totp: false,
+                denied_permissions: '',
+                permissions: [],
+                parent_ids: []
             };
             this.showCreateModal = true;
             this.showEditModal = false;
@@ -52,7 +57,10 @@ function roleManagement() {
             this.form = {
                 name: role.name,
                 description: role.description,
-                permissions: role.permissions.map(p => parseInt(p.id))
+                require_totp: role.require_totp,
+                denied_permissions: (role.denied_permissions || []).join('\n'),
+                permissions: role.permissions.map(p => parseInt(p.id)),
+                parent_ids: (role.parents || []).map(p => parseInt(p.id))
             };
             this.showEditModal = true;
             this.showCreateModal = false;
@@ -65,7 +73,10 @@ function roleManagement() {
             this.form = {
                 name: '',
                 description: '',
-                permissions: []
+                require_totp: false,
+                denied_permissions: '',
+                permissions: [],
+                parent_ids: []
             };
         },
         async submitForm() {
@@ -78,7 +89,10 @@ function roleManagement() {
                 // 确保权限 ID 都是整数
                 const formData = {
                     ...this.form,
-                    permissions: this.form.permissions.map(id => parseInt(id))
+                    permissions: this.form.permissions.map(id => parseInt(id)),
+                    parent_ids: this.form.parent_ids.map(id => parseInt(id)),
+                    // 每行一个禁止的权限编码
+                    denied_permissions: this.form.denied_permissions.split(/[\n,]/).map(code => code.trim()).filter(code => code)
                 };
                 
                 const response = await fetch(url, {
@@ -106,6 +120,10 @@ function roleManagement() {
                 this.loading = false;
             }
         },
+        parentCandidates() {
+            // 角色不能继承自己
+            return this.roles.filter(role => !this.currentRole || role.id !== this.currentRole.id);
+        },
         async deleteRole(id) {
             if (!confirm('确定要删除这个角色吗？')) return;
 
@@ -0,0 +1,139 @@
+// Account security functionality
+function securitySettings() {
+    return {
+        status: {
+            enabled: false,
+            required: false,
+            recovery_codes_left: 0
+        },
+        enrollment: null,
+        recoveryCodes: [],
+        code: '',
+        password: '',
+        disableCode: '',
+        sessions: [],
+        init() {
+            this.fetchStatus();
+            this.fetchSessions();
+        },
+        async fetchStatus() {
+            try {
+                const response = await fetch('/api/totp');
+                if (!response.ok) throw new Error('获取两步验证状态失败');
+                this.status = await response.json();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async post(url, body) {
+            const response = await fetch(url, {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify(body || {})
+            });
+
+            const result = await response.json();
+            if (!response.ok) {
+                throw new Error(result.error || '操作失败');
+            }
+            return result;
+        },
+        async enroll() {
+            try {
+                this.enrollment = await this.post('/api/totp/enroll');
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async enable() {
+            try {
+                const result = await this.post('/api/totp/enable', { code: this.code });
+                this.recoveryCodes = result.recovery_codes;
+                this.enrollment = null;
+                this.code = '';
+                Alpine.store('notification').show('两步验证已启用', 'success');
+                this.fetchStatus();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async regenerate() {
+            try {
+                const result = await this.post('/api/totp/recovery-codes', { code: this.code });
+                this.recoveryCodes = result.recovery_codes;
+                this.code = '';
+                Alpine.store('notification').show('恢复码已重新生成', 'success');
+                this.fetchStatus();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async disable() {
+            if (!confirm('确定要关闭两步验证吗？')) return;
+
+            try {
+                await this.post('/api/totp/disable', { password: this.password, code: this.disableCode });
+                this.password = '';
+                this.disableCode = '';
+                this.recoveryCodes = [];
+                Alpine.store('notification').show('两步验证已关闭', 'success');
+                this.fetchStatus();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async fetchSessions() {
+            try {
+                const response = await fetch('/api/sessions/mine');
+                if (!response.ok) throw new Error('获取会话列表失败');
+                this.sessions = await response.json();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async revokeSession(session) {
+            if (!confirm(`确定要撤销来自 ${session.ip} 的会话吗？`)) return;
+
+            try {
+                const response = await fetch(`/api/sessions/mine/${session.id}`, {
+                    method: 'DELETE'
+                });
+
+                const result = await response.json();
+                if (!response.ok) {
+                    throw new Error(result.error || '撤销失败');
+                }
+
+                Alpine.store('notification').show('会话已撤销', 'success');
+                this.fetchSessions();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async revokeOtherSessions() {
+            if (!confirm('确定要退出除当前会话外的所有会话吗？')) return;
+
+            try {
+                await this.post('/api/sessions/mine/revoke-others');
+                Alpine.store('notification').show('其它会话已退出', 'success');
+                this.fetchSessions();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        formatDate(date) {
+            if (!date) return '';
+            return new Date(date).toLocaleString('zh-CN', {
+                year: 'numeric',
+                month: '2-digit',
+                day: '2-digit',
+                hour: '2-digit',
+                minute: '2-digit',
+                second: '2-digit',
+                hour12: false
+            });
+        }
+    }
+}
@@ -0,0 +1,61 @@
+// Active session management functionality
+function sessionManagement() {
+    return {
+        sessions: [],
+        total: 0,
+        page: 1,
+        pageSize: 20,
+        username: '',
+        init() {
+            this.fetchSessions();
+        },
+        async fetchSessions() {
+            try {
+                const params = new URLSearchParams({ page: this.page, pageSize: this.pageSize });
+                if (this.username) params.set('username', this.username);
+                const response = await fetch(`/api/sessions?${params}`);
+                if (!response.ok) throw new Error('获取会话列表失败');
+                const result = await response.json();
+                this.sessions = result.data;
+                this.total = result.total;
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async request(url, method, success) {
+            try {
+                const response = await fetch(url, { method });
+
+                const result = await response.json();
+                if (!response.ok) {
+                    throw new Error(result.error || '操作失败');
+                }
+
+                Alpine.store('notification').show(success, 'success');
+                this.fetchSessions();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        revokeSession(session) {
+            if (!confirm(`确定要强制下线用户「${session.username}」来自 ${session.ip} 的会话吗？`)) return;
+            this.request(`/api/sessions/${session.id}`, 'DELETE', '会话已撤销');
+        },
+        revokeUserSessions(session) {
+            if (!confirm(`确定要强制下线用户「${session.username}」的所有会话吗？该用户的令牌也将立即失效。`)) return;
+            this.request(`/api/users/${session.user_id}/sessions/revoke`, 'POST', '用户已下线');
+        },
+        formatDate(date) {
+            if (!date) return '';
+            return new Date(date).toLocaleString('zh-CN', {
+                year: 'numeric',
+                month: '2-digit',
+                day: '2-digit',
+                hour: '2-digit',
+                minute: '2-digit',
+                second: '2-digit',
+                hour12: false
+            });
+        }
+    }
+}
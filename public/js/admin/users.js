@@ -7,11 +7,12 @@ function userManagement() {
         showEditModal: false,
         editMode: false,
         currentUser: null,
+        preview: null,
         form: {
             username: '',
             password: '',
             nickname: '',
-            role_id: '',
+            role_ids: [],
             status: 1
         },
         loading: false,
@@ -43,7 +44,7 @@ function userManagement() {
                 username: '',
                 password: '',
                 nickname: '',
-                role_id: '',
+                role_ids: [],
                 status: 1
             };
             this.showCreateModal = true;
@@ -54,11 +55,27 @@ function userManagement() {
             this.form = {
                 username: user.username,
                 nickname: user.nickname,
-                role_id: user.role_id,
+                role_ids: (user.roles || []).map(role => role.id),
                 status: user.status,
                 password: ''
             };
+            this.preview = null;
             this.showEditModal = true;
+            this.previewPermissions();
+        },
+        async previewPermissions() {
+            if (!this.editMode || !this.currentUser) return;
+
+            try {
+                // 按表单中尚未保存的角色计算有效权限
+                const roleIds = this.form.role_ids.map(id => parseInt(id)).join(',');
+                const response = await fetch(`/api/users/${this.currentUser.id}/permissions?role_ids=${roleIds}`);
+                const result = await response.json();
+                if (!response.ok) throw new Error(result.error || '获取有效权限失败');
+                this.preview = result.data;
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
         },
         closeModal() {
             this.showCreateModal = false;
@@ -67,7 +84,7 @@ function userManagement() {
                 username: '',
                 password: '',
                 nickname: '',
-                role_id: '',
+                role_ids: [],
                 status: 1
             };
         },
@@ -84,7 +101,10 @@ function userManagement() {
                     headers: {
                         'Content-Type': 'application/json',
                     },
-                    body: JSON.stringify(this.form)
+                    body: JSON.stringify({
+                        ...this.form,
+                        role_ids: this.form.role_ids.map(id => parseInt(id))
+                    })
                 });
 
                 if (!response.ok) {
@@ -123,6 +143,43 @@ function userManagement() {
                 Alpine.store('notification').show(error.message, 'error');
             }
         },
+        async resetTOTP(user) {
+            if (!confirm(`确定要重置用户「${user.username}」的两步验证吗？该用户需要重新绑定。`)) return;
+
+            try {
+                const response = await fetch(`/api/users/${user.id}/totp/reset`, {
+                    method: 'POST'
+                });
+
+                if (!response.ok) {
+                    const error = await response.json();
+                    throw new Error(error.error || '重置失败');
+                }
+
+                Alpine.store('notification').show('两步验证已重置', 'success');
+                this.fetchUsers();
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
+        async revokeSessions(user) {
+            if (!confirm(`确定要强制下线用户「${user.username}」吗？该用户的所有会话和令牌将立即失效。`)) return;
+
+            try {
+                const response = await fetch(`/api/users/${user.id}/sessions/revoke`, {
+                    method: 'POST'
+                });
+
+                const result = await response.json();
+                if (!response.ok) {
+                    throw new Error(result.error || '操作失败');
+                }
+
+                Alpine.store('notification').show(`已强制下线，撤销会话 ${result.count} 个`, 'success');
+            } catch (error) {
+                Alpine.store('notification').show(error.message, 'error');
+            }
+        },
         formatDate(date) {
             if (!date) return '';
             return new Date(date).toLocaleString('zh-CN', {